@@ -0,0 +1,412 @@
+// Package calendar models a world's custom calendar: named months of fixed
+// length, an optional era suffix, a week length and the seasons. Dates are
+// parsed from the free-text "date" property writers put on event nodes.
+package calendar
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Month is a named month with a fixed number of days
+type Month struct {
+	Name string `json:"name"`
+	Days int    `json:"days"`
+}
+
+// Calendar describes how a world counts days
+type Calendar struct {
+	Name        string  `json:"name"`
+	Era         string  `json:"era,omitempty"` // Suffix written after years, e.g. "AC"
+	Months      []Month `json:"months"`
+	DaysPerWeek int     `json:"daysPerWeek"`
+	WeekName    string  `json:"weekName,omitempty"` // What the world calls a week, e.g. "tenday"
+	// Seasons in any order; when empty, the four temperate seasons are spread
+	// over the year as on Earth
+	Seasons []Season `json:"seasons,omitempty"`
+}
+
+// Season is a named part of the year, running from its start day to the
+// next season's. Warmth runs from -1 for the depth of winter to 1 for the
+// height of summer and is reached at the middle of the season.
+type Season struct {
+	Name   string  `json:"name"`
+	Month  int     `json:"month"` // Start month and day, 1-based
+	Day    int     `json:"day"`
+	Warmth float64 `json:"warmth"`
+}
+
+// Date is a calendar date. Month and Day are 1-based; a zero Month or Day
+// means the date is only known to that precision.
+type Date struct {
+	Year  int `json:"year"`
+	Month int `json:"month,omitempty"`
+	Day   int `json:"day,omitempty"`
+}
+
+// Default returns a Gregorian-like calendar without leap years
+func Default() Calendar {
+	return Calendar{
+		Name: "Standard",
+		Months: []Month{
+			{"January", 31}, {"February", 28}, {"March", 31}, {"April", 30},
+			{"May", 31}, {"June", 30}, {"July", 31}, {"August", 31},
+			{"September", 30}, {"October", 31}, {"November", 30}, {"December", 31},
+		},
+		DaysPerWeek: 7,
+	}
+}
+
+// Validate reports whether the calendar is usable
+func (c Calendar) Validate() error {
+	if len(c.Months) == 0 {
+		return fmt.Errorf("calendar needs at least one month")
+	}
+	for i, m := range c.Months {
+		if m.Name == "" {
+			return fmt.Errorf("month %d has no name", i+1)
+		}
+		if m.Days <= 0 {
+			return fmt.Errorf("month %s must have at least one day", m.Name)
+		}
+	}
+	if c.DaysPerWeek <= 0 {
+		return fmt.Errorf("daysPerWeek must be positive")
+	}
+	starts := make(map[int]bool)
+	for i, s := range c.Seasons {
+		if s.Name == "" {
+			return fmt.Errorf("season %d has no name", i+1)
+		}
+		if s.Month < 1 || s.Month > len(c.Months) || s.Day < 1 || s.Day > c.Months[s.Month-1].Days {
+			return fmt.Errorf("season %s starts on a day the calendar doesn't have", s.Name)
+		}
+		if s.Warmth < -1 || s.Warmth > 1 {
+			return fmt.Errorf("season %s must have a warmth between -1 and 1", s.Name)
+		}
+		start := c.DayNumber(Date{Month: s.Month, Day: s.Day})
+		if starts[start] {
+			return fmt.Errorf("season %s starts on the same day as another season", s.Name)
+		}
+		starts[start] = true
+	}
+	return nil
+}
+
+// DaysInYear returns the length of a year in days
+func (c Calendar) DaysInYear() int {
+	total := 0
+	for _, m := range c.Months {
+		total += m.Days
+	}
+	return total
+}
+
+// DayNumber returns the number of days between the start of year 0 and the
+// date. Missing month or day count as the first of their unit.
+func (c Calendar) DayNumber(d Date) int {
+	n := d.Year * c.DaysInYear()
+	for i := 0; i < d.Month-1 && i < len(c.Months); i++ {
+		n += c.Months[i].Days
+	}
+	if d.Day > 0 {
+		n += d.Day - 1
+	}
+	return n
+}
+
+// LastDayNumber returns the day number of the last day a date covers: the
+// date itself, or the last day of its month or year when those are missing
+func (c Calendar) LastDayNumber(d Date) int {
+	switch {
+	case d.Month == 0:
+		return c.DayNumber(Date{Year: d.Year + 1}) - 1
+	case d.Day == 0 && d.Month <= len(c.Months):
+		return c.DayNumber(d) + c.Months[d.Month-1].Days - 1
+	default:
+		return c.DayNumber(d)
+	}
+}
+
+// FromDayNumber is the inverse of DayNumber
+func (c Calendar) FromDayNumber(n int) Date {
+	perYear := c.DaysInYear()
+	year := n / perYear
+	rest := n % perYear
+	if rest < 0 {
+		year--
+		rest += perYear
+	}
+	for i, m := range c.Months {
+		if rest < m.Days {
+			return Date{Year: year, Month: i + 1, Day: rest + 1}
+		}
+		rest -= m.Days
+	}
+	return Date{Year: year, Month: len(c.Months), Day: c.Months[len(c.Months)-1].Days}
+}
+
+// YearsBetween returns the number of full years elapsed from one date to another
+func (c Calendar) YearsBetween(from, to Date) int {
+	years := to.Year - from.Year
+	if c.DayNumber(Date{Month: to.Month, Day: to.Day}) < c.DayNumber(Date{Month: from.Month, Day: from.Day}) {
+		years--
+	}
+	return years
+}
+
+// Duration is a span of days broken into calendar units. Months are counted
+// at the calendar's average month length.
+type Duration struct {
+	Years  int     `json:"years"`
+	Months int     `json:"months"`
+	Weeks  int     `json:"weeks"`
+	Days   float64 `json:"days"` // Remaining days, to a tenth of a day
+	Text   string  `json:"text"` // e.g. "1 month, 2 tendays, 3.5 days"
+}
+
+// Duration breaks a number of days into years, months, weeks and days
+func (c Calendar) Duration(days float64) Duration {
+	var d Duration
+	days = math.Round(days*10) / 10
+	if year := float64(c.DaysInYear()); year > 0 {
+		d.Years = int(days / year)
+		days -= float64(d.Years) * year
+		if month := year / float64(len(c.Months)); month > 0 {
+			d.Months = int(days / month)
+			days -= float64(d.Months) * month
+		}
+	}
+	if c.DaysPerWeek > 0 {
+		d.Weeks = int(days / float64(c.DaysPerWeek))
+		days -= float64(d.Weeks * c.DaysPerWeek)
+	}
+	d.Days = math.Max(0, math.Round(days*10)/10)
+
+	week := c.WeekName
+	if week == "" {
+		week = "week"
+	}
+	var parts []string
+	for _, unit := range []struct {
+		n    int
+		name string
+	}{{d.Years, "year"}, {d.Months, "month"}, {d.Weeks, week}} {
+		if unit.n == 1 {
+			parts = append(parts, "1 "+unit.name)
+		} else if unit.n > 1 {
+			parts = append(parts, fmt.Sprintf("%d %ss", unit.n, unit.name))
+		}
+	}
+	if d.Days == 1 {
+		parts = append(parts, "1 day")
+	} else if d.Days > 0 || len(parts) == 0 {
+		parts = append(parts, strconv.FormatFloat(d.Days, 'f', -1, 64)+" days")
+	}
+	d.Text = strings.Join(parts, ", ")
+	return d
+}
+
+// SeasonList returns the calendar's seasons ordered by start day, or the
+// four temperate seasons placed where Earth's equinoxes and solstices fall
+// in the year
+func (c Calendar) SeasonList() []Season {
+	seasons := append([]Season(nil), c.Seasons...)
+	if len(seasons) == 0 {
+		year := float64(c.DaysInYear())
+		for _, s := range []struct {
+			name   string
+			at     float64 // Fraction of the year
+			warmth float64
+		}{{"Spring", 0.214, 0}, {"Summer", 0.468, 1}, {"Autumn", 0.723, 0}, {"Winter", 0.970, -1}} {
+			d := c.FromDayNumber(int(s.at * year))
+			seasons = append(seasons, Season{Name: s.name, Month: d.Month, Day: d.Day, Warmth: s.warmth})
+		}
+	}
+	sort.SliceStable(seasons, func(i, j int) bool {
+		return c.DayNumber(Date{Month: seasons[i].Month, Day: seasons[i].Day}) <
+			c.DayNumber(Date{Month: seasons[j].Month, Day: seasons[j].Day})
+	})
+	return seasons
+}
+
+// SeasonAt returns the season a date falls in and the warmth of that day,
+// eased between the warmth of the seasons around it
+func (c Calendar) SeasonAt(d Date) (Season, float64) {
+	seasons := c.SeasonList()
+	year := c.DaysInYear()
+	wrap := func(n int) int { return ((n % year) + year) % year }
+	day := c.DayNumber(Date{Month: d.Month, Day: d.Day})
+
+	starts := make([]int, len(seasons))
+	for i, s := range seasons {
+		starts[i] = c.DayNumber(Date{Month: s.Month, Day: s.Day})
+	}
+	// The season that started most recently, counting back into last year
+	current := len(seasons) - 1
+	for i, start := range starts {
+		if start <= day {
+			current = i
+		}
+	}
+	if len(seasons) == 1 {
+		return seasons[0], seasons[0].Warmth
+	}
+
+	// Middle of each season, in days from the start of the year. The last
+	// season's middle can fall in the next year, so middles wrap into the
+	// year and are sorted again.
+	type middle struct {
+		day    float64
+		warmth float64
+	}
+	middles := make([]middle, len(seasons))
+	for i := range seasons {
+		length := wrap(starts[(i+1)%len(seasons)] - starts[i])
+		middles[i] = middle{floatMod(float64(starts[i])+float64(length)/2, float64(year)), seasons[i].Warmth}
+	}
+	sort.SliceStable(middles, func(i, j int) bool { return middles[i].day < middles[j].day })
+
+	// Ease from the middle most recently passed, counting back into last
+	// year, to the next one
+	from := len(middles) - 1
+	for i, m := range middles {
+		if m.day <= float64(day) {
+			from = i
+		}
+	}
+	to := (from + 1) % len(middles)
+	span := floatMod(middles[to].day-middles[from].day, float64(year))
+	if span == 0 {
+		return seasons[current], middles[from].warmth
+	}
+	elapsed := floatMod(float64(day)-middles[from].day, float64(year))
+	t := (1 - math.Cos(math.Pi*elapsed/span)) / 2
+	return seasons[current], middles[from].warmth + (middles[to].warmth-middles[from].warmth)*t
+}
+
+// floatMod returns x modulo y, from 0 up to y even for negative x
+func floatMod(x, y float64) float64 {
+	return math.Mod(math.Mod(x, y)+y, y)
+}
+
+// Format renders a date using the calendar's month names and era
+func (c Calendar) Format(d Date) string {
+	s := strconv.Itoa(d.Year)
+	if d.Month > 0 && d.Month <= len(c.Months) {
+		s = c.Months[d.Month-1].Name + " " + s
+		if d.Day > 0 {
+			s = strconv.Itoa(d.Day) + " " + s
+		}
+	}
+	if c.Era != "" {
+		s += " " + c.Era
+	}
+	return s
+}
+
+// Parse reads dates such as "1200", "1200-03-15", "15 Frostmoon 1200",
+// "Frostmoon 1200" or "Year 302 AC"
+func (c Calendar) Parse(s string) (Date, error) {
+	text := strings.ToLower(strings.TrimSpace(s))
+	if c.Era != "" {
+		text = strings.TrimSpace(strings.TrimSuffix(text, strings.ToLower(c.Era)))
+	}
+	text = strings.TrimSpace(strings.TrimPrefix(text, "year"))
+	if text == "" {
+		return Date{}, fmt.Errorf("empty date")
+	}
+
+	if !strings.ContainsAny(text, " ,") {
+		return c.parseNumeric(text, s)
+	}
+
+	// Written form with a month name
+	var numbers []int
+	month := 0
+	for _, token := range strings.Fields(strings.ReplaceAll(text, ",", " ")) {
+		if n, err := strconv.Atoi(token); err == nil {
+			numbers = append(numbers, n)
+			continue
+		}
+		if m := c.monthIndex(token); m > 0 && month == 0 {
+			month = m
+			continue
+		}
+		if token == "of" {
+			continue
+		}
+		return Date{}, fmt.Errorf("unrecognised word %q in date %q", token, s)
+	}
+
+	var d Date
+	switch len(numbers) {
+	case 1:
+		d = Date{Year: numbers[0], Month: month}
+	case 2:
+		if month == 0 {
+			return Date{}, fmt.Errorf("invalid date %q", s)
+		}
+		d = Date{Year: numbers[1], Month: month, Day: numbers[0]}
+	default:
+		return Date{}, fmt.Errorf("invalid date %q", s)
+	}
+	return d, c.check(d, s)
+}
+
+// parseNumeric reads the year[-month[-day]] form; a leading minus is a
+// negative year
+func (c Calendar) parseNumeric(text, s string) (Date, error) {
+	negative := strings.HasPrefix(text, "-")
+	parts := strings.Split(strings.TrimPrefix(text, "-"), "-")
+	if len(parts) > 3 {
+		return Date{}, fmt.Errorf("invalid date %q", s)
+	}
+
+	var numbers [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return Date{}, fmt.Errorf("invalid date %q", s)
+		}
+		numbers[i] = n
+	}
+	if negative {
+		numbers[0] = -numbers[0]
+	}
+
+	d := Date{Year: numbers[0], Month: numbers[1], Day: numbers[2]}
+	return d, c.check(d, s)
+}
+
+// monthIndex matches a month by full name or an unambiguous prefix of at least
+// three letters
+func (c Calendar) monthIndex(token string) int {
+	match := 0
+	for i, m := range c.Months {
+		name := strings.ToLower(m.Name)
+		if name == token {
+			return i + 1
+		}
+		if len(token) >= 3 && strings.HasPrefix(name, token) {
+			if match != 0 {
+				return 0
+			}
+			match = i + 1
+		}
+	}
+	return match
+}
+
+func (c Calendar) check(d Date, s string) error {
+	if d.Month < 0 || d.Month > len(c.Months) {
+		return fmt.Errorf("month out of range in date %q", s)
+	}
+	if d.Day < 0 || (d.Month > 0 && d.Day > c.Months[d.Month-1].Days) || (d.Month == 0 && d.Day > 0) {
+		return fmt.Errorf("day out of range in date %q", s)
+	}
+	return nil
+}
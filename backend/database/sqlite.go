@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -86,12 +87,466 @@ func createTables(db *sql.DB) error {
 		}
 	}
 
+	// Create rules table for the lore consistency engine; spec holds the
+	// declarative rule definition as JSON
+	rulesTable := `
+        CREATE TABLE IF NOT EXISTS rules (
+            id TEXT PRIMARY KEY,
+            name TEXT NOT NULL,
+            description TEXT DEFAULT '',
+            severity TEXT DEFAULT 'warning',
+            message TEXT DEFAULT '',
+            spec TEXT NOT NULL,
+            enabled INTEGER DEFAULT 1,
+            evaluate_on_write INTEGER DEFAULT 0,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );`
+	if _, err := db.Exec(rulesTable); err != nil {
+		return fmt.Errorf("failed to create rules table: %v", err)
+	}
+
+	// Create rule findings table, replaced per rule on every evaluation
+	findingsTable := `
+        CREATE TABLE IF NOT EXISTS rule_findings (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            rule_id TEXT NOT NULL,
+            node_id TEXT NOT NULL,
+            severity TEXT NOT NULL,
+            message TEXT NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (rule_id) REFERENCES rules(id) ON DELETE CASCADE,
+            FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
+        );`
+	if _, err := db.Exec(findingsTable); err != nil {
+		return fmt.Errorf("failed to create rule findings table: %v", err)
+	}
+
+	// Create settings table for world-wide configuration such as the calendar
+	settingsTable := `
+        CREATE TABLE IF NOT EXISTS settings (
+            key TEXT PRIMARY KEY,
+            value TEXT NOT NULL,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );`
+	if _, err := db.Exec(settingsTable); err != nil {
+		return fmt.Errorf("failed to create settings table: %v", err)
+	}
+
+	// Create manuscript tables for scene board and novel sync
+	manuscriptsTable := `
+        CREATE TABLE IF NOT EXISTS manuscripts (
+            id TEXT PRIMARY KEY,
+            title TEXT NOT NULL,
+            format TEXT NOT NULL,
+            source_path TEXT DEFAULT '',
+            content_hash TEXT DEFAULT '',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );`
+	if _, err := db.Exec(manuscriptsTable); err != nil {
+		return fmt.Errorf("failed to create manuscripts table: %v", err)
+	}
+
+	chaptersTable := `
+        CREATE TABLE IF NOT EXISTS chapters (
+            id TEXT PRIMARY KEY,
+            manuscript_id TEXT NOT NULL,
+            ordinal INTEGER NOT NULL,
+            title TEXT DEFAULT '',
+            FOREIGN KEY (manuscript_id) REFERENCES manuscripts(id) ON DELETE CASCADE
+        );`
+	if _, err := db.Exec(chaptersTable); err != nil {
+		return fmt.Errorf("failed to create chapters table: %v", err)
+	}
+
+	// POV and location keep the name as written even if no node matches it
+	scenesTable := `
+        CREATE TABLE IF NOT EXISTS scenes (
+            id TEXT PRIMARY KEY,
+            manuscript_id TEXT NOT NULL,
+            chapter_id TEXT NOT NULL,
+            ordinal INTEGER NOT NULL,
+            title TEXT DEFAULT '',
+            pov_name TEXT DEFAULT '',
+            pov_node_id TEXT,
+            location_name TEXT DEFAULT '',
+            location_node_id TEXT,
+            word_count INTEGER DEFAULT 0,
+            content TEXT DEFAULT '',
+            content_hash TEXT DEFAULT '',
+            FOREIGN KEY (manuscript_id) REFERENCES manuscripts(id) ON DELETE CASCADE,
+            FOREIGN KEY (chapter_id) REFERENCES chapters(id) ON DELETE CASCADE,
+            FOREIGN KEY (pov_node_id) REFERENCES nodes(id) ON DELETE SET NULL,
+            FOREIGN KEY (location_node_id) REFERENCES nodes(id) ON DELETE SET NULL
+        );`
+	if _, err := db.Exec(scenesTable); err != nil {
+		return fmt.Errorf("failed to create scenes table: %v", err)
+	}
+
+	appearancesTable := `
+        CREATE TABLE IF NOT EXISTS appearances (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            scene_id TEXT NOT NULL,
+            node_id TEXT NOT NULL,
+            mention_count INTEGER DEFAULT 0,
+            first_offset INTEGER DEFAULT 0,
+            matched_text TEXT DEFAULT '',
+            is_pov INTEGER DEFAULT 0,
+            is_location INTEGER DEFAULT 0,
+            UNIQUE (scene_id, node_id),
+            FOREIGN KEY (scene_id) REFERENCES scenes(id) ON DELETE CASCADE,
+            FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
+        );`
+	if _, err := db.Exec(appearancesTable); err != nil {
+		return fmt.Errorf("failed to create appearances table: %v", err)
+	}
+
+	// Record which manuscript file revision each appearance was computed from
+	if err := addColumn(db, "appearances", "source_revision", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "appearances", "updated_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	// Create change feed table; details holds a JSON payload per change
+	changesTable := `
+        CREATE TABLE IF NOT EXISTS changes (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            entity TEXT NOT NULL,
+            entity_id TEXT NOT NULL,
+            action TEXT NOT NULL,
+            summary TEXT DEFAULT '',
+            details TEXT DEFAULT '{}',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );`
+	if _, err := db.Exec(changesTable); err != nil {
+		return fmt.Errorf("failed to create changes table: %v", err)
+	}
+
+	// Create wiki-link mentions table; target_node_id is NULL while a link
+	// does not resolve to any node
+	mentionsTable := `
+        CREATE TABLE IF NOT EXISTS mentions (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            source_node_id TEXT NOT NULL,
+            target_node_id TEXT,
+            target_text TEXT NOT NULL,
+            label TEXT DEFAULT '',
+            position INTEGER DEFAULT 0,
+            FOREIGN KEY (source_node_id) REFERENCES nodes(id) ON DELETE CASCADE,
+            FOREIGN KEY (target_node_id) REFERENCES nodes(id) ON DELETE SET NULL
+        );`
+	if _, err := db.Exec(mentionsTable); err != nil {
+		return fmt.Errorf("failed to create mentions table: %v", err)
+	}
+
+	// Create node aliases table; language and era are optional tags
+	aliasesTable := `
+        CREATE TABLE IF NOT EXISTS node_aliases (
+            id TEXT PRIMARY KEY,
+            node_id TEXT NOT NULL,
+            alias TEXT NOT NULL,
+            language TEXT DEFAULT '',
+            era TEXT DEFAULT '',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
+        );`
+	if _, err := db.Exec(aliasesTable); err != nil {
+		return fmt.Errorf("failed to create node_aliases table: %v", err)
+	}
+
+	// Create node merge provenance table; source_snapshot holds the merged
+	// node as JSON since the node itself is deleted
+	mergesTable := `
+        CREATE TABLE IF NOT EXISTS node_merges (
+            id TEXT PRIMARY KEY,
+            target_node_id TEXT NOT NULL,
+            source_node_id TEXT NOT NULL,
+            source_name TEXT NOT NULL,
+            source_snapshot TEXT DEFAULT '{}',
+            policy TEXT NOT NULL,
+            conflicts TEXT DEFAULT '[]',
+            edges_repointed INTEGER DEFAULT 0,
+            edges_dropped INTEGER DEFAULT 0,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (target_node_id) REFERENCES nodes(id) ON DELETE CASCADE
+        );`
+	if _, err := db.Exec(mergesTable); err != nil {
+		return fmt.Errorf("failed to create node_merges table: %v", err)
+	}
+
+	// Create import plans table; a dry run stores the request it previewed so
+	// the confirmation can replay exactly that import
+	importPlansTable := `
+        CREATE TABLE IF NOT EXISTS import_plans (
+            token TEXT PRIMARY KEY,
+            request TEXT NOT NULL,
+            planned_at INTEGER NOT NULL,
+            diff_hash TEXT NOT NULL,
+            expires_at DATETIME NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );`
+	if _, err := db.Exec(importPlansTable); err != nil {
+		return fmt.Errorf("failed to create import_plans table: %v", err)
+	}
+
+	// Create import batch tables; every node and edge an import creates
+	// carries its batch ID, and rows the import overwrote or deleted are
+	// backed up as a JSON array of their columns so the batch can be reverted
+	importBatchesTable := `
+        CREATE TABLE IF NOT EXISTS import_batches (
+            id TEXT PRIMARY KEY,
+            source TEXT DEFAULT '',
+            strategy TEXT NOT NULL,
+            nodes_created INTEGER DEFAULT 0,
+            edges_created INTEGER DEFAULT 0,
+            nodes_updated INTEGER DEFAULT 0,
+            edges_updated INTEGER DEFAULT 0,
+            nodes_deleted INTEGER DEFAULT 0,
+            edges_deleted INTEGER DEFAULT 0,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );`
+	if _, err := db.Exec(importBatchesTable); err != nil {
+		return fmt.Errorf("failed to create import_batches table: %v", err)
+	}
+
+	importBackupsTable := `
+        CREATE TABLE IF NOT EXISTS import_batch_backups (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            batch_id TEXT NOT NULL,
+            entity TEXT NOT NULL,
+            entity_id TEXT NOT NULL,
+            data TEXT NOT NULL,
+            FOREIGN KEY (batch_id) REFERENCES import_batches(id) ON DELETE CASCADE
+        );`
+	if _, err := db.Exec(importBackupsTable); err != nil {
+		return fmt.Errorf("failed to create import_batch_backups table: %v", err)
+	}
+
+	if err := addColumn(db, "nodes", "import_batch_id", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "edges", "import_batch_id", "TEXT"); err != nil {
+		return err
+	}
+
+	// Create world map tables; the image lives in the asset directory and
+	// pins place nodes at pixel coordinates on it
+	worldMapsTable := `
+        CREATE TABLE IF NOT EXISTS world_maps (
+            id TEXT PRIMARY KEY,
+            name TEXT NOT NULL,
+            image_path TEXT NOT NULL,
+            content_type TEXT NOT NULL,
+            width INTEGER NOT NULL,
+            height INTEGER NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );`
+	if _, err := db.Exec(worldMapsTable); err != nil {
+		return fmt.Errorf("failed to create world_maps table: %v", err)
+	}
+
+	// Icon and label override the node's own when set
+	mapPinsTable := `
+        CREATE TABLE IF NOT EXISTS map_pins (
+            id TEXT PRIMARY KEY,
+            map_id TEXT NOT NULL,
+            node_id TEXT NOT NULL,
+            x REAL NOT NULL,
+            y REAL NOT NULL,
+            icon TEXT DEFAULT '',
+            label TEXT DEFAULT '',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (map_id) REFERENCES world_maps(id) ON DELETE CASCADE,
+            FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
+        );`
+	if _, err := db.Exec(mapPinsTable); err != nil {
+		return fmt.Errorf("failed to create map_pins table: %v", err)
+	}
+
+	// Nested maps: a child map covers a rectangle of its parent, in the
+	// parent's pixels, and may depict a location or city node
+	if err := addColumn(db, "world_maps", "parent_id", "TEXT REFERENCES world_maps(id) ON DELETE SET NULL"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "world_maps", "node_id", "TEXT REFERENCES nodes(id) ON DELETE SET NULL"); err != nil {
+		return err
+	}
+	for _, column := range []string{"parent_x", "parent_y", "parent_width", "parent_height"} {
+		if err := addColumn(db, "world_maps", column, "REAL"); err != nil {
+			return err
+		}
+	}
+	if err := addColumn(db, "map_pins", "child_map_id", "TEXT REFERENCES world_maps(id) ON DELETE SET NULL"); err != nil {
+		return err
+	}
+
+	// Map scale, measured from a known distance, in image pixels per mile or km
+	if err := addColumn(db, "world_maps", "pixels_per_unit", "REAL"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "world_maps", "scale_unit", "TEXT"); err != nil {
+		return err
+	}
+
+	// Tile pyramid generation state. tile_status is '' until the map is
+	// queued, then pending, running, done or failed.
+	tileColumns := []struct{ name, definition string }{
+		{"tile_status", "TEXT DEFAULT ''"},
+		{"tiles_done", "INTEGER DEFAULT 0"},
+		{"tiles_total", "INTEGER DEFAULT 0"},
+		{"tile_max_zoom", "INTEGER DEFAULT 0"},
+		{"tile_error", "TEXT DEFAULT ''"},
+	}
+	for _, column := range tileColumns {
+		if err := addColumn(db, "world_maps", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	// Routes are polylines between two pins on a map. Points holds the
+	// vertices between the pins as a JSON array of {x, y}.
+	mapRoutesTable := `
+        CREATE TABLE IF NOT EXISTS map_routes (
+            id TEXT PRIMARY KEY,
+            map_id TEXT NOT NULL,
+            from_pin_id TEXT NOT NULL,
+            to_pin_id TEXT NOT NULL,
+            name TEXT DEFAULT '',
+            points TEXT DEFAULT '[]',
+            terrain TEXT NOT NULL,
+            speed_modifier REAL NOT NULL DEFAULT 1,
+            toll REAL NOT NULL DEFAULT 0,
+            danger INTEGER NOT NULL DEFAULT 0,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (map_id) REFERENCES world_maps(id) ON DELETE CASCADE,
+            FOREIGN KEY (from_pin_id) REFERENCES map_pins(id) ON DELETE CASCADE,
+            FOREIGN KEY (to_pin_id) REFERENCES map_pins(id) ON DELETE CASCADE
+        );`
+	if _, err := db.Exec(mapRoutesTable); err != nil {
+		return fmt.Errorf("failed to create map_routes table: %v", err)
+	}
+
+	// Map layers group polygons and pins. Hidden layers are for the GM only
+	// and are never sent to players.
+	mapLayersTable := `
+        CREATE TABLE IF NOT EXISTS map_layers (
+            id TEXT PRIMARY KEY,
+            map_id TEXT NOT NULL,
+            name TEXT NOT NULL,
+            color TEXT DEFAULT '',
+            hidden BOOLEAN NOT NULL DEFAULT 0,
+            sort_order INTEGER NOT NULL DEFAULT 0,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (map_id) REFERENCES world_maps(id) ON DELETE CASCADE
+        );`
+	if _, err := db.Exec(mapLayersTable); err != nil {
+		return fmt.Errorf("failed to create map_layers table: %v", err)
+	}
+
+	// Points is a JSON array of {x, y} in map image pixels
+	mapShapesTable := `
+        CREATE TABLE IF NOT EXISTS map_shapes (
+            id TEXT PRIMARY KEY,
+            layer_id TEXT NOT NULL,
+            name TEXT DEFAULT '',
+            points TEXT NOT NULL,
+            color TEXT DEFAULT '',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (layer_id) REFERENCES map_layers(id) ON DELETE CASCADE
+        );`
+	if _, err := db.Exec(mapShapesTable); err != nil {
+		return fmt.Errorf("failed to create map_shapes table: %v", err)
+	}
+
+	// Pins on a layer go with it, so deleting a hidden layer never turns its
+	// pins public
+	if err := addColumn(db, "map_pins", "layer_id", "TEXT REFERENCES map_layers(id) ON DELETE CASCADE"); err != nil {
+		return err
+	}
+
+	campaignsTable := `
+        CREATE TABLE IF NOT EXISTS campaigns (
+            id TEXT PRIMARY KEY,
+            name TEXT NOT NULL,
+            description TEXT DEFAULT '',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );`
+	if _, err := db.Exec(campaignsTable); err != nil {
+		return fmt.Errorf("failed to create campaigns table: %v", err)
+	}
+
+	// Fog of war: each campaign sees only the polygons revealed on each map
+	fogRevealsTable := `
+        CREATE TABLE IF NOT EXISTS fog_reveals (
+            id TEXT PRIMARY KEY,
+            campaign_id TEXT NOT NULL,
+            map_id TEXT NOT NULL,
+            points TEXT NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (campaign_id) REFERENCES campaigns(id) ON DELETE CASCADE,
+            FOREIGN KEY (map_id) REFERENCES world_maps(id) ON DELETE CASCADE
+        );`
+	if _, err := db.Exec(fogRevealsTable); err != nil {
+		return fmt.Errorf("failed to create fog_reveals table: %v", err)
+	}
+
+	mapRegionsTable := `
+        CREATE TABLE IF NOT EXISTS map_regions (
+            id TEXT PRIMARY KEY,
+            map_id TEXT NOT NULL,
+            node_id TEXT NOT NULL,
+            name TEXT DEFAULT '',
+            points TEXT NOT NULL,
+            color TEXT DEFAULT '',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (map_id) REFERENCES world_maps(id) ON DELETE CASCADE,
+            FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
+        );`
+	if _, err := db.Exec(mapRegionsTable); err != nil {
+		return fmt.Errorf("failed to create map_regions table: %v", err)
+	}
+
 	// Create indices for better performance
 	indices := []string{
 		"CREATE INDEX IF NOT EXISTS idx_nodes_type ON nodes(type);",
 		"CREATE INDEX IF NOT EXISTS idx_edges_source ON edges(source_node_id);",
 		"CREATE INDEX IF NOT EXISTS idx_edges_target ON edges(target_node_id);",
 		"CREATE INDEX IF NOT EXISTS idx_edges_relationship ON edges(relationship);",
+		"CREATE INDEX IF NOT EXISTS idx_rule_findings_rule ON rule_findings(rule_id);",
+		"CREATE INDEX IF NOT EXISTS idx_rule_findings_node ON rule_findings(node_id);",
+		"CREATE INDEX IF NOT EXISTS idx_scenes_chapter ON scenes(chapter_id);",
+		"CREATE INDEX IF NOT EXISTS idx_appearances_node ON appearances(node_id);",
+		"CREATE INDEX IF NOT EXISTS idx_manuscripts_source ON manuscripts(source_path);",
+		"CREATE INDEX IF NOT EXISTS idx_mentions_source ON mentions(source_node_id);",
+		"CREATE INDEX IF NOT EXISTS idx_mentions_target ON mentions(target_node_id);",
+		"CREATE INDEX IF NOT EXISTS idx_node_aliases_node ON node_aliases(node_id);",
+		"CREATE INDEX IF NOT EXISTS idx_node_merges_target ON node_merges(target_node_id);",
+		"CREATE INDEX IF NOT EXISTS idx_nodes_import_batch ON nodes(import_batch_id);",
+		"CREATE INDEX IF NOT EXISTS idx_edges_import_batch ON edges(import_batch_id);",
+		"CREATE INDEX IF NOT EXISTS idx_import_batch_backups_batch ON import_batch_backups(batch_id);",
+		"CREATE INDEX IF NOT EXISTS idx_map_pins_map ON map_pins(map_id);",
+		"CREATE INDEX IF NOT EXISTS idx_map_pins_node ON map_pins(node_id);",
+		"CREATE INDEX IF NOT EXISTS idx_world_maps_parent ON world_maps(parent_id);",
+		"CREATE INDEX IF NOT EXISTS idx_world_maps_node ON world_maps(node_id);",
+		"CREATE INDEX IF NOT EXISTS idx_map_routes_map ON map_routes(map_id);",
+		"CREATE INDEX IF NOT EXISTS idx_map_routes_from ON map_routes(from_pin_id);",
+		"CREATE INDEX IF NOT EXISTS idx_map_routes_to ON map_routes(to_pin_id);",
+		"CREATE INDEX IF NOT EXISTS idx_map_layers_map ON map_layers(map_id);",
+		"CREATE INDEX IF NOT EXISTS idx_map_shapes_layer ON map_shapes(layer_id);",
+		"CREATE INDEX IF NOT EXISTS idx_map_pins_layer ON map_pins(layer_id);",
+		"CREATE INDEX IF NOT EXISTS idx_fog_reveals_campaign_map ON fog_reveals(campaign_id, map_id);",
+		"CREATE INDEX IF NOT EXISTS idx_map_regions_map ON map_regions(map_id);",
+		"CREATE INDEX IF NOT EXISTS idx_map_regions_node ON map_regions(node_id);",
 	}
 
 	for _, index := range indices {
@@ -117,8 +572,17 @@ func createTables(db *sql.DB) error {
 
 // isDuplicateColumnError checks if the error is due to a duplicate column
 func isDuplicateColumnError(err error) bool {
-	return err != nil && (err.Error() == "duplicate column name: properties" ||
-		err.Error() == "SQL logic error: duplicate column name: properties (1)")
+	return err != nil && strings.Contains(err.Error(), "duplicate column name")
+}
+
+// addColumn adds a column to an existing table (migration), ignoring the
+// error if the column already exists
+func addColumn(db *sql.DB, table, column, definition string) error {
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
+	if _, err := db.Exec(query); err != nil && !isDuplicateColumnError(err) {
+		return fmt.Errorf("failed to add %s column to %s: %v", column, table, err)
+	}
+	return nil
 }
 
 // Begin starts a transaction
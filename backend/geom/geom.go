@@ -0,0 +1,85 @@
+// Package geom tests and rasterises polygons on map images. Polygons are
+// closed implicitly and use the even-odd rule, so they may be concave or
+// cross themselves.
+package geom
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// Point is a position in pixels
+type Point struct {
+	X, Y float64
+}
+
+// Polygon is a ring of at least three points
+type Polygon []Point
+
+// Contains reports whether p lies inside the polygon
+func (poly Polygon) Contains(p Point) bool {
+	inside := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		a, b := poly[i], poly[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Area returns the area the polygon encloses. Parts of a self-crossing
+// polygon wound in opposite directions cancel out.
+func (poly Polygon) Area() float64 {
+	sum := 0.0
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		sum += poly[j].X*poly[i].Y - poly[i].X*poly[j].Y
+	}
+	return math.Abs(sum) / 2
+}
+
+// Transform returns the polygon scaled by s and then moved by (dx, dy)
+func (poly Polygon) Transform(s, dx, dy float64) Polygon {
+	out := make(Polygon, len(poly))
+	for i, p := range poly {
+		out[i] = Point{p.X*s + dx, p.Y*s + dy}
+	}
+	return out
+}
+
+// Fill sets every pixel of mask whose centre lies inside the polygon to the
+// given alpha
+func Fill(mask *image.Alpha, poly Polygon, alpha uint8) {
+	if len(poly) < 3 {
+		return
+	}
+	b := mask.Rect
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, p := range poly {
+		minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+	}
+	startY := int(math.Max(float64(b.Min.Y), math.Floor(minY)))
+	endY := int(math.Min(float64(b.Max.Y), math.Ceil(maxY)))
+
+	var xs []float64
+	for y := startY; y < endY; y++ {
+		cy := float64(y) + 0.5
+		xs = xs[:0]
+		for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+			a, c := poly[i], poly[j]
+			if (a.Y > cy) != (c.Y > cy) {
+				xs = append(xs, (c.X-a.X)*(cy-a.Y)/(c.Y-a.Y)+a.X)
+			}
+		}
+		sort.Float64s(xs)
+		for k := 0; k+1 < len(xs); k += 2 {
+			// Pixels whose centre lies between the crossings
+			from := int(math.Max(float64(b.Min.X), math.Ceil(xs[k]-0.5)))
+			to := int(math.Min(float64(b.Max.X), math.Ceil(xs[k+1]-0.5)))
+			for x := from; x < to; x++ {
+				mask.Pix[mask.PixOffset(x, y)] = alpha
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"mythsmith-backend/importer"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetImportTools lists the tools whose exports can be imported
+func (h *ImportHandler) GetImportTools(c *gin.Context) {
+	tools := []gin.H{}
+	for _, a := range importer.Adapters() {
+		tools = append(tools, gin.H{"name": a.Name(), "title": a.Title()})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"tools": tools,
+		"count": len(tools),
+	})
+}
+
+// readToolRequest converts an uploaded export into an import request
+func readToolRequest(c *gin.Context) (ImportRequest, error) {
+	req, err := bindImportForm(c)
+	if err != nil {
+		return req, err
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return req, fmt.Errorf("missing export file: %v", err)
+	}
+	file, err := header.Open()
+	if err != nil {
+		return req, fmt.Errorf("failed to open %s: %v", header.Filename, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return req, fmt.Errorf("failed to read %s: %v", header.Filename, err)
+	}
+
+	files, err := importer.ReadFiles(header.Filename, data)
+	if err != nil {
+		return req, err
+	}
+
+	var adapter importer.Adapter
+	var ok bool
+	if tool := c.PostForm("tool"); tool != "" {
+		if adapter, ok = importer.Lookup(tool); !ok {
+			return req, fmt.Errorf("unknown tool %q", tool)
+		}
+	} else if adapter, ok = importer.Detect(files); !ok {
+		return req, fmt.Errorf("could not tell which tool %s was exported from; set the tool field", header.Filename)
+	}
+
+	result, err := adapter.Convert(files)
+	if err != nil {
+		return req, fmt.Errorf("failed to read %s export: %v", adapter.Title(), err)
+	}
+
+	for i, n := range result.Nodes {
+		node := ImportNode{ID: n.ID}
+		node.Data = ImportNodeData{
+			ID:          n.ID,
+			Name:        n.Name,
+			Type:        n.Type,
+			Description: n.Description,
+			Properties:  n.Properties,
+		}
+		node.Position.X, node.Position.Y = gridPosition(i)
+		req.Data.Nodes = append(req.Data.Nodes, node)
+	}
+	for _, e := range result.Edges {
+		req.Data.Edges = append(req.Data.Edges, map[string]interface{}{
+			"id":     e.ID,
+			"source": e.Source,
+			"target": e.Target,
+			"data":   map[string]interface{}{"type": e.Relationship},
+		})
+	}
+	req.Warnings = result.Warnings
+	req.Source = header.Filename
+	return req, nil
+}
+
+// ImportTool imports an export of another worldbuilding tool, uploaded as
+// the "file" form field: a JSON file or a zip archive. The "tool" field picks
+// the adapter, which is otherwise detected from the files; "strategy",
+// "fieldPrecedence" and ?dryRun=true work as they do for ImportMap.
+func (h *ImportHandler) ImportTool(c *gin.Context) {
+	req, err := readToolRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Data.Nodes) == 0 && len(req.Data.Edges) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No data to import", "warnings": req.Warnings})
+		return
+	}
+
+	if c.Query("dryRun") == "true" {
+		h.previewImport(c, req)
+		return
+	}
+	h.commitImport(c, req)
+}
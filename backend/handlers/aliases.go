@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mythsmith-backend/database"
+	"mythsmith-backend/models"
+	"mythsmith-backend/resolver"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// loadResolver indexes every node name and alias. Aliases come from the
+// node_aliases table and from the older "aliases" property, which may be a
+// list or a comma-separated string.
+func loadResolver(q queryer) (*resolver.Index, error) {
+	rows, err := q.Query("SELECT id, name, type, COALESCE(properties, '{}') FROM nodes ORDER BY created_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query nodes: %v", err)
+	}
+
+	ix := resolver.NewIndex()
+	names := make(map[string]resolver.Entry)
+	for rows.Next() {
+		var id, name, nodeType, propertiesJSON string
+		if err := rows.Scan(&id, &name, &nodeType, &propertiesJSON); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan node: %v", err)
+		}
+		entry := resolver.Entry{NodeID: id, NodeName: name, NodeType: nodeType, Text: name, Kind: resolver.EntryName}
+		ix.Add(entry)
+		names[id] = entry
+
+		alias := entry
+		alias.Kind = resolver.EntryAlias
+		props := make(map[string]interface{})
+		json.Unmarshal([]byte(propertiesJSON), &props)
+		switch aliases := props["aliases"].(type) {
+		case []interface{}:
+			for _, a := range aliases {
+				if s, ok := a.(string); ok {
+					alias.Text = s
+					ix.Add(alias)
+				}
+			}
+		case string:
+			for _, s := range strings.Split(aliases, ",") {
+				alias.Text = s
+				ix.Add(alias)
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query("SELECT node_id, alias, language, era FROM node_aliases ORDER BY created_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query aliases: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var nodeID string
+		alias := resolver.Entry{Kind: resolver.EntryAlias}
+		if err := rows.Scan(&nodeID, &alias.Text, &alias.Language, &alias.Era); err != nil {
+			return nil, fmt.Errorf("failed to scan alias: %v", err)
+		}
+		name := names[nodeID]
+		alias.NodeID, alias.NodeName, alias.NodeType = nodeID, name.NodeName, name.NodeType
+		ix.Add(alias)
+	}
+
+	return ix, rows.Err()
+}
+
+const aliasColumns = "id, node_id, alias, language, era, created_at"
+
+func scanAlias(row rowScanner) (models.NodeAlias, error) {
+	var alias models.NodeAlias
+	err := row.Scan(&alias.ID, &alias.NodeID, &alias.Alias, &alias.Language, &alias.Era, &alias.CreatedAt)
+	return alias, err
+}
+
+func (h *NodeHandler) nodeExists(c *gin.Context, id string) bool {
+	var exists bool
+	if err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM nodes WHERE id = ?)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve node"})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return false
+	}
+	return true
+}
+
+func (h *NodeHandler) GetAliases(c *gin.Context) {
+	id := c.Param("id")
+	if !h.nodeExists(c, id) {
+		return
+	}
+
+	rows, err := h.db.Query("SELECT "+aliasColumns+" FROM node_aliases WHERE node_id = ? ORDER BY created_at, id", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve aliases"})
+		return
+	}
+	defer rows.Close()
+
+	aliases := []models.NodeAlias{}
+	for rows.Next() {
+		alias, err := scanAlias(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan alias data"})
+			return
+		}
+		aliases = append(aliases, alias)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"aliases": aliases,
+		"count":   len(aliases),
+	})
+}
+
+func (h *NodeHandler) CreateAlias(c *gin.Context) {
+	id := c.Param("id")
+	var req models.NodeAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Alias = strings.TrimSpace(req.Alias)
+	if req.Alias == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "alias must not be blank"})
+		return
+	}
+	if !h.nodeExists(c, id) {
+		return
+	}
+
+	alias := models.NodeAlias{
+		ID:        uuid.NewString(),
+		NodeID:    id,
+		Alias:     req.Alias,
+		Language:  req.Language,
+		Era:       req.Era,
+		CreatedAt: time.Now(),
+	}
+	_, err := h.db.Exec("INSERT INTO node_aliases ("+aliasColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		alias.ID, alias.NodeID, alias.Alias, alias.Language, alias.Era, alias.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create alias"})
+		return
+	}
+
+	// Links written with the new alias can resolve now
+	refreshNodeLinks(h.db, id, nil)
+
+	c.JSON(http.StatusCreated, alias)
+}
+
+func (h *NodeHandler) UpdateAlias(c *gin.Context) {
+	id, aliasID := c.Param("id"), c.Param("aliasId")
+	var req models.NodeAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Alias = strings.TrimSpace(req.Alias)
+	if req.Alias == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "alias must not be blank"})
+		return
+	}
+
+	result, err := h.db.Exec("UPDATE node_aliases SET alias = ?, language = ?, era = ? WHERE id = ? AND node_id = ?",
+		req.Alias, req.Language, req.Era, aliasID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alias"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alias not found"})
+		return
+	}
+
+	refreshAliasLinks(h.db, id)
+
+	alias, err := scanAlias(h.db.QueryRow("SELECT "+aliasColumns+" FROM node_aliases WHERE id = ?", aliasID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve alias"})
+		return
+	}
+	c.JSON(http.StatusOK, alias)
+}
+
+func (h *NodeHandler) DeleteAlias(c *gin.Context) {
+	id, aliasID := c.Param("id"), c.Param("aliasId")
+
+	result, err := h.db.Exec("DELETE FROM node_aliases WHERE id = ? AND node_id = ?", aliasID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete alias"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alias not found"})
+		return
+	}
+
+	// Links written with the alias no longer name the node
+	refreshAliasLinks(h.db, id)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alias deleted successfully"})
+}
+
+type ResolveHandler struct {
+	db *database.DB
+}
+
+func NewResolveHandler(db *database.DB) *ResolveHandler {
+	return &ResolveHandler{db: db}
+}
+
+// Resolve ranks the nodes a free-text name may refer to. ?language= and ?era=
+// restrict which tagged aliases count, ?type= restricts node types.
+func (h *ResolveHandler) Resolve(c *gin.Context) {
+	name := c.Query("name")
+	if strings.TrimSpace(name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+
+	ix, err := loadResolver(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load names"})
+		return
+	}
+
+	matches := ix.Resolve(name, resolver.Options{
+		Language: c.Query("language"),
+		Era:      c.Query("era"),
+		Type:     c.Query("type"),
+		Limit:    limit,
+	})
+	if matches == nil {
+		matches = []resolver.Match{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   name,
+		"matches": matches,
+		"count":   len(matches),
+	})
+}
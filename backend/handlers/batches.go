@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mythsmith-backend/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Columns saved when an import overwrites or deletes a row. For nodes and
+// edges import_batch_id comes last so a backup can be traced to the batch
+// that created the row.
+var backupColumns = map[string][]string{
+	"nodes": {"id", "name", "type", "description", "x", "y", "connection_direction", "properties",
+		"created_at", "updated_at", "import_batch_id"},
+	"edges": {"id", "source_node_id", "target_node_id", "source_handle", "target_handle", "relationship",
+		"properties", "created_at", "import_batch_id"},
+	"node_aliases":  {"id", "node_id", "alias", "language", "era", "created_at"},
+	"node_merges":   {"id", "target_node_id", "source_node_id", "source_name", "source_snapshot", "policy", "conflicts", "edges_repointed", "edges_dropped", "created_at"},
+	"appearances":   {"id", "scene_id", "node_id", "mention_count", "first_offset", "matched_text", "is_pov", "is_location", "source_revision", "updated_at"},
+	"rule_findings": {"id", "rule_id", "node_id", "severity", "message", "created_at"},
+	"map_pins":      {"id", "map_id", "node_id", "x", "y", "icon", "label", "created_at", "updated_at", "child_map_id", "layer_id"},
+	"map_routes":    {"id", "map_id", "from_pin_id", "to_pin_id", "name", "points", "terrain", "speed_modifier", "toll", "danger", "created_at", "updated_at"},
+	"map_regions":   {"id", "map_id", "node_id", "name", "points", "color", "created_at", "updated_at"},
+	"scenes":        {"id", "pov_node_id", "location_node_id"},
+	"world_maps":    {"id", "node_id"},
+}
+
+// nodeDependents are the rows a replace import loses when it clears the
+// nodes, with the rows to back up, in the order they are restored. Most are
+// deleted with their node; scenes and world maps only lose the link, so just
+// their node columns are saved and restored onto the rows still there.
+// Wiki-link mentions are left out because they are indexed again from the
+// descriptions.
+var nodeDependents = []struct {
+	table   string
+	where   string
+	partial bool
+}{
+	{"node_aliases", "1 = 1", false},
+	{"node_merges", "1 = 1", false},
+	{"appearances", "1 = 1", false},
+	{"rule_findings", "node_id IS NOT NULL", false},
+	{"map_pins", "1 = 1", false},
+	{"map_routes", "1 = 1", false},
+	{"map_regions", "1 = 1", false},
+	{"scenes", "pov_node_id IS NOT NULL OR location_node_id IS NOT NULL", true},
+	{"world_maps", "node_id IS NOT NULL", true},
+}
+
+// backupDependents saves the rows that hang off nodes before a replace
+// import clears them
+func (s *importSession) backupDependents() error {
+	for _, d := range nodeDependents {
+		if _, err := s.backup(d.table, d.where); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startBatch records the batch the session's rows belong to
+func (s *importSession) startBatch(source string) error {
+	_, err := s.tx.Exec("INSERT INTO import_batches (id, source, strategy, created_at) VALUES (?, ?, ?, ?)",
+		s.batchID, source, s.strategy, s.now)
+	if err != nil {
+		return fmt.Errorf("failed to record import batch: %v", err)
+	}
+	return nil
+}
+
+// finishBatch stores the counts of a batch once the import has run
+func (s *importSession) finishBatch(nodesDeleted, edgesDeleted int64) error {
+	r := s.response
+	_, err := s.tx.Exec(`
+		UPDATE import_batches
+		SET nodes_created = ?, edges_created = ?, nodes_updated = ?, edges_updated = ?,
+		    nodes_deleted = ?, edges_deleted = ?
+		WHERE id = ?
+	`, r.NodesCreated, r.EdgesCreated, r.NodesUpdated, r.EdgesUpdated, nodesDeleted, edgesDeleted, s.batchID)
+	if err != nil {
+		return fmt.Errorf("failed to update import batch: %v", err)
+	}
+	return nil
+}
+
+// backup saves the rows of table matching where before the import changes
+// them, and returns how many were saved
+func (s *importSession) backup(table, where string, args ...interface{}) (int64, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO import_batch_backups (batch_id, entity, entity_id, data)
+		SELECT ?, ?, id, json_array(%s) FROM %s WHERE %s
+	`, strings.Join(backupColumns[table], ", "), table, where)
+	result, err := s.tx.Exec(query, append([]interface{}{s.batchID, table}, args...)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to back up %s: %v", table, err)
+	}
+	return result.RowsAffected()
+}
+
+// laterBatches returns the batches that overwrote or deleted rows the given
+// batch created. They have to be reverted first.
+func laterBatches(q queryer, batchID string) ([]string, error) {
+	rows, err := q.Query(`
+		SELECT DISTINCT batch_id FROM import_batch_backups
+		WHERE batch_id != ? AND entity IN ('nodes', 'edges') AND json_extract(data, '$[#-1]') = ?
+		ORDER BY batch_id
+	`, batchID, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// restoreBackups writes the backed-up rows of one table back. Rows that still
+// exist are updated in place rather than replaced, so foreign keys pointing
+// at them survive. Edges whose nodes no longer exist are reported, not
+// restored, and so are rows hanging off nodes that can't be written back
+// because something they point at is gone. With partial, only rows that
+// still exist are updated.
+func restoreBackups(tx *sql.Tx, batchID, table string, partial bool) (restored int, skipped []string, err error) {
+	rows, err := tx.Query("SELECT entity_id, data FROM import_batch_backups WHERE batch_id = ? AND entity = ? ORDER BY id",
+		batchID, table)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read backups: %v", err)
+	}
+	type backup struct {
+		id     string
+		values []interface{}
+	}
+	var backups []backup
+	for rows.Next() {
+		var b backup
+		var data string
+		if err := rows.Scan(&b.id, &data); err != nil {
+			rows.Close()
+			return 0, nil, fmt.Errorf("failed to scan backup: %v", err)
+		}
+		if err := json.Unmarshal([]byte(data), &b.values); err != nil {
+			rows.Close()
+			return 0, nil, fmt.Errorf("failed to read backup of %s: %v", b.id, err)
+		}
+		backups = append(backups, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	columns := backupColumns[table]
+	assignments := make([]string, len(columns)-1)
+	for i, column := range columns[1:] {
+		assignments[i] = column + " = ?"
+	}
+	update := fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", table, strings.Join(assignments, ", "))
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?%s)", table, strings.Join(columns, ", "),
+		strings.Repeat(", ?", len(columns)-1))
+
+	for _, b := range backups {
+		if len(b.values) != len(columns) {
+			return restored, skipped, fmt.Errorf("backup of %s has %d columns, expected %d", b.id, len(b.values), len(columns))
+		}
+		if table == "edges" {
+			var endpoints int
+			err := tx.QueryRow(`
+				SELECT (SELECT COUNT(*) FROM nodes WHERE id = ?) + (SELECT COUNT(*) FROM nodes WHERE id = ?)
+			`, b.values[1], b.values[2]).Scan(&endpoints)
+			if err != nil {
+				return restored, skipped, fmt.Errorf("failed to check edge endpoints: %v", err)
+			}
+			if endpoints < 2 {
+				skipped = append(skipped, b.id)
+				continue
+			}
+		}
+
+		result, err := tx.Exec(update, append(b.values[1:], b.id)...)
+		if err != nil {
+			return restored, skipped, fmt.Errorf("failed to restore %s: %v", b.id, err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			if partial {
+				continue
+			}
+			if _, err := tx.Exec(insert, b.values...); err != nil {
+				if table != "nodes" && table != "edges" {
+					skipped = append(skipped, b.id)
+					continue
+				}
+				return restored, skipped, fmt.Errorf("failed to restore %s: %v", b.id, err)
+			}
+		}
+		restored++
+	}
+	return restored, skipped, nil
+}
+
+func (h *ImportHandler) GetImports(c *gin.Context) {
+	rows, err := h.db.Query(`
+		SELECT id, source, strategy, nodes_created, edges_created, nodes_updated, edges_updated,
+		       nodes_deleted, edges_deleted, created_at
+		FROM import_batches
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve imports"})
+		return
+	}
+	defer rows.Close()
+
+	batches := []models.ImportBatch{}
+	for rows.Next() {
+		var b models.ImportBatch
+		if err := rows.Scan(&b.ID, &b.Source, &b.Strategy, &b.NodesCreated, &b.EdgesCreated, &b.NodesUpdated,
+			&b.EdgesUpdated, &b.NodesDeleted, &b.EdgesDeleted, &b.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan import data"})
+			return
+		}
+		batches = append(batches, b)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"imports": batches,
+		"count":   len(batches),
+	})
+}
+
+// RevertImport undoes a batch: the nodes and edges it created are deleted and
+// the rows it overwrote or deleted are restored. Reverting a replace import
+// also brings back what hung off the cleared nodes, such as aliases, merge
+// history, appearances, findings and map pins, routes and regions.
+func (h *ImportHandler) RevertImport(c *gin.Context) {
+	id := c.Param("id")
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var batch models.ImportBatch
+	err = tx.QueryRow("SELECT id, source, strategy, created_at FROM import_batches WHERE id = ?", id).
+		Scan(&batch.ID, &batch.Source, &batch.Strategy, &batch.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve import"})
+		return
+	}
+
+	later, err := laterBatches(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check later imports"})
+		return
+	}
+	if len(later) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Later imports changed rows this import created; revert them first",
+			"imports": later,
+		})
+		return
+	}
+
+	edges, err := tx.Exec("DELETE FROM edges WHERE import_batch_id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete imported edges"})
+		return
+	}
+	nodes, err := tx.Exec("DELETE FROM nodes WHERE import_batch_id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete imported nodes"})
+		return
+	}
+	edgesRemoved, _ := edges.RowsAffected()
+	nodesRemoved, _ := nodes.RowsAffected()
+
+	nodesRestored, _, err := restoreBackups(tx, id, "nodes", false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	edgesRestored, skipped, err := restoreBackups(tx, id, "edges", false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	warnings := []string{}
+	for _, edgeID := range skipped {
+		warnings = append(warnings, fmt.Sprintf("Edge %s was not restored because one of its nodes no longer exists", edgeID))
+	}
+	referencesRestored := 0
+	for _, d := range nodeDependents {
+		n, skipped, err := restoreBackups(tx, id, d.table, d.partial)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		referencesRestored += n
+		for _, rowID := range skipped {
+			warnings = append(warnings, fmt.Sprintf("Row %s of %s was not restored because something it refers to no longer exists", rowID, d.table))
+		}
+	}
+
+	if err := indexAllLinks(tx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to index links: %v", err)})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM import_batches WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete import"})
+		return
+	}
+
+	summary := fmt.Sprintf("Reverted import %s", id)
+	if batch.Source != "" {
+		summary = fmt.Sprintf("Reverted import of %s", batch.Source)
+	}
+	details := gin.H{
+		"nodesRemoved":       nodesRemoved,
+		"edgesRemoved":       edgesRemoved,
+		"nodesRestored":      nodesRestored,
+		"edgesRestored":      edgesRestored,
+		"referencesRestored": referencesRestored,
+		"warnings":           warnings,
+	}
+	if err := recordChange(tx, "import", id, "reverted", summary, details); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	runWriteRules(h.db)
+
+	details["message"] = summary
+	c.JSON(http.StatusOK, details)
+}
@@ -0,0 +1,879 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mythsmith-backend/calendar"
+	"mythsmith-backend/manuscript"
+	"mythsmith-backend/models"
+	"mythsmith-backend/seal"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A .mythsmith bundle is a zip archive holding a whole world:
+//
+//	manifest.json   format, version and a checksum for every other file
+//	nodes.json      nodes in the import format
+//	edges.json      edges in the import format
+//	timeline.json   the calendar and the manuscripts in reading order
+//	settings.json   world settings by key
+//	maps.json       world maps with their layers, shapes, pins, routes and regions
+//	assets/...      portraits, map images and other files
+//
+// Version 2 added maps.json. A version 1 bundle has no map rows, so the map
+// images in it are not imported.
+const (
+	bundleFormat    = "mythsmith"
+	bundleVersion   = 2 // Newest version this build reads and the one it writes
+	bundleManifest  = "manifest.json"
+	bundleNodes     = "nodes.json"
+	bundleEdges     = "edges.json"
+	bundleTimeline  = "timeline.json"
+	bundleSettings  = "settings.json"
+	bundleMaps      = "maps.json"
+	bundleAssetsDir = "assets/"
+)
+
+// assetDir is where asset files live on disk, next to the database
+const assetDir = "data/assets"
+
+// Largest total size of the files a bundle may list
+const maxBundleSize = 2 << 30
+
+// Settings that are not part of the world: the calendar travels in
+// timeline.json and the watch folder is a path on this machine
+var bundleExcludedSettings = map[string]bool{settingCalendar: true, settingManuscriptWatch: true}
+
+// bundleTimelineData is the content of timeline.json
+type bundleTimelineData struct {
+	Calendar    *calendar.Calendar `json:"calendar,omitempty"` // Absent while the default calendar is in use
+	Manuscripts []bundleManuscript `json:"manuscripts"`
+}
+
+// bundleManuscript is a manuscript with its full text. Its source file is
+// not part of the bundle, so an imported manuscript is not watched.
+type bundleManuscript struct {
+	ID        string          `json:"id"`
+	Title     string          `json:"title"`
+	Format    string          `json:"format"`
+	Revision  string          `json:"revision"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Chapters  []bundleChapter `json:"chapters"`
+}
+
+type bundleChapter struct {
+	Title  string        `json:"title"`
+	Scenes []bundleScene `json:"scenes"`
+}
+
+type bundleScene struct {
+	Title    string `json:"title"`
+	POV      string `json:"pov,omitempty"`
+	Location string `json:"location,omitempty"`
+	Text     string `json:"text"`
+}
+
+// bundleContents is a read and verified bundle
+type bundleContents struct {
+	manifest models.BundleManifest
+	nodes    []ImportNode
+	edges    []map[string]interface{}
+	timeline bundleTimelineData
+	settings map[string]json.RawMessage
+	maps     bundleMapData
+	assets   map[string]*zip.File // Path below assets/ -> archive entry
+}
+
+// bundleWriter adds files to a bundle archive and lists them for the manifest
+type bundleWriter struct {
+	zw    *zip.Writer
+	now   time.Time
+	files []models.BundleFile
+}
+
+func (bw *bundleWriter) add(name string, r io.Reader) error {
+	w, err := bw.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: bw.now})
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %v", name, err)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, hash), r)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	bw.files = append(bw.files, models.BundleFile{Path: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))})
+	return nil
+}
+
+func (bw *bundleWriter) addJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", name, err)
+	}
+	return bw.add(name, strings.NewReader(string(data)))
+}
+
+// exportNodes returns the stored nodes in the import format
+func exportNodes(q queryer) ([]ImportNode, error) {
+	nodes, err := loadNodes(q)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	exported := make([]ImportNode, 0, len(nodes))
+	for _, n := range nodes {
+		properties := make(map[string]interface{})
+		for k, v := range n.Properties {
+			if !mergeBookkeeping[k] {
+				properties[k] = v
+			}
+		}
+		node := ImportNode{ID: n.ID}
+		node.Data = ImportNodeData{
+			ID:                  n.ID,
+			Name:                n.Name,
+			Type:                string(n.Type),
+			Description:         n.Description,
+			ConnectionDirection: string(n.ConnectionDirection),
+			Properties:          properties,
+		}
+		node.Position.X, node.Position.Y = n.X, n.Y
+		exported = append(exported, node)
+	}
+	return exported, nil
+}
+
+// exportEdges returns the stored edges in the import format, with the
+// relationship as data.type
+func exportEdges(q queryer) ([]map[string]interface{}, error) {
+	edges, err := loadEdges(q)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].ID < edges[j].ID })
+
+	exported := make([]map[string]interface{}, 0, len(edges))
+	for _, e := range edges {
+		data := make(map[string]interface{})
+		for k, v := range e.Properties {
+			if !mergeBookkeeping[k] {
+				data[k] = v
+			}
+		}
+		data["type"] = e.Relationship
+		exported = append(exported, map[string]interface{}{
+			"id":           e.ID,
+			"source":       e.SourceNodeID,
+			"target":       e.TargetNodeID,
+			"sourceHandle": e.SourceHandle,
+			"targetHandle": e.TargetHandle,
+			"data":         data,
+		})
+	}
+	return exported, nil
+}
+
+// exportTimeline returns the saved calendar and every manuscript with its text
+func exportTimeline(q queryer) (bundleTimelineData, error) {
+	timeline := bundleTimelineData{Manuscripts: []bundleManuscript{}}
+
+	var cal calendar.Calendar
+	saved, err := loadSetting(q, settingCalendar, &cal)
+	if err != nil {
+		return timeline, err
+	}
+	if saved {
+		timeline.Calendar = &cal
+	}
+
+	rows, err := q.Query("SELECT id, title, format, content_hash, created_at FROM manuscripts ORDER BY created_at, id")
+	if err != nil {
+		return timeline, fmt.Errorf("failed to query manuscripts: %v", err)
+	}
+	for rows.Next() {
+		var m bundleManuscript
+		if err := rows.Scan(&m.ID, &m.Title, &m.Format, &m.Revision, &m.CreatedAt); err != nil {
+			rows.Close()
+			return timeline, fmt.Errorf("failed to scan manuscript: %v", err)
+		}
+		timeline.Manuscripts = append(timeline.Manuscripts, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return timeline, err
+	}
+
+	for i := range timeline.Manuscripts {
+		m := &timeline.Manuscripts[i]
+		m.Chapters = []bundleChapter{}
+		chapterIndex := make(map[string]int)
+		rows, err := q.Query("SELECT id, title FROM chapters WHERE manuscript_id = ? ORDER BY ordinal", m.ID)
+		if err != nil {
+			return timeline, fmt.Errorf("failed to query chapters: %v", err)
+		}
+		for rows.Next() {
+			var id, title string
+			if err := rows.Scan(&id, &title); err != nil {
+				rows.Close()
+				return timeline, fmt.Errorf("failed to scan chapter: %v", err)
+			}
+			chapterIndex[id] = len(m.Chapters)
+			m.Chapters = append(m.Chapters, bundleChapter{Title: title, Scenes: []bundleScene{}})
+		}
+		rows.Close()
+
+		rows, err = q.Query(`
+			SELECT chapter_id, title, pov_name, location_name, content
+			FROM scenes WHERE manuscript_id = ? ORDER BY ordinal
+		`, m.ID)
+		if err != nil {
+			return timeline, fmt.Errorf("failed to query scenes: %v", err)
+		}
+		for rows.Next() {
+			var chapterID string
+			var scene bundleScene
+			if err := rows.Scan(&chapterID, &scene.Title, &scene.POV, &scene.Location, &scene.Text); err != nil {
+				rows.Close()
+				return timeline, fmt.Errorf("failed to scan scene: %v", err)
+			}
+			if ci, ok := chapterIndex[chapterID]; ok {
+				m.Chapters[ci].Scenes = append(m.Chapters[ci].Scenes, scene)
+			}
+		}
+		rows.Close()
+	}
+	return timeline, nil
+}
+
+// exportSettings returns the world settings by key
+func exportSettings(q queryer) (map[string]json.RawMessage, error) {
+	rows, err := q.Query("SELECT key, value FROM settings ORDER BY key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query settings: %v", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]json.RawMessage)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan setting: %v", err)
+		}
+		if !bundleExcludedSettings[key] && json.Valid([]byte(value)) {
+			settings[key] = json.RawMessage(value)
+		}
+	}
+	return settings, rows.Err()
+}
+
+// addAssets adds every file below the asset directory. Hidden files and
+// directories, such as an import's staging directory, are left out.
+func (bw *bundleWriter) addAssets(dir string) error {
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return bw.add(bundleAssetsDir+filepath.ToSlash(rel), f)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add assets: %v", err)
+	}
+	return nil
+}
+
+// writeBundle writes the world as a bundle archive to w
+func writeBundle(db queryer, w io.Writer) error {
+	nodes, err := exportNodes(db)
+	if err != nil {
+		return err
+	}
+	edges, err := exportEdges(db)
+	if err != nil {
+		return err
+	}
+	// Route edges are rebuilt from the routes in maps.json
+	graphEdges := edges[:0]
+	for _, e := range edges {
+		if data, _ := e["data"].(map[string]interface{}); data["type"] != models.RelationshipRoute {
+			graphEdges = append(graphEdges, e)
+		}
+	}
+	edges = graphEdges
+	maps, err := exportMaps(db)
+	if err != nil {
+		return err
+	}
+	timeline, err := exportTimeline(db)
+	if err != nil {
+		return err
+	}
+	settings, err := exportSettings(db)
+	if err != nil {
+		return err
+	}
+
+	bw := &bundleWriter{zw: zip.NewWriter(w), now: time.Now().UTC()}
+	if err := bw.addJSON(bundleNodes, nodes); err != nil {
+		return err
+	}
+	if err := bw.addJSON(bundleEdges, edges); err != nil {
+		return err
+	}
+	if err := bw.addJSON(bundleTimeline, timeline); err != nil {
+		return err
+	}
+	if err := bw.addJSON(bundleSettings, settings); err != nil {
+		return err
+	}
+	if err := bw.addJSON(bundleMaps, maps); err != nil {
+		return err
+	}
+	if err := bw.addAssets(assetDir); err != nil {
+		return err
+	}
+
+	manifest := models.BundleManifest{
+		Format:    bundleFormat,
+		Version:   bundleVersion,
+		CreatedAt: bw.now,
+		NodeCount: len(nodes),
+		EdgeCount: len(edges),
+		MapCount:  len(maps["world_maps"]),
+		Files:     bw.files,
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	mw, err := bw.zw.CreateHeader(&zip.FileHeader{Name: bundleManifest, Method: zip.Deflate, Modified: bw.now})
+	if err != nil {
+		return fmt.Errorf("failed to add manifest: %v", err)
+	}
+	if _, err := mw.Write(data); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	return bw.zw.Close()
+}
+
+// ExportBundle downloads the world as a .mythsmith bundle, encrypted when a
+// passphrase is sent in the X-MythSmith-Passphrase header
+func (h *ImportHandler) ExportBundle(c *gin.Context) {
+	// Read everything in one transaction so the files agree with each other
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Build the archive in a temporary file so a failure can still be reported
+	tmp, err := os.CreateTemp("", "mythsmith-*.mythsmith")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bundle"})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := writeBundle(tx, tmp); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("world-%s.mythsmith", time.Now().Format("2006-01-02"))
+	if c.GetHeader(passphraseHeader) == "" {
+		c.FileAttachment(tmp.Name(), filename)
+		return
+	}
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read bundle"})
+		return
+	}
+	sendExport(c, filename, "application/zip", data)
+}
+
+// bundleFileAllowed reports whether a manifest may list the path
+func bundleFileAllowed(name string) bool {
+	switch name {
+	case bundleNodes, bundleEdges, bundleTimeline, bundleSettings, bundleMaps:
+		return true
+	}
+	rel := strings.TrimPrefix(name, bundleAssetsDir)
+	if rel == name || rel == "" || path.Clean(rel) != rel || strings.HasPrefix(rel, "/") {
+		return false
+	}
+	for _, part := range strings.Split(rel, "/") {
+		if part == ".." || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// readBundle checks the manifest version and every checksum, then reads the
+// bundle's data. Nothing is written until all of it has been verified.
+func readBundle(archive *zip.Reader) (*bundleContents, error) {
+	entries := make(map[string]*zip.File, len(archive.File))
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		if entries[entry.Name] != nil {
+			return nil, fmt.Errorf("the bundle contains %s more than once", entry.Name)
+		}
+		entries[entry.Name] = entry
+	}
+
+	manifestEntry := entries[bundleManifest]
+	if manifestEntry == nil {
+		return nil, fmt.Errorf("the bundle has no %s", bundleManifest)
+	}
+	manifestData, err := readZipEntry(manifestEntry, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	b := &bundleContents{assets: make(map[string]*zip.File)}
+	if err := json.Unmarshal(manifestData, &b.manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", bundleManifest, err)
+	}
+	if b.manifest.Format != bundleFormat {
+		return nil, fmt.Errorf("not a MythSmith bundle: format is %q", b.manifest.Format)
+	}
+	if b.manifest.Version < 1 || b.manifest.Version > bundleVersion {
+		return nil, fmt.Errorf("bundle version %d is not supported; this version of MythSmith reads bundles up to version %d",
+			b.manifest.Version, bundleVersion)
+	}
+
+	// Every file must be listed with a matching checksum, and every listed file present
+	var total int64
+	listed := make(map[string]bool, len(b.manifest.Files))
+	for _, f := range b.manifest.Files {
+		if !bundleFileAllowed(f.Path) {
+			return nil, fmt.Errorf("the manifest lists an invalid path %q", f.Path)
+		}
+		if listed[f.Path] {
+			return nil, fmt.Errorf("the manifest lists %s more than once", f.Path)
+		}
+		listed[f.Path] = true
+		if total += f.Size; f.Size < 0 || total > maxBundleSize {
+			return nil, fmt.Errorf("the bundle is too large to import")
+		}
+		entry := entries[f.Path]
+		if entry == nil {
+			return nil, fmt.Errorf("%s is listed in the manifest but missing from the bundle", f.Path)
+		}
+		if err := verifyZipEntry(entry, f); err != nil {
+			return nil, err
+		}
+		if rel := strings.TrimPrefix(f.Path, bundleAssetsDir); rel != f.Path {
+			b.assets[rel] = entry
+		}
+	}
+	for name := range entries {
+		if name != bundleManifest && !listed[name] {
+			return nil, fmt.Errorf("%s is not listed in the manifest", name)
+		}
+	}
+	for _, required := range []string{bundleNodes, bundleEdges} {
+		if !listed[required] {
+			return nil, fmt.Errorf("the bundle has no %s", required)
+		}
+	}
+
+	if err := readBundleJSON(entries, listed, bundleNodes, &b.nodes); err != nil {
+		return nil, err
+	}
+	if err := readBundleJSON(entries, listed, bundleEdges, &b.edges); err != nil {
+		return nil, err
+	}
+	if err := readBundleJSON(entries, listed, bundleTimeline, &b.timeline); err != nil {
+		return nil, err
+	}
+	if err := readBundleJSON(entries, listed, bundleSettings, &b.settings); err != nil {
+		return nil, err
+	}
+	if err := readBundleJSON(entries, listed, bundleMaps, &b.maps); err != nil {
+		return nil, err
+	}
+
+	if b.timeline.Calendar != nil {
+		if err := b.timeline.Calendar.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid calendar in %s: %v", bundleTimeline, err)
+		}
+	}
+	for _, m := range b.timeline.Manuscripts {
+		if m.ID == "" {
+			return nil, fmt.Errorf("a manuscript in %s has no ID", bundleTimeline)
+		}
+		if _, err := manuscript.Parse(manuscript.Format(m.Format), ""); err != nil {
+			return nil, fmt.Errorf("manuscript %s: %v", m.ID, err)
+		}
+	}
+	return b, nil
+}
+
+// readZipEntry reads an entry, refusing more than limit bytes
+func readZipEntry(entry *zip.File, limit int64) ([]byte, error) {
+	r, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", entry.Name, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", entry.Name, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is too large", entry.Name)
+	}
+	return data, nil
+}
+
+// verifyZipEntry checks an entry's size and checksum against the manifest
+func verifyZipEntry(entry *zip.File, f models.BundleFile) error {
+	r, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", f.Path, err)
+	}
+	defer r.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, io.LimitReader(r, f.Size+1))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", f.Path, err)
+	}
+	if size != f.Size {
+		return fmt.Errorf("%s is %d bytes but the manifest says %d", f.Path, size, f.Size)
+	}
+	if !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), f.SHA256) {
+		return fmt.Errorf("checksum mismatch for %s", f.Path)
+	}
+	return nil
+}
+
+func readBundleJSON(entries map[string]*zip.File, listed map[string]bool, name string, dest interface{}) error {
+	if !listed[name] {
+		return nil
+	}
+	data, err := readZipEntry(entries[name], maxBundleSize)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return nil
+}
+
+// importTimeline writes the bundle's calendar and manuscripts. Replace drops
+// every stored manuscript first; skip-existing keeps a stored calendar and
+// stored manuscripts with the same ID; the other strategies overwrite them.
+func importTimeline(s *importSession, timeline bundleTimelineData) error {
+	keep := s.strategy == strategySkipExisting
+
+	if timeline.Calendar != nil {
+		var stored calendar.Calendar
+		saved, err := loadSetting(s.tx, settingCalendar, &stored)
+		if err != nil {
+			return importFailed("%v", err)
+		}
+		if !saved || !keep {
+			if err := saveSetting(s.tx, settingCalendar, timeline.Calendar); err != nil {
+				return importFailed("%v", err)
+			}
+		}
+	}
+
+	if len(timeline.Manuscripts) == 0 && s.strategy != strategyReplace {
+		return nil
+	}
+	if s.strategy == strategyReplace {
+		if _, err := s.tx.Exec("DELETE FROM manuscripts"); err != nil {
+			return importFailed("Failed to clear manuscripts: %v", err)
+		}
+	}
+
+	// Mentions resolve against the nodes the import just wrote
+	mt, err := loadMentionTerms(s.tx)
+	if err != nil {
+		return importFailed("Failed to load node names: %v", err)
+	}
+	for _, m := range timeline.Manuscripts {
+		var exists bool
+		if err := s.tx.QueryRow("SELECT EXISTS (SELECT 1 FROM manuscripts WHERE id = ?)", m.ID).Scan(&exists); err != nil {
+			return importFailed("Failed to look up manuscript %s: %v", m.ID, err)
+		}
+		if exists {
+			if keep {
+				continue
+			}
+			if _, err := s.tx.Exec("DELETE FROM manuscripts WHERE id = ?", m.ID); err != nil {
+				return importFailed("Failed to replace manuscript %s: %v", m.ID, err)
+			}
+		}
+
+		parsed := &manuscript.Manuscript{Title: m.Title}
+		for _, ch := range m.Chapters {
+			chapter := manuscript.Chapter{Title: ch.Title}
+			for _, sc := range ch.Scenes {
+				chapter.Scenes = append(chapter.Scenes, manuscript.Scene{Title: sc.Title, POV: sc.POV, Location: sc.Location, Text: sc.Text})
+			}
+			parsed.Chapters = append(parsed.Chapters, chapter)
+		}
+		title := m.Title
+		if title == "" {
+			title = "Untitled manuscript"
+		}
+		createdAt := m.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = s.now
+		}
+		if _, err := s.tx.Exec(`
+			INSERT INTO manuscripts (id, title, format, content_hash, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, m.ID, title, m.Format, m.Revision, createdAt, s.now); err != nil {
+			return importFailed("Failed to create manuscript %s: %v", m.ID, err)
+		}
+		_, warnings, err := storeManuscriptContent(s.tx, m.ID, parsed, mt, m.Revision)
+		if err != nil {
+			return importFailed("%v", err)
+		}
+		s.response.Warnings = append(s.response.Warnings, warnings...)
+		s.response.ManuscriptsCreated++
+	}
+	return nil
+}
+
+// importSettings writes the bundle's settings; skip-existing keeps stored ones
+func importSettings(s *importSession, settings map[string]json.RawMessage) error {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if bundleExcludedSettings[key] {
+			s.warn("Setting %s is not imported from bundles", key)
+			continue
+		}
+		if s.strategy == strategySkipExisting {
+			var exists bool
+			if err := s.tx.QueryRow("SELECT EXISTS (SELECT 1 FROM settings WHERE key = ?)", key).Scan(&exists); err != nil {
+				return importFailed("Failed to look up setting %s: %v", key, err)
+			}
+			if exists {
+				continue
+			}
+		}
+		if err := saveSetting(s.tx, key, settings[key]); err != nil {
+			return importFailed("%v", err)
+		}
+	}
+	return nil
+}
+
+// stageAssets extracts the bundle's assets into a hidden directory inside the
+// asset directory, so they can be moved into place once the import commits
+func stageAssets(assets map[string]*zip.File) (string, error) {
+	if err := os.MkdirAll(assetDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create asset directory: %v", err)
+	}
+	staging, err := os.MkdirTemp(assetDir, ".bundle-")
+	if err != nil {
+		return "", fmt.Errorf("failed to stage assets: %v", err)
+	}
+	for rel, entry := range assets {
+		if err := extractAsset(entry, filepath.Join(staging, filepath.FromSlash(rel))); err != nil {
+			os.RemoveAll(staging)
+			return "", err
+		}
+	}
+	return staging, nil
+}
+
+func extractAsset(entry *zip.File, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("failed to stage %s: %v", entry.Name, err)
+	}
+	r, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", entry.Name, err)
+	}
+	defer r.Close()
+	w, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to stage %s: %v", entry.Name, err)
+	}
+	if _, err := io.Copy(w, io.LimitReader(r, int64(entry.UncompressedSize64))); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to stage %s: %v", entry.Name, err)
+	}
+	return w.Close()
+}
+
+// placeAssets moves staged assets into the asset directory. With
+// skip-existing, files already there are kept.
+func placeAssets(staging string, assets map[string]*zip.File, response *ImportResponse, keep bool) {
+	paths := make([]string, 0, len(assets))
+	for rel := range assets {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	for _, rel := range paths {
+		dest := filepath.Join(assetDir, filepath.FromSlash(rel))
+		if keep {
+			if _, err := os.Stat(dest); err == nil {
+				continue
+			}
+		}
+		err := os.MkdirAll(filepath.Dir(dest), 0o755)
+		if err == nil {
+			err = os.Rename(filepath.Join(staging, filepath.FromSlash(rel)), dest)
+		}
+		if err != nil {
+			response.Warnings = append(response.Warnings, fmt.Sprintf("Asset %s could not be written: %v", rel, err))
+			continue
+		}
+		response.AssetsWritten++
+	}
+}
+
+// ImportBundle imports a .mythsmith bundle uploaded as the "file" form field.
+// An encrypted bundle needs the "passphrase" field. The passphrase, the
+// manifest version and every checksum are verified before anything is
+// written. Nodes and edges go through the regular import with the "strategy"
+// and "fieldPrecedence" fields; the calendar, manuscripts, settings and maps
+// are written in the same transaction, and imported maps are tiled again
+// afterwards. The import batch can be reverted, but only for nodes and edges.
+func (h *ImportHandler) ImportBundle(c *gin.Context) {
+	req, err := bindImportForm(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("missing bundle file: %v", err)})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to open %s: %v", header.Filename, err)})
+		return
+	}
+	defer file.Close()
+
+	// An encrypted bundle is decrypted in memory; a plain one is read in place
+	var content io.ReaderAt = file
+	size := header.Size
+	magic := make([]byte, len(seal.Magic))
+	if n, _ := file.ReadAt(magic, 0); seal.IsSealed(magic[:n]) {
+		data, err := readUpload(c, header, maxBundleSize)
+		if err != nil {
+			writeImportError(c, err)
+			return
+		}
+		content, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	archive, err := zip.NewReader(content, size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is not a bundle: %v", header.Filename, err)})
+		return
+	}
+	bundle, err := readBundle(archive)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Source = header.Filename
+	req.Data = ImportData{Nodes: bundle.nodes, Edges: bundle.edges}
+
+	staging := ""
+	if len(bundle.assets) > 0 {
+		if staging, err = stageAssets(bundle.assets); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer os.RemoveAll(staging)
+	}
+
+	var mapImages map[string]string
+	response, err := h.commit(req, func(s *importSession) error {
+		if err := importTimeline(s, bundle.timeline); err != nil {
+			return err
+		}
+		if err := importSettings(s, bundle.settings); err != nil {
+			return err
+		}
+		var err error
+		mapImages, err = importMaps(s, bundle.maps)
+		return err
+	})
+	if err != nil {
+		writeImportError(c, err)
+		return
+	}
+
+	// Only the images of maps the import wrote are placed, so a kept map
+	// keeps its image and images without a map stay out
+	images := make(map[string]bool, len(mapImages))
+	for _, imagePath := range mapImages {
+		images[imagePath] = true
+	}
+	for rel := range bundle.assets {
+		if strings.HasPrefix(rel, mapImageDir+"/") && !images[rel] {
+			delete(bundle.assets, rel)
+		}
+	}
+	if staging != "" {
+		placeAssets(staging, bundle.assets, response, req.Strategy == strategySkipExisting)
+	}
+	for id := range mapImages {
+		if err := h.tiler.Queue(id); err != nil {
+			response.Warnings = append(response.Warnings, fmt.Sprintf("Tiles for map %s were not queued: %v", id, err))
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
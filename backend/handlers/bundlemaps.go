@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mythsmith-backend/models"
+	"mythsmith-backend/tiles"
+	"strings"
+)
+
+// bundleMapData is the content of maps.json: the rows of each map table by
+// column name
+type bundleMapData map[string][]map[string]interface{}
+
+// bundleMapTables are the map tables a bundle carries, in the order they are
+// imported. label names a row in warnings. parent names the column and table
+// a row belongs to; rows whose parent was not imported are left out with it.
+// nodeColumns hold node IDs, which an import may have remapped. Tile progress
+// is not bundled, since imported maps are tiled again.
+var bundleMapTables = []struct {
+	table        string
+	label        string
+	columns      []string
+	parentColumn string
+	parentTable  string
+	nodeColumns  []string
+}{
+	{"world_maps", "Map", []string{"id", "name", "image_path", "content_type", "width", "height", "created_at", "updated_at",
+		"node_id", "parent_x", "parent_y", "parent_width", "parent_height", "pixels_per_unit", "scale_unit"},
+		"", "", []string{"node_id"}},
+	{"map_layers", "Layer", []string{"id", "map_id", "name", "color", "hidden", "sort_order", "created_at", "updated_at"},
+		"map_id", "world_maps", nil},
+	{"map_shapes", "Shape", []string{"id", "layer_id", "name", "points", "color", "created_at", "updated_at"},
+		"layer_id", "map_layers", nil},
+	{"map_pins", "Pin", []string{"id", "map_id", "node_id", "x", "y", "icon", "label", "created_at", "updated_at", "child_map_id", "layer_id"},
+		"map_id", "world_maps", []string{"node_id"}},
+	{"map_routes", "Route", []string{"id", "map_id", "from_pin_id", "to_pin_id", "name", "points", "terrain", "speed_modifier", "toll", "danger", "created_at", "updated_at"},
+		"map_id", "world_maps", nil},
+	{"map_regions", "Region", []string{"id", "map_id", "node_id", "name", "points", "color", "created_at", "updated_at"},
+		"map_id", "world_maps", []string{"node_id"}},
+}
+
+// exportMaps returns every map with its layers, shapes, pins, routes and
+// regions. A map's parent travels separately in parent_id, since a parent
+// may be stored after its children.
+func exportMaps(q queryer) (bundleMapData, error) {
+	data := make(bundleMapData, len(bundleMapTables))
+	for _, t := range bundleMapTables {
+		columns := t.columns
+		if t.table == "world_maps" {
+			columns = append(columns[:len(columns):len(columns)], "parent_id")
+		}
+		pairs := make([]string, len(columns))
+		for i, column := range columns {
+			pairs[i] = fmt.Sprintf("'%s', %s", column, column)
+		}
+		rows, err := q.Query(fmt.Sprintf("SELECT json_object(%s) FROM %s ORDER BY created_at, id", strings.Join(pairs, ", "), t.table))
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s: %v", t.table, err)
+		}
+		data[t.table] = []map[string]interface{}{}
+		for rows.Next() {
+			var rowJSON string
+			if err := rows.Scan(&rowJSON); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan %s: %v", t.table, err)
+			}
+			row := make(map[string]interface{})
+			if err := json.Unmarshal([]byte(rowJSON), &row); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to read %s: %v", t.table, err)
+			}
+			data[t.table] = append(data[t.table], row)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// storedNodeID returns the ID an imported node was stored under, and whether
+// such a node exists in the transaction
+func (s *importSession) storedNodeID(id string) (string, bool) {
+	if strings.HasPrefix(id, "temp_") {
+		stored, ok := s.tempIDs[id]
+		return stored, ok
+	}
+	if stored, ok := s.nodeIDs[id]; ok {
+		id = stored
+	}
+	return id, s.nodeSet[id]
+}
+
+// importMaps writes the bundle's maps and everything on them, and returns
+// the image path of each map written. Skip-existing and merge keep a stored
+// map with the same ID, along with everything on it; the other strategies
+// update it in place, so fog revealed on it survives. Pins and regions of
+// nodes that were not imported are left out, and so are routes between pins
+// that were.
+func importMaps(s *importSession, data bundleMapData) (map[string]string, error) {
+	images := make(map[string]string)
+	written := make(map[string]map[string]bool, len(bundleMapTables))
+	keep := s.strategy == strategySkipExisting || s.strategy == strategyMerge
+
+	for _, t := range bundleMapTables {
+		written[t.table] = make(map[string]bool)
+		for _, row := range data[t.table] {
+			id, _ := row["id"].(string)
+			if id == "" {
+				s.warn("A row of %s in %s has no ID and was not imported", t.table, bundleMaps)
+				continue
+			}
+			if t.parentTable != "" {
+				if parent, _ := row[t.parentColumn].(string); !written[t.parentTable][parent] {
+					continue
+				}
+			}
+
+			values := make(map[string]interface{}, len(t.columns))
+			for _, column := range t.columns {
+				values[column] = row[column]
+			}
+			skip := false
+			for _, column := range t.nodeColumns {
+				nodeID, _ := values[column].(string)
+				if nodeID == "" {
+					continue
+				}
+				stored, ok := s.storedNodeID(nodeID)
+				switch {
+				case ok:
+					values[column] = stored
+				case t.table == "world_maps":
+					s.warn("Map %s shows node %s, which was not imported", id, nodeID)
+					values[column] = nil
+				default:
+					s.warn("%s %s was not imported because node %s was not", t.label, id, nodeID)
+					skip = true
+				}
+			}
+			if skip {
+				continue
+			}
+
+			switch t.table {
+			case "world_maps":
+				imagePath, _ := values["image_path"].(string)
+				if !strings.HasPrefix(imagePath, mapImageDir+"/") || !bundleFileAllowed(bundleAssetsDir+imagePath) {
+					s.warn("Map %s has an invalid image path and was not imported", id)
+					continue
+				}
+				var exists bool
+				if err := s.tx.QueryRow("SELECT EXISTS (SELECT 1 FROM world_maps WHERE id = ?)", id).Scan(&exists); err != nil {
+					return nil, importFailed("Failed to look up map %s: %v", id, err)
+				}
+				if exists && keep {
+					continue
+				}
+				width, _ := values["width"].(float64)
+				height, _ := values["height"].(float64)
+				values["tile_status"] = models.TileStatusPending
+				values["tiles_done"] = 0
+				values["tiles_total"] = tiles.Count(int(width), int(height))
+				values["tile_max_zoom"] = tiles.MaxZoom(int(width), int(height))
+				values["tile_error"] = ""
+				images[id] = imagePath
+			case "map_routes":
+				from, _ := values["from_pin_id"].(string)
+				to, _ := values["to_pin_id"].(string)
+				if !written["map_pins"][from] || !written["map_pins"][to] {
+					s.warn("Route %s was not imported because one of its pins was not", id)
+					continue
+				}
+			case "map_pins":
+				// A pin may open a map or sit on a layer that was not imported
+				if childMap, _ := values["child_map_id"].(string); childMap != "" && !written["world_maps"][childMap] {
+					values["child_map_id"] = nil
+				}
+				if layer, _ := values["layer_id"].(string); layer != "" && !written["map_layers"][layer] {
+					values["layer_id"] = nil
+				}
+			}
+
+			if err := upsertBundleRow(s, t.table, id, values); err != nil {
+				s.warn("%s %s was not imported: %v", t.label, id, err)
+				continue
+			}
+			written[t.table][id] = true
+		}
+	}
+
+	// Parents are linked once every map exists
+	for _, row := range data["world_maps"] {
+		id, _ := row["id"].(string)
+		if !written["world_maps"][id] {
+			continue
+		}
+		var parent interface{}
+		if parentID, _ := row["parent_id"].(string); parentID != "" {
+			var exists bool
+			if err := s.tx.QueryRow("SELECT EXISTS (SELECT 1 FROM world_maps WHERE id = ?)", parentID).Scan(&exists); err != nil {
+				return nil, importFailed("Failed to look up map %s: %v", parentID, err)
+			}
+			if exists {
+				parent = parentID
+			} else {
+				s.warn("Map %s lost its parent map %s, which was not imported", id, parentID)
+			}
+		}
+		if _, err := s.tx.Exec("UPDATE world_maps SET parent_id = ? WHERE id = ?", parent, id); err != nil {
+			return nil, importFailed("Failed to link map %s to its parent: %v", id, err)
+		}
+	}
+
+	for id := range written["world_maps"] {
+		if err := syncRouteEdges(s.tx, "r.map_id = ?", id); err != nil {
+			return nil, importFailed("%v", err)
+		}
+	}
+	s.response.MapsImported = len(written["world_maps"])
+	return images, nil
+}
+
+// upsertBundleRow inserts a row, or updates the stored row with its ID
+func upsertBundleRow(s *importSession, table, id string, values map[string]interface{}) error {
+	columns := []string{"id"}
+	args := []interface{}{id}
+	var assignments []string
+	for column, value := range values {
+		if column == "id" {
+			continue
+		}
+		columns = append(columns, column)
+		args = append(args, value)
+		assignments = append(assignments, column+" = excluded."+column)
+	}
+	_, err := s.tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (?%s) ON CONFLICT(id) DO UPDATE SET %s",
+		table, strings.Join(columns, ", "), strings.Repeat(", ?", len(columns)-1), strings.Join(assignments, ", ")), args...)
+	return err
+}
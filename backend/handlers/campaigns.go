@@ -0,0 +1,519 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"mythsmith-backend/database"
+	"mythsmith-backend/geom"
+	"mythsmith-backend/models"
+	"mythsmith-backend/tiles"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Colour of unrevealed parts of player tiles
+var fogColor = color.NRGBA{R: 0x1a, G: 0x1a, B: 0x1a, A: 0xff}
+
+// Opacity of layer shapes drawn on player tiles, and their colour when
+// neither the shape nor its layer has one
+const shapeAlpha = 0x60
+
+var defaultShapeColor = color.NRGBA{R: 0xc0, G: 0x39, B: 0x2b}
+
+// Spacing in map pixels of the points checked along a shape's outline
+const revealSampleStep = 4.0
+
+type CampaignHandler struct {
+	db *database.DB
+}
+
+func NewCampaignHandler(db *database.DB) *CampaignHandler {
+	return &CampaignHandler{db: db}
+}
+
+const campaignColumns = `id, name, COALESCE(description, ''), created_at, updated_at`
+
+func scanCampaign(row rowScanner) (models.Campaign, error) {
+	var campaign models.Campaign
+	err := row.Scan(&campaign.ID, &campaign.Name, &campaign.Description, &campaign.CreatedAt, &campaign.UpdatedAt)
+	return campaign, err
+}
+
+// loadCampaign responds with 404 and returns false when the campaign does not exist
+func (h *CampaignHandler) loadCampaign(c *gin.Context, id string) (models.Campaign, bool) {
+	campaign, err := scanCampaign(h.db.QueryRow("SELECT "+campaignColumns+" FROM campaigns WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return campaign, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve campaign"})
+		return campaign, false
+	}
+	return campaign, true
+}
+
+// loadCampaignMap loads the campaign and map named in the path, responding
+// with 404 when either does not exist
+func (h *CampaignHandler) loadCampaignMap(c *gin.Context) (models.WorldMap, bool) {
+	if _, ok := h.loadCampaign(c, c.Param("id")); !ok {
+		return models.WorldMap{}, false
+	}
+	m, err := findWorldMap(h.db, c.Param("mapId"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "World map not found"})
+		return m, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve world map"})
+		return m, false
+	}
+	return m, true
+}
+
+func (h *CampaignHandler) GetCampaigns(c *gin.Context) {
+	rows, err := h.db.Query("SELECT " + campaignColumns + " FROM campaigns ORDER BY created_at, id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve campaigns"})
+		return
+	}
+	defer rows.Close()
+
+	campaigns := []models.Campaign{}
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan campaign data"})
+			return
+		}
+		campaigns = append(campaigns, campaign)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"campaigns": campaigns,
+		"count":     len(campaigns),
+	})
+}
+
+func (h *CampaignHandler) GetCampaign(c *gin.Context) {
+	campaign, ok := h.loadCampaign(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, campaign)
+}
+
+func (h *CampaignHandler) CreateCampaign(c *gin.Context) {
+	var req models.CampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must not be blank"})
+		return
+	}
+
+	now := time.Now()
+	campaign := models.Campaign{
+		ID:          uuid.NewString(),
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	_, err := h.db.Exec("INSERT INTO campaigns (id, name, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		campaign.ID, campaign.Name, campaign.Description, now, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create campaign"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, campaign)
+}
+
+func (h *CampaignHandler) UpdateCampaign(c *gin.Context) {
+	id := c.Param("id")
+	var req models.CampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must not be blank"})
+		return
+	}
+
+	result, err := h.db.Exec("UPDATE campaigns SET name = ?, description = ?, updated_at = ? WHERE id = ?",
+		req.Name, req.Description, time.Now(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update campaign"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+
+	campaign, ok := h.loadCampaign(c, id)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, campaign)
+}
+
+// DeleteCampaign deletes a campaign with its fog of war
+func (h *CampaignHandler) DeleteCampaign(c *gin.Context) {
+	result, err := h.db.Exec("DELETE FROM campaigns WHERE id = ?", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete campaign"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Campaign deleted successfully"})
+}
+
+// loadReveals reads the polygons a campaign has revealed on a map
+func loadReveals(q queryer, campaignID, mapID string) ([]models.FogReveal, error) {
+	rows, err := q.Query(`
+		SELECT id, campaign_id, map_id, points, created_at FROM fog_reveals
+		WHERE campaign_id = ? AND map_id = ? ORDER BY created_at, id
+	`, campaignID, mapID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fog reveals: %v", err)
+	}
+	defer rows.Close()
+
+	reveals := []models.FogReveal{}
+	for rows.Next() {
+		var reveal models.FogReveal
+		var pointsJSON string
+		if err := rows.Scan(&reveal.ID, &reveal.CampaignID, &reveal.MapID, &pointsJSON, &reveal.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan fog reveal: %v", err)
+		}
+		reveal.Points = []models.MapPosition{}
+		json.Unmarshal([]byte(pointsJSON), &reveal.Points)
+		reveals = append(reveals, reveal)
+	}
+	return reveals, rows.Err()
+}
+
+// GetFog lists the polygons the campaign has revealed on the map
+func (h *CampaignHandler) GetFog(c *gin.Context) {
+	if _, ok := h.loadCampaignMap(c); !ok {
+		return
+	}
+	reveals, err := loadReveals(h.db, c.Param("id"), c.Param("mapId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve fog of war"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reveals": reveals,
+		"count":   len(reveals),
+	})
+}
+
+// RevealFog reveals a polygon of the map to the campaign's players
+func (h *CampaignHandler) RevealFog(c *gin.Context) {
+	var req models.FogRevealRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m, ok := h.loadCampaignMap(c)
+	if !ok || !validatePolygon(c, m, req.Points) {
+		return
+	}
+	pointsJSON, err := json.Marshal(req.Points)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal reveal points"})
+		return
+	}
+
+	reveal := models.FogReveal{
+		ID:         uuid.NewString(),
+		CampaignID: c.Param("id"),
+		MapID:      m.ID,
+		Points:     req.Points,
+		CreatedAt:  time.Now(),
+	}
+	_, err = h.db.Exec("INSERT INTO fog_reveals (id, campaign_id, map_id, points, created_at) VALUES (?, ?, ?, ?, ?)",
+		reveal.ID, reveal.CampaignID, reveal.MapID, string(pointsJSON), reveal.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reveal fog of war"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, reveal)
+}
+
+// DeleteReveal hides a revealed polygon again
+func (h *CampaignHandler) DeleteReveal(c *gin.Context) {
+	result, err := h.db.Exec("DELETE FROM fog_reveals WHERE id = ? AND campaign_id = ? AND map_id = ?",
+		c.Param("revealId"), c.Param("id"), c.Param("mapId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete reveal"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reveal not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reveal deleted successfully"})
+}
+
+// ResetFog hides the whole map from the campaign again
+func (h *CampaignHandler) ResetFog(c *gin.Context) {
+	if _, ok := h.loadCampaignMap(c); !ok {
+		return
+	}
+	if _, err := h.db.Exec("DELETE FROM fog_reveals WHERE campaign_id = ? AND map_id = ?", c.Param("id"), c.Param("mapId")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset fog of war"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Fog of war reset successfully"})
+}
+
+// playerScene is everything players may see of a map: the revealed polygons
+// and the layers that are not hidden, with their shapes
+type playerScene struct {
+	reveals []geom.Polygon
+	layers  []models.MapLayer
+	shapes  map[string][]models.MapShape
+}
+
+func loadPlayerScene(q queryer, campaignID, mapID string) (*playerScene, error) {
+	reveals, err := loadReveals(q, campaignID, mapID)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := loadLayers(q, mapID)
+	if err != nil {
+		return nil, err
+	}
+
+	scene := &playerScene{shapes: make(map[string][]models.MapShape)}
+	for _, reveal := range reveals {
+		scene.reveals = append(scene.reveals, toPolygon(reveal.Points))
+	}
+	for _, layer := range layers {
+		if layer.Hidden {
+			continue
+		}
+		shapes, err := loadShapes(q, layer.ID)
+		if err != nil {
+			return nil, err
+		}
+		scene.layers = append(scene.layers, layer)
+		scene.shapes[layer.ID] = shapes
+	}
+	return scene, nil
+}
+
+// revealed reports whether a point lies in a revealed polygon
+func (s *playerScene) revealed(p geom.Point) bool {
+	for _, poly := range s.reveals {
+		if poly.Contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// outlineRevealed reports whether a shape's whole outline is revealed,
+// checking points along each edge
+func (s *playerScene) outlineRevealed(poly geom.Polygon) bool {
+	for i := range poly {
+		a, b := poly[i], poly[(i+1)%len(poly)]
+		steps := int(math.Ceil(math.Hypot(b.X-a.X, b.Y-a.Y) / revealSampleStep))
+		for k := 0; k <= steps; k++ {
+			t := 0.0
+			if steps > 0 {
+				t = float64(k) / float64(steps)
+			}
+			if !s.revealed(geom.Point{X: a.X + (b.X-a.X)*t, Y: a.Y + (b.Y-a.Y)*t}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// GetPlayerView returns what the campaign's players may see of a map. Shapes
+// are included only when their whole outline is revealed, and pins only when
+// they lie in a revealed region; shapes and pins on hidden layers never are.
+// Partly revealed shapes show on the player tiles, clipped to the fog.
+func (h *CampaignHandler) GetPlayerView(c *gin.Context) {
+	m, ok := h.loadCampaignMap(c)
+	if !ok {
+		return
+	}
+	scene, err := loadPlayerScene(h.db, c.Param("id"), m.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load player view"})
+		return
+	}
+
+	view := models.PlayerMapView{
+		ID:       m.ID,
+		Name:     m.Name,
+		Width:    m.Width,
+		Height:   m.Height,
+		MaxZoom:  m.Tiles.MaxZoom,
+		TileSize: tiles.Size,
+		Revealed: [][]models.MapPosition{},
+		Layers:   []models.PlayerLayer{},
+		Pins:     []models.PlayerPin{},
+	}
+	for _, poly := range scene.reveals {
+		points := make([]models.MapPosition, len(poly))
+		for i, p := range poly {
+			points[i] = models.MapPosition{X: p.X, Y: p.Y}
+		}
+		view.Revealed = append(view.Revealed, points)
+	}
+	for _, layer := range scene.layers {
+		pl := models.PlayerLayer{ID: layer.ID, Name: layer.Name, Color: layer.Color, Shapes: []models.PlayerShape{}}
+		for _, shape := range scene.shapes[layer.ID] {
+			if scene.outlineRevealed(toPolygon(shape.Points)) {
+				pl.Shapes = append(pl.Shapes, models.PlayerShape{ID: shape.ID, Name: shape.Name, Points: shape.Points, Color: shape.Color})
+			}
+		}
+		view.Layers = append(view.Layers, pl)
+	}
+
+	rows, err := h.db.Query(`
+		SELECT p.id, COALESCE(p.layer_id, ''), n.type, COALESCE(NULLIF(p.label, ''), n.name), COALESCE(p.icon, ''), p.x, p.y
+		FROM map_pins p
+		JOIN nodes n ON n.id = p.node_id
+		LEFT JOIN map_layers l ON l.id = p.layer_id
+		WHERE p.map_id = ? AND (p.layer_id IS NULL OR l.hidden = 0)
+		ORDER BY p.created_at, p.id
+	`, m.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pins"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pin models.PlayerPin
+		if err := rows.Scan(&pin.ID, &pin.LayerID, &pin.NodeType, &pin.Label, &pin.Icon, &pin.X, &pin.Y); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan pin data"})
+			return
+		}
+		if scene.revealed(geom.Point{X: pin.X, Y: pin.Y}) {
+			view.Pins = append(view.Pins, pin)
+		}
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+// parseColor reads "#rrggbb", falling back to def
+func parseColor(s string, def color.NRGBA) color.NRGBA {
+	if !colorPattern.MatchString(s) {
+		return def
+	}
+	v, _ := strconv.ParseUint(s[1:], 16, 32)
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
+
+// GetPlayerTile serves a map tile as the campaign's players see it: shapes
+// of visible layers drawn over the map, and everything outside the revealed
+// regions covered by fog. Tiles change as the fog lifts, so they are
+// revalidated on every use.
+func (h *CampaignHandler) GetPlayerTile(c *gin.Context) {
+	var coords [3]int
+	for i, value := range []string{c.Param("z"), c.Param("x"), strings.TrimSuffix(c.Param("y"), ".png")} {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tile coordinates must be non-negative integers"})
+			return
+		}
+		coords[i] = n
+	}
+	z, x, y := coords[0], coords[1], coords[2]
+
+	m, ok := h.loadCampaignMap(c)
+	if !ok {
+		return
+	}
+	if m.Tiles.Status != models.TileStatusDone || z > m.Tiles.MaxZoom {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tile not found"})
+		return
+	}
+	data, err := os.ReadFile(tiles.Path(filepath.Join(tileDir, m.ID), z, x, y))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tile not found"})
+		return
+	}
+	base, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode tile"})
+		return
+	}
+	scene, err := loadPlayerScene(h.db, c.Param("id"), m.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load player view"})
+		return
+	}
+
+	// Map pixels to tile pixels at this zoom level
+	scale := math.Ldexp(1, z-m.Tiles.MaxZoom)
+	dx, dy := -float64(x*tiles.Size), -float64(y*tiles.Size)
+	rect := image.Rect(0, 0, tiles.Size, tiles.Size)
+
+	tile := image.NewNRGBA(rect)
+	draw.Draw(tile, rect, base, image.Point{}, draw.Src)
+	for _, layer := range scene.layers {
+		layerColor := parseColor(layer.Color, defaultShapeColor)
+		for _, shape := range scene.shapes[layer.ID] {
+			fill := parseColor(shape.Color, layerColor)
+			fill.A = shapeAlpha
+			mask := image.NewAlpha(rect)
+			geom.Fill(mask, toPolygon(shape.Points).Transform(scale, dx, dy), 0xff)
+			draw.DrawMask(tile, rect, image.NewUniform(fill), image.Point{}, mask, image.Point{}, draw.Over)
+		}
+	}
+
+	visible := image.NewAlpha(rect)
+	for _, poly := range scene.reveals {
+		geom.Fill(visible, poly.Transform(scale, dx, dy), 0xff)
+	}
+	out := image.NewNRGBA(rect)
+	draw.Draw(out, rect, image.NewUniform(fogColor), image.Point{}, draw.Src)
+	draw.DrawMask(out, rect, tile, image.Point{}, visible, image.Point{}, draw.Over)
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&buf, out); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode tile"})
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "image/png", buf.Bytes())
+}
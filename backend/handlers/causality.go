@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"mythsmith-backend/database"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CausalityHandler struct {
+	db *database.DB
+}
+
+func NewCausalityHandler(db *database.DB) *CausalityHandler {
+	return &CausalityHandler{db: db}
+}
+
+// GetCauses returns every event that transitively led to the given event
+func (h *CausalityHandler) GetCauses(c *gin.Context) {
+	h.walk(c, "causes", func(g *causalGraph) map[string][]string { return g.causes })
+}
+
+// GetConsequences returns every event that transitively follows from the given event
+func (h *CausalityHandler) GetConsequences(c *gin.Context) {
+	h.walk(c, "consequences", func(g *causalGraph) map[string][]string { return g.effects })
+}
+
+func (h *CausalityHandler) walk(c *gin.Context, key string, adjacency func(*causalGraph) map[string][]string) {
+	id := c.Param("id")
+
+	g, err := loadCausalGraph(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load causality graph"})
+		return
+	}
+
+	if _, ok := g.events[id]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+
+	events := g.walk(id, adjacency(g))
+	c.JSON(http.StatusOK, gin.H{
+		"event": g.events[id],
+		key:     events,
+		"count": len(events),
+	})
+}
+
+// GetOrder returns all events in a causally consistent order, for building a
+// chronological outline when exact dates are missing
+func (h *CausalityHandler) GetOrder(c *gin.Context) {
+	g, err := loadCausalGraph(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load causality graph"})
+		return
+	}
+
+	ordered, err := g.order()
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+			"cycle": g.findCycle(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": ordered,
+		"count":  len(ordered),
+	})
+}
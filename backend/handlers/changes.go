@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mythsmith-backend/database"
+	"mythsmith-backend/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ChangeHandler struct {
+	db *database.DB
+}
+
+func NewChangeHandler(db *database.DB) *ChangeHandler {
+	return &ChangeHandler{db: db}
+}
+
+// recordChange appends an entry to the change feed
+func recordChange(e execer, entity, entityID, action, summary string, details interface{}) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal change details: %v", err)
+	}
+	_, err = e.Exec(`
+		INSERT INTO changes (entity, entity_id, action, summary, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, entity, entityID, action, summary, string(detailsJSON), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record change: %v", err)
+	}
+	return nil
+}
+
+// GetChanges returns changes after the ?since= cursor, oldest first. Clients
+// poll with the last ID they have seen.
+func (h *ChangeHandler) GetChanges(c *gin.Context) {
+	since, _ := strconv.ParseInt(c.DefaultQuery("since", "0"), 10, 64)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	query := "SELECT id, entity, entity_id, action, summary, details, created_at FROM changes WHERE id > ?"
+	args := []interface{}{since}
+	if entity := c.Query("entity"); entity != "" {
+		query += " AND entity = ?"
+		args = append(args, entity)
+	}
+	query += " ORDER BY id LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve changes"})
+		return
+	}
+	defer rows.Close()
+
+	changes := []models.Change{}
+	cursor := since
+	for rows.Next() {
+		var change models.Change
+		var detailsJSON string
+		if err := rows.Scan(&change.ID, &change.Entity, &change.EntityID, &change.Action,
+			&change.Summary, &detailsJSON, &change.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan change data"})
+			return
+		}
+		json.Unmarshal([]byte(detailsJSON), &change.Details)
+		changes = append(changes, change)
+		cursor = change.ID
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"changes": changes,
+		"count":   len(changes),
+		"cursor":  cursor,
+	})
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"mythsmith-backend/resolver"
+	"mythsmith-backend/tabular"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CSVColumn maps a spreadsheet column to a node or edge property
+type CSVColumn struct {
+	Column    string       `json:"column"`
+	Property  string       `json:"property,omitempty"` // Defaults to the column name
+	As        tabular.Kind `json:"as,omitempty"`       // text, number, list, date or bool
+	Separator string       `json:"separator,omitempty"`
+	Format    string       `json:"format,omitempty"`
+}
+
+// CSVNodeMapping says which node fields the columns of the nodes file hold.
+// Fields left empty default to a column of the same name, if there is one.
+type CSVNodeMapping struct {
+	ID          string            `json:"id,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Type        string            `json:"type,omitempty"`
+	Description string            `json:"description,omitempty"`
+	DefaultType string            `json:"defaultType,omitempty"`
+	Types       map[string]string `json:"types,omitempty"` // Cell value -> node type, e.g. "NPC" -> "character"
+	Properties  []CSVColumn       `json:"properties,omitempty"`
+}
+
+// CSVEdgeMapping says which edge fields the columns of the edges file hold
+type CSVEdgeMapping struct {
+	ID                  string      `json:"id,omitempty"`
+	Source              string      `json:"source,omitempty"`
+	Target              string      `json:"target,omitempty"`
+	Relationship        string      `json:"relationship,omitempty"`
+	DefaultRelationship string      `json:"defaultRelationship,omitempty"`
+	MatchBy             string      `json:"matchBy,omitempty"` // "name" (default) or "id"
+	Properties          []CSVColumn `json:"properties,omitempty"`
+}
+
+type CSVMapping struct {
+	Nodes CSVNodeMapping `json:"nodes"`
+	Edges CSVEdgeMapping `json:"edges"`
+}
+
+// csvFile is an uploaded spreadsheet
+type csvFile struct {
+	name  string
+	table *tabular.Table
+}
+
+func readCSVFile(header *multipart.FileHeader) (*csvFile, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", header.Filename, err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", header.Filename, err)
+	}
+	table, err := tabular.Read(content, tabular.DelimiterFor(header.Filename, content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", header.Filename, err)
+	}
+	return &csvFile{name: header.Filename, table: table}, nil
+}
+
+// column finds the column for a mapped field. An explicit column must exist;
+// an unmapped field falls back to a column named like it, or -1.
+func (f *csvFile) column(mapped, fallback string) (int, error) {
+	if mapped == "" {
+		return f.table.Column(fallback), nil
+	}
+	i := f.table.Column(mapped)
+	if i < 0 {
+		return -1, fmt.Errorf("%s has no column %q", f.name, mapped)
+	}
+	return i, nil
+}
+
+// csvProperty is a property column ready to read
+type csvProperty struct {
+	index    int
+	header   string
+	property string
+	coercion tabular.Coercion
+}
+
+func (f *csvFile) propertyColumns(columns []CSVColumn) ([]csvProperty, error) {
+	properties := make([]csvProperty, 0, len(columns))
+	for _, column := range columns {
+		i, err := f.column(column.Column, "")
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("property mapping in %s is missing its column", f.name)
+		}
+		if !tabular.ValidKind(column.As) {
+			return nil, fmt.Errorf("column %q: unknown type %q", column.Column, column.As)
+		}
+		property := column.Property
+		if property == "" {
+			property = f.table.Header[i]
+		}
+		properties = append(properties, csvProperty{
+			index:    i,
+			header:   f.table.Header[i],
+			property: property,
+			coercion: tabular.Coercion{Kind: column.As, Separator: column.Separator, Format: column.Format},
+		})
+	}
+	return properties, nil
+}
+
+// readProperties coerces a row's property cells, keeping the text of cells
+// that do not convert
+func (f *csvFile) readProperties(row []string, line int, columns []csvProperty, warnings *[]string) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for _, column := range columns {
+		cell := f.table.Cell(row, column.index)
+		if cell == "" {
+			continue
+		}
+		value, err := tabular.Coerce(cell, column.coercion)
+		if err != nil {
+			*warnings = append(*warnings, fmt.Sprintf("%s row %d, column %s: %v; kept as text", f.name, line, column.header, err))
+			value = cell
+		}
+		properties[column.property] = value
+	}
+	return properties
+}
+
+// unmappedWarning names the columns of a file that nothing reads
+func (f *csvFile) unmappedWarning(used map[int]bool) string {
+	var unmapped []string
+	for i, header := range f.table.Header {
+		if !used[i] && header != "" {
+			unmapped = append(unmapped, header)
+		}
+	}
+	if len(unmapped) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s: columns not mapped and ignored: %s", f.name, strings.Join(unmapped, ", "))
+}
+
+// csvNodes converts the rows of a nodes file. Rows without an ID column
+// value get the ID of the stored node with the same name when the strategy
+// updates existing records, so the same roster can be imported again.
+func csvNodes(f *csvFile, mapping CSVNodeMapping, strategy string, names *resolver.Index, warnings *[]string) ([]ImportNode, error) {
+	idColumn, err := f.column(mapping.ID, "id")
+	if err != nil {
+		return nil, err
+	}
+	nameColumn, err := f.column(mapping.Name, "name")
+	if err != nil {
+		return nil, err
+	}
+	if nameColumn < 0 {
+		return nil, fmt.Errorf("%s has no name column; map one with nodes.name", f.name)
+	}
+	typeColumn, err := f.column(mapping.Type, "type")
+	if err != nil {
+		return nil, err
+	}
+	descriptionColumn, err := f.column(mapping.Description, "description")
+	if err != nil {
+		return nil, err
+	}
+	properties, err := f.propertyColumns(mapping.Properties)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[int]bool{idColumn: true, nameColumn: true, typeColumn: true, descriptionColumn: true}
+	for _, p := range properties {
+		used[p.index] = true
+	}
+	if w := f.unmappedWarning(used); w != "" {
+		*warnings = append(*warnings, w)
+	}
+
+	defaultType := mapping.DefaultType
+	if defaultType == "" {
+		defaultType = "character"
+	}
+
+	nodes := make([]ImportNode, 0, len(f.table.Rows))
+	for i, row := range f.table.Rows {
+		line := i + 1 // Data rows, counting from 1
+		name := f.table.Cell(row, nameColumn)
+		if name == "" {
+			*warnings = append(*warnings, fmt.Sprintf("%s row %d has no name, skipping", f.name, line))
+			continue
+		}
+
+		nodeType := f.table.Cell(row, typeColumn)
+		if mapped, ok := mapping.Types[nodeType]; ok {
+			nodeType = mapped
+		}
+		if nodeType == "" {
+			nodeType = defaultType
+		}
+
+		id := f.table.Cell(row, idColumn)
+		if id == "" && matchesExisting(strategy) {
+			id = names.Lookup(name)
+		}
+		if id == "" {
+			id = uuid.NewString()
+		}
+
+		node := ImportNode{ID: id}
+		node.Data = ImportNodeData{
+			ID:          id,
+			Name:        name,
+			Type:        strings.ToLower(nodeType),
+			Description: f.table.Cell(row, descriptionColumn),
+			Properties:  f.readProperties(row, line, properties, warnings),
+		}
+		node.Position.X, node.Position.Y = gridPosition(len(nodes))
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// csvEdges converts the rows of an edges file. Endpoints given by name are
+// looked up among the imported nodes first, then among stored nodes.
+func csvEdges(f *csvFile, mapping CSVEdgeMapping, nodes []ImportNode, names *resolver.Index, warnings *[]string) ([]map[string]interface{}, error) {
+	matchBy := mapping.MatchBy
+	if matchBy == "" {
+		matchBy = "name"
+	}
+	if matchBy != "name" && matchBy != "id" {
+		return nil, fmt.Errorf("edges.matchBy must be \"name\" or \"id\"")
+	}
+
+	idColumn, err := f.column(mapping.ID, "id")
+	if err != nil {
+		return nil, err
+	}
+	sourceColumn, err := f.column(mapping.Source, "source")
+	if err != nil {
+		return nil, err
+	}
+	targetColumn, err := f.column(mapping.Target, "target")
+	if err != nil {
+		return nil, err
+	}
+	if sourceColumn < 0 || targetColumn < 0 {
+		return nil, fmt.Errorf("%s needs source and target columns; map them with edges.source and edges.target", f.name)
+	}
+	relationshipColumn, err := f.column(mapping.Relationship, "relationship")
+	if err != nil {
+		return nil, err
+	}
+	properties, err := f.propertyColumns(mapping.Properties)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[int]bool{idColumn: true, sourceColumn: true, targetColumn: true, relationshipColumn: true}
+	for _, p := range properties {
+		used[p.index] = true
+	}
+	if w := f.unmappedWarning(used); w != "" {
+		*warnings = append(*warnings, w)
+	}
+
+	imported := resolver.NewIndex()
+	for _, node := range nodes {
+		imported.Add(resolver.Entry{NodeID: node.ID, NodeName: node.Data.Name, NodeType: node.Data.Type,
+			Text: node.Data.Name, Kind: resolver.EntryName})
+	}
+	endpoint := func(text string, line int) string {
+		if matchBy == "id" {
+			return text
+		}
+		if id := imported.Lookup(text); id != "" {
+			return id
+		}
+		if id := names.Lookup(text); id != "" {
+			return id
+		}
+		*warnings = append(*warnings, fmt.Sprintf("%s row %d: no node named %q", f.name, line, text))
+		return ""
+	}
+
+	relationship := mapping.DefaultRelationship
+	if relationship == "" {
+		relationship = "custom"
+	}
+
+	edges := make([]map[string]interface{}, 0, len(f.table.Rows))
+	for i, row := range f.table.Rows {
+		line := i + 1
+		sourceText, targetText := f.table.Cell(row, sourceColumn), f.table.Cell(row, targetColumn)
+		if sourceText == "" || targetText == "" {
+			*warnings = append(*warnings, fmt.Sprintf("%s row %d is missing a source or target, skipping", f.name, line))
+			continue
+		}
+		source, target := endpoint(sourceText, line), endpoint(targetText, line)
+		if source == "" || target == "" {
+			continue
+		}
+
+		data := f.readProperties(row, line, properties, warnings)
+		data["type"] = relationship
+		if r := f.table.Cell(row, relationshipColumn); r != "" {
+			data["type"] = r
+		}
+		edge := map[string]interface{}{"source": source, "target": target, "data": data}
+		if id := f.table.Cell(row, idColumn); id != "" {
+			edge["id"] = id
+		}
+		edges = append(edges, edge)
+	}
+	return edges, nil
+}
+
+// readCSVRequest turns the uploaded spreadsheets and their mapping into an
+// import request
+func (h *ImportHandler) readCSVRequest(c *gin.Context) (ImportRequest, error) {
+	req, err := bindImportForm(c)
+	if err != nil {
+		return req, err
+	}
+
+	var mapping CSVMapping
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return req, fmt.Errorf("invalid mapping: %v", err)
+		}
+	}
+
+	var files []*csvFile
+	for _, field := range []string{"nodes", "edges"} {
+		header, err := c.FormFile(field)
+		if err == http.ErrMissingFile {
+			files = append(files, nil)
+			continue
+		}
+		if err != nil {
+			return req, fmt.Errorf("failed to read %s file: %v", field, err)
+		}
+		f, err := readCSVFile(header)
+		if err != nil {
+			return req, err
+		}
+		files = append(files, f)
+	}
+	nodesFile, edgesFile := files[0], files[1]
+	if nodesFile == nil && edgesFile == nil {
+		return req, fmt.Errorf("upload a nodes file, an edges file or both")
+	}
+
+	names, err := loadResolver(h.db)
+	if err != nil {
+		return req, fmt.Errorf("failed to load existing names: %v", err)
+	}
+
+	var sources []string
+	if nodesFile != nil {
+		sources = append(sources, nodesFile.name)
+		if req.Data.Nodes, err = csvNodes(nodesFile, mapping.Nodes, req.Strategy, names, &req.Warnings); err != nil {
+			return req, err
+		}
+	}
+	if edgesFile != nil {
+		sources = append(sources, edgesFile.name)
+		if req.Data.Edges, err = csvEdges(edgesFile, mapping.Edges, req.Data.Nodes, names, &req.Warnings); err != nil {
+			return req, err
+		}
+	}
+	req.Source = strings.Join(sources, ", ")
+	return req, nil
+}
+
+// ImportCSV imports nodes and edges from CSV or TSV files uploaded as the
+// "nodes" and "edges" form fields. The "mapping" field holds a CSVMapping
+// JSON object; "strategy", "fieldPrecedence" and ?dryRun=true work as they
+// do for ImportMap.
+func (h *ImportHandler) ImportCSV(c *gin.Context) {
+	req, err := h.readCSVRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Data.Nodes) == 0 && len(req.Data.Edges) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No data to import", "warnings": req.Warnings})
+		return
+	}
+
+	if c.Query("dryRun") == "true" {
+		h.previewImport(c, req)
+		return
+	}
+	h.commitImport(c, req)
+}
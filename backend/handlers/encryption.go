@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"mythsmith-backend/models"
+	"mythsmith-backend/seal"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Exports are encrypted when the request carries a passphrase in this header.
+// Uploads may send it as the "passphrase" form field instead.
+const passphraseHeader = "X-MythSmith-Passphrase"
+
+// Largest JSON export read by ImportFile
+const maxExportFile = 256 << 20
+
+func requestPassphrase(c *gin.Context) string {
+	if passphrase := c.PostForm("passphrase"); passphrase != "" {
+		return passphrase
+	}
+	return c.GetHeader(passphraseHeader)
+}
+
+// unseal decrypts an uploaded file that was exported with a passphrase and
+// returns any other file unchanged. A missing or wrong passphrase is a 401
+// with "encrypted" set, so the client knows to ask for one.
+func unseal(c *gin.Context, name string, data []byte) ([]byte, error) {
+	if !seal.IsSealed(data) {
+		return data, nil
+	}
+	plaintext, err := seal.Open(data, requestPassphrase(c))
+	switch err {
+	case nil:
+		return plaintext, nil
+	case seal.ErrNoPassphrase, seal.ErrWrongPassphrase:
+		return nil, &importError{status: http.StatusUnauthorized, body: gin.H{
+			"error":     fmt.Sprintf("%s: %v", name, err),
+			"encrypted": true,
+		}}
+	}
+	return nil, &importError{status: http.StatusBadRequest, body: gin.H{"error": fmt.Sprintf("%s: %v", name, err)}}
+}
+
+// readUpload reads an uploaded file, decrypting it if it is sealed
+func readUpload(c *gin.Context, header *multipart.FileHeader, limit int64) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, importRejected("failed to open %s: %v", header.Filename, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		return nil, importRejected("failed to read %s: %v", header.Filename, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, importRejected("%s is too large to import", header.Filename)
+	}
+	return unseal(c, header.Filename, data)
+}
+
+// sendExport responds with an export as a download, sealed with the
+// request's passphrase if it has one
+func sendExport(c *gin.Context, filename, contentType string, data []byte) {
+	if passphrase := c.GetHeader(passphraseHeader); passphrase != "" {
+		sealed, err := seal.Seal(data, passphrase)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to encrypt export: %v", err)})
+			return
+		}
+		data, contentType = sealed, "application/octet-stream"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ExportJSON downloads the world as the JSON export the frontend writes,
+// encrypted when a passphrase is sent in the X-MythSmith-Passphrase header
+func (h *ImportHandler) ExportJSON(c *gin.Context) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	nodes, err := loadNodes(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load nodes"})
+		return
+	}
+	edges, err := exportEdges(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load edges"})
+		return
+	}
+
+	now := time.Now()
+	export := models.ImportData{
+		Version:    "1.0",
+		ExportDate: now.UTC().Format(time.RFC3339),
+		Metadata:   models.ImportMetadata{NodeCount: len(nodes), EdgeCount: len(edges)},
+		Nodes:      make([]models.ReactFlowNode, 0, len(nodes)),
+		Edges:      edges,
+	}
+	for i := range nodes {
+		export.Nodes = append(export.Nodes, nodes[i].ToReactFlowNode())
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal export"})
+		return
+	}
+
+	filename := fmt.Sprintf("graph-export-%s.json", now.Format("2006-01-02"))
+	if c.GetHeader(passphraseHeader) != "" {
+		filename += ".sealed"
+	}
+	sendExport(c, filename, "application/json", data)
+}
+
+// ImportFile imports a JSON export, uploaded as the "file" form field. An
+// encrypted export needs the "passphrase" field; a missing or wrong one fails
+// with 401 before anything is written. "strategy", "fieldPrecedence" and
+// ?dryRun=true work as they do for ImportMap.
+func (h *ImportHandler) ImportFile(c *gin.Context) {
+	req, err := bindImportForm(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("missing export file: %v", err)})
+		return
+	}
+	data, err := readUpload(c, header, maxExportFile)
+	if err != nil {
+		writeImportError(c, err)
+		return
+	}
+
+	var export models.MapData
+	if err := json.Unmarshal(data, &export); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is not a JSON export: %v", header.Filename, err)})
+		return
+	}
+	if len(export.Nodes) == 0 && len(export.Edges) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No data to import"})
+		return
+	}
+
+	// Exported nodes carry their properties flattened into data
+	basicFields := map[string]bool{
+		"id": true, "name": true, "type": true, "description": true, "connectionDirection": true,
+	}
+	for _, n := range export.Nodes {
+		node := ImportNode{ID: n.ID}
+		node.Position.X, node.Position.Y = n.Position.X, n.Position.Y
+		node.Data.ID = n.ID
+		node.Data.Name, _ = n.Data["name"].(string)
+		node.Data.Type, _ = n.Data["type"].(string)
+		node.Data.Description, _ = n.Data["description"].(string)
+		node.Data.ConnectionDirection, _ = n.Data["connectionDirection"].(string)
+		node.Data.Properties = make(map[string]interface{})
+		for key, value := range n.Data {
+			if !basicFields[key] {
+				node.Data.Properties[key] = value
+			}
+		}
+		req.Data.Nodes = append(req.Data.Nodes, node)
+	}
+	req.Data.Edges = export.Edges
+	req.Source = header.Filename
+
+	if c.Query("dryRun") == "true" {
+		h.previewImport(c, req)
+		return
+	}
+	h.commitImport(c, req)
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mythsmith-backend/models"
+	"sort"
+)
+
+// queryer is satisfied by both *database.DB and *sql.Tx so graph helpers can
+// run inside or outside a transaction
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// loadNodes reads every node with its parsed properties
+func loadNodes(q queryer) ([]models.Node, error) {
+	rows, err := q.Query(`
+        SELECT id, name, type, description, x, y, connection_direction,
+               COALESCE(properties, '{}') as properties, created_at, updated_at
+        FROM nodes
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query nodes: %v", err)
+	}
+	defer rows.Close()
+
+	var nodes []models.Node
+	for rows.Next() {
+		var node models.Node
+		var propertiesJSON string
+		if err := rows.Scan(
+			&node.ID, &node.Name, &node.Type, &node.Description,
+			&node.X, &node.Y, &node.ConnectionDirection, &propertiesJSON,
+			&node.CreatedAt, &node.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan node: %v", err)
+		}
+		if err := json.Unmarshal([]byte(propertiesJSON), &node.Properties); err != nil || node.Properties == nil {
+			node.Properties = make(models.ExtendedProperties)
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, rows.Err()
+}
+
+// loadNode reads one node with its parsed properties
+func loadNode(q queryer, id string) (models.Node, error) {
+	var node models.Node
+	var propertiesJSON string
+	err := q.QueryRow(`
+        SELECT id, name, type, description, x, y, connection_direction,
+               COALESCE(properties, '{}') as properties, created_at, updated_at
+        FROM nodes
+        WHERE id = ?
+    `, id).Scan(
+		&node.ID, &node.Name, &node.Type, &node.Description,
+		&node.X, &node.Y, &node.ConnectionDirection, &propertiesJSON,
+		&node.CreatedAt, &node.UpdatedAt,
+	)
+	if err != nil {
+		return node, err
+	}
+	if err := json.Unmarshal([]byte(propertiesJSON), &node.Properties); err != nil || node.Properties == nil {
+		node.Properties = make(models.ExtendedProperties)
+	}
+	return node, nil
+}
+
+// loadEdges reads every edge with its parsed properties
+func loadEdges(q queryer) ([]models.Edge, error) {
+	rows, err := q.Query(`
+        SELECT id, source_node_id, target_node_id, COALESCE(source_handle, ''),
+               COALESCE(target_handle, ''), COALESCE(relationship, ''),
+               COALESCE(properties, '{}') as properties
+        FROM edges
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query edges: %v", err)
+	}
+	defer rows.Close()
+
+	var edges []models.Edge
+	for rows.Next() {
+		var edge models.Edge
+		var propertiesJSON string
+		if err := rows.Scan(&edge.ID, &edge.SourceNodeID, &edge.TargetNodeID,
+			&edge.SourceHandle, &edge.TargetHandle, &edge.Relationship, &propertiesJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan edge: %v", err)
+		}
+		if err := json.Unmarshal([]byte(propertiesJSON), &edge.Properties); err != nil || edge.Properties == nil {
+			edge.Properties = make(map[string]interface{})
+		}
+		edges = append(edges, edge)
+	}
+
+	return edges, rows.Err()
+}
+
+// causalGraph holds the cause/effect adjacency between event nodes
+type causalGraph struct {
+	events  map[string]models.CausalEvent
+	effects map[string][]string // cause -> events it causes
+	causes  map[string][]string // effect -> events that caused it
+}
+
+// loadCausalGraph reads every event node and every causal edge between events
+func loadCausalGraph(q queryer) (*causalGraph, error) {
+	g := &causalGraph{
+		events:  make(map[string]models.CausalEvent),
+		effects: make(map[string][]string),
+		causes:  make(map[string][]string),
+	}
+
+	rows, err := q.Query("SELECT id, name, COALESCE(properties, '{}') FROM nodes WHERE type = ?", models.NodeTypeEvent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.CausalEvent
+		var propertiesJSON string
+		if err := rows.Scan(&event.ID, &event.Name, &propertiesJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %v", err)
+		}
+		props := make(map[string]interface{})
+		json.Unmarshal([]byte(propertiesJSON), &props)
+		event.Date, _ = props["date"].(string)
+		g.events[event.ID] = event
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	edgeRows, err := q.Query(
+		"SELECT source_node_id, target_node_id, relationship FROM edges WHERE relationship IN (?, ?)",
+		models.RelationshipCauses, models.RelationshipCausedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query causal edges: %v", err)
+	}
+	defer edgeRows.Close()
+
+	for edgeRows.Next() {
+		var source, target, relationship string
+		if err := edgeRows.Scan(&source, &target, &relationship); err != nil {
+			return nil, fmt.Errorf("failed to scan causal edge: %v", err)
+		}
+		cause, effect := source, target
+		if relationship == models.RelationshipCausedBy {
+			cause, effect = target, source
+		}
+		// Causality only applies between events
+		if _, ok := g.events[cause]; !ok {
+			continue
+		}
+		if _, ok := g.events[effect]; !ok {
+			continue
+		}
+		g.effects[cause] = append(g.effects[cause], effect)
+		g.causes[effect] = append(g.causes[effect], cause)
+	}
+
+	return g, edgeRows.Err()
+}
+
+// walk does a breadth-first traversal from start over the given adjacency and
+// returns every reachable event with its distance from start
+func (g *causalGraph) walk(start string, adjacency map[string][]string) []models.CausalEvent {
+	visited := map[string]bool{start: true}
+	queue := []models.CausalEvent{g.events[start]}
+	var result []models.CausalEvent
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		next := append([]string(nil), adjacency[current.ID]...)
+		sort.Strings(next)
+		for _, id := range next {
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+			event := g.events[id]
+			event.Depth = current.Depth + 1
+			event.Via = current.ID
+			result = append(result, event)
+			queue = append(queue, event)
+		}
+	}
+
+	return result
+}
+
+// findCycle returns the event IDs forming a causal cycle, or nil if the graph
+// is acyclic. The first ID is repeated at the end to close the loop.
+func (g *causalGraph) findCycle() []string {
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+	state := make(map[string]int)
+	var stack []string
+
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		state[id] = inProgress
+		stack = append(stack, id)
+		for _, next := range g.effects[id] {
+			switch state[next] {
+			case inProgress:
+				for i, onStack := range stack {
+					if onStack == next {
+						return append(append([]string(nil), stack[i:]...), next)
+					}
+				}
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+		return nil
+	}
+
+	ids := make([]string, 0, len(g.events))
+	for id := range g.events {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if state[id] == unvisited {
+			if cycle := visit(id); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// order returns the events in a topological order. Depth is the length of the
+// longest causal chain leading to the event, so events sharing a depth can be
+// read as happening "around the same time".
+func (g *causalGraph) order() ([]models.CausalEvent, error) {
+	inDegree := make(map[string]int, len(g.events))
+	for id := range g.events {
+		inDegree[id] = len(g.causes[id])
+	}
+
+	var ready []string
+	for id, degree := range inDegree {
+		if degree == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	depth := make(map[string]int, len(g.events))
+	var ordered []models.CausalEvent
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+
+		event := g.events[id]
+		event.Depth = depth[id]
+		ordered = append(ordered, event)
+
+		for _, next := range g.effects[id] {
+			if depth[id]+1 > depth[next] {
+				depth[next] = depth[id] + 1
+			}
+			inDegree[next]--
+			if inDegree[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+
+	if len(ordered) != len(g.events) {
+		return nil, fmt.Errorf("causal graph contains a cycle")
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.Depth != b.Depth {
+			return a.Depth < b.Depth
+		}
+		if a.Date != b.Date {
+			// Dated events come before undated ones within a depth
+			if a.Date == "" || b.Date == "" {
+				return b.Date == ""
+			}
+			return a.Date < b.Date
+		}
+		return a.Name < b.Name
+	})
+
+	return ordered, nil
+}
+
+// checkCausalCycles loads the causal graph and returns the first cycle found
+func checkCausalCycles(q queryer) ([]string, error) {
+	g, err := loadCausalGraph(q)
+	if err != nil {
+		return nil, err
+	}
+	return g.findCycle(), nil
+}
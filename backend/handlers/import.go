@@ -5,19 +5,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"mythsmith-backend/database"
+	"mythsmith-backend/resolver"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type ImportHandler struct {
-	db *database.DB
+	db    *database.DB
+	tiler *TileGenerator // Tiles the maps a bundle brings
 }
 
-func NewImportHandler(db *database.DB) *ImportHandler {
-	return &ImportHandler{db: db}
+func NewImportHandler(db *database.DB, tiler *TileGenerator) *ImportHandler {
+	return &ImportHandler{db: db, tiler: tiler}
 }
 
 // Define the import data structures based on your actual JSON
@@ -46,45 +49,206 @@ type ImportData struct {
 
 type ImportRequest struct {
 	Strategy string     `json:"strategy"`
+	Source   string     `json:"source,omitempty"` // Filename, recorded on the import batch
 	Data     ImportData `json:"data"`
+	// Field -> "import" or "existing" for the overwrite-fields strategy.
+	// Fields are name, type, description, position, connectionDirection,
+	// relationship or a property key; "*" sets the default.
+	FieldPrecedence map[string]string `json:"fieldPrecedence,omitempty"`
+	// Problems found while converting another format into this request,
+	// reported along with the import's own warnings
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 type ImportResponse struct {
-	Message      string   `json:"message"`
-	NodesCreated int      `json:"nodesCreated"`
-	EdgesCreated int      `json:"edgesCreated"`
-	Conflicts    []string `json:"conflicts,omitempty"`
-	Warnings     []string `json:"warnings,omitempty"`
+	Message        string `json:"message"`
+	BatchID        string `json:"batchId,omitempty"`
+	NodesCreated   int    `json:"nodesCreated"`
+	EdgesCreated   int    `json:"edgesCreated"`
+	NodesUpdated   int    `json:"nodesUpdated,omitempty"`
+	NodesUnchanged int    `json:"nodesUnchanged,omitempty"`
+	NodesSkipped   int    `json:"nodesSkipped,omitempty"`
+	EdgesUpdated   int    `json:"edgesUpdated,omitempty"`
+	EdgesUnchanged int    `json:"edgesUnchanged,omitempty"`
+	EdgesSkipped   int    `json:"edgesSkipped,omitempty"`
+	// Written by bundle imports along with the graph
+	ManuscriptsCreated int      `json:"manuscriptsCreated,omitempty"`
+	AssetsWritten      int      `json:"assetsWritten,omitempty"`
+	MapsImported       int      `json:"mapsImported,omitempty"`
+	Conflicts          []string `json:"conflicts,omitempty"`
+	Warnings           []string `json:"warnings,omitempty"`
 }
 
-func (h *ImportHandler) ImportMap(c *gin.Context) {
+// importSession carries the state of one import through its transaction
+type importSession struct {
+	tx       *sql.Tx
+	strategy string
+	now      time.Time // Fixed per session so generated IDs can be reproduced
+	response *ImportResponse
+	batchID  string // Stored on every node and edge the import creates
+
+	nodeSet       map[string]bool // Every node ID in the transaction, for edge endpoint checks
+	storedNodeIDs map[string]bool // IDs stored before a merge, which imported IDs must not clash with
+	storedEdgeIDs map[string]bool
+	names         *resolver.Index // Stored names, for duplicate warnings in merge mode
+	edgeIndex     int             // Edges seen so far, numbering generated edge IDs
+	insertNode    *sql.Stmt
+	insertEdge    *sql.Stmt
+
+	nodesDeleted, edgesDeleted int64 // Rows cleared by replace
+
+	fieldPrecedence map[string]string
+	existingNodes   *existingRecords // Loaded for strategies that match existing records
+	existingEdges   *existingRecords
+
+	nodeIDs      map[string]string // Imported node ID -> stored ID, where they differ
+	tempIDs      map[string]string // Frontend temp_ ID -> stored node ID
+	edgeIDs      map[string]string // Imported edge ID -> stored ID, where they differ
+	skippedEdges []string
+}
+
+func newImportSession(tx *sql.Tx, strategy string, now time.Time) *importSession {
+	return &importSession{
+		tx:       tx,
+		strategy: strategy,
+		now:      now,
+		response: &ImportResponse{Conflicts: []string{}, Warnings: []string{}},
+		batchID:  uuid.NewString(),
+		nodeIDs:  make(map[string]string),
+		tempIDs:  make(map[string]string),
+		edgeIDs:  make(map[string]string),
+	}
+}
+
+func (s *importSession) warn(format string, args ...interface{}) {
+	s.response.Warnings = append(s.response.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (s *importSession) conflict(format string, args ...interface{}) {
+	s.response.Conflicts = append(s.response.Conflicts, fmt.Sprintf(format, args...))
+}
+
+// skipEdge records an edge that will not be imported
+func (s *importSession) skipEdge(edgeID, format string, args ...interface{}) {
+	s.skippedEdges = append(s.skippedEdges, edgeID)
+	s.warn(format, args...)
+}
+
+// importError is a failed import with the status and body to respond with
+type importError struct {
+	status int
+	body   gin.H
+}
+
+func (e *importError) Error() string {
+	return fmt.Sprint(e.body["error"])
+}
+
+func importFailed(format string, args ...interface{}) *importError {
+	return &importError{status: http.StatusInternalServerError, body: gin.H{"error": fmt.Sprintf(format, args...)}}
+}
+
+func writeImportError(c *gin.Context, err error) {
+	if ie, ok := err.(*importError); ok {
+		c.JSON(ie.status, ie.body)
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// bindImportRequest reads and validates the request and defaults the strategy
+func bindImportRequest(c *gin.Context) (ImportRequest, bool) {
 	var req ImportRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request format: %v", err)})
-		return
+		return req, false
 	}
 
 	// Validate request data
 	if len(req.Data.Nodes) == 0 && len(req.Data.Edges) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No data to import"})
-		return
+		return req, false
 	}
 
+	if err := normalizeImportOptions(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, false
+	}
+	return req, true
+}
+
+// bindImportForm reads the import options of a multipart upload: the
+// "strategy" field and the "fieldPrecedence" field as a JSON object
+func bindImportForm(c *gin.Context) (ImportRequest, error) {
+	req := ImportRequest{Strategy: c.PostForm("strategy")}
+	if raw := c.PostForm("fieldPrecedence"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &req.FieldPrecedence); err != nil {
+			return req, fmt.Errorf("invalid fieldPrecedence: %v", err)
+		}
+	}
+	return req, normalizeImportOptions(&req)
+}
+
+// Grid that imported nodes without a position are laid out on
+const (
+	importGridColumns = 10
+	importGridSpacing = 200.0
+)
+
+// gridPosition places the n-th such node
+func gridPosition(n int) (x, y float64) {
+	return float64(n%importGridColumns) * importGridSpacing, float64(n/importGridColumns) * importGridSpacing
+}
+
+// normalizeImportOptions defaults the strategy and validates field precedence
+func normalizeImportOptions(req *ImportRequest) error {
 	// Validate strategy
-	if req.Strategy != "replace" && req.Strategy != "merge" {
-		req.Strategy = "replace" // Default to replace
+	switch req.Strategy {
+	case strategyReplace, strategyMerge, strategyUpsert, strategySkipExisting, strategyOverwriteFields:
+	default:
+		req.Strategy = strategyReplace // Default to replace
+	}
+
+	for field, precedence := range req.FieldPrecedence {
+		if precedence != precedenceImport && precedence != precedenceExisting {
+			return fmt.Errorf("Precedence for %s must be %q or %q", field, precedenceImport, precedenceExisting)
+		}
+	}
+	return nil
+}
+
+func (h *ImportHandler) ImportMap(c *gin.Context) {
+	req, ok := bindImportRequest(c)
+	if !ok {
+		return
 	}
 
-	response := ImportResponse{
-		Conflicts: []string{},
-		Warnings:  []string{},
+	if c.Query("dryRun") == "true" {
+		h.previewImport(c, req)
+		return
 	}
+	h.commitImport(c, req)
+}
+
+// commitImport runs an import in its own transaction and responds with the result
+func (h *ImportHandler) commitImport(c *gin.Context, req ImportRequest) {
+	response, err := h.commit(req, nil)
+	if err != nil {
+		writeImportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
 
+// commit runs an import in its own transaction and commits it. extra, when
+// set, writes whatever else the import carries in the same transaction, after
+// the nodes and edges.
+func (h *ImportHandler) commit(req ImportRequest, extra func(s *importSession) error) (*ImportResponse, error) {
 	// Start transaction with proper error handling
 	tx, err := h.db.Begin()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
-		return
+		return nil, importFailed("Failed to start transaction")
 	}
 	defer func() {
 		if tx != nil {
@@ -92,57 +256,163 @@ func (h *ImportHandler) ImportMap(c *gin.Context) {
 		}
 	}()
 
-	// Set transaction timeout
-	if _, err := tx.Exec("PRAGMA busy_timeout = 10000"); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set timeout"})
-		return
+	session := newImportSession(tx, req.Strategy, time.Now())
+	session.fieldPrecedence = req.FieldPrecedence
+	if err := h.runImport(session, req); err != nil {
+		return nil, err
 	}
-
-	// Handle replace strategy
-	if req.Strategy == "replace" {
-		if err := h.clearExistingData(tx); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to clear existing data: %v", err)})
-			return
+	if extra != nil {
+		if err := extra(session); err != nil {
+			return nil, err
 		}
 	}
 
-	// Get existing nodes for merge conflict detection
-	existingNodes := make(map[string]bool)
-	if req.Strategy == "merge" {
-		existingNodes, err = h.getExistingNodeIDs(tx)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get existing nodes"})
-			return
-		}
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return nil, importFailed("Failed to commit transaction")
 	}
+	tx = nil // Prevent rollback in defer
+
+	runWriteRules(h.db)
+
+	response := session.response
+	response.Message = importMessage(response)
+	return response, nil
+}
 
-	now := time.Now()
-	nodeIdMapping := make(map[string]string)
-	tempIdToNodeId := make(map[string]string)
+func importMessage(response *ImportResponse) string {
+	message := fmt.Sprintf("Import completed successfully: %d nodes, %d edges created",
+		response.NodesCreated, response.EdgesCreated)
+	if updated := response.NodesUpdated + response.EdgesUpdated; updated > 0 {
+		message += fmt.Sprintf(", %d updated", updated)
+	}
+	if skipped := response.NodesSkipped + response.EdgesSkipped; skipped > 0 {
+		message += fmt.Sprintf(", %d skipped", skipped)
+	}
+	return message
+}
+
+// runImport writes the data inside the session's transaction without
+// committing it, so the caller decides whether the result is kept
+func (h *ImportHandler) runImport(s *importSession, req ImportRequest) error {
+	s.response.Warnings = append(s.response.Warnings, req.Warnings...)
+	if err := h.beginImport(s, req.Source); err != nil {
+		return err
+	}
 
 	// Process nodes
-	if err := h.processNodes(tx, req.Data.Nodes, existingNodes, nodeIdMapping, tempIdToNodeId, req.Strategy, now, &response); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to process nodes: %v", err)})
-		return
+	if err := h.processNodes(s, req.Data.Nodes); err != nil {
+		return importFailed("Failed to process nodes: %v", err)
 	}
 
 	// Process edges
-	if err := h.processEdges(tx, req.Data.Edges, nodeIdMapping, tempIdToNodeId, req.Strategy, now, &response); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to process edges: %v", err)})
-		return
+	if err := h.processEdges(s, req.Data.Edges); err != nil {
+		return importFailed("Failed to process edges: %v", err)
 	}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-		return
+	return h.finishImport(s)
+}
+
+// beginImport prepares the session's transaction before any node or edge is
+// written: it records the batch, clears the world for replace and loads what
+// the strategy needs to know about stored records
+func (h *ImportHandler) beginImport(s *importSession, source string) error {
+	// Set transaction timeout
+	if _, err := s.tx.Exec("PRAGMA busy_timeout = 10000"); err != nil {
+		return importFailed("Failed to set timeout")
 	}
-	tx = nil // Prevent rollback in defer
 
-	response.Message = fmt.Sprintf("Import completed successfully: %d nodes, %d edges created",
-		response.NodesCreated, response.EdgesCreated)
+	if err := s.startBatch(source); err != nil {
+		return importFailed("%v", err)
+	}
 
-	c.JSON(http.StatusOK, response)
+	// Handle replace strategy, keeping what it clears so the batch can be reverted
+	if s.strategy == strategyReplace {
+		var err error
+		if err = s.backupDependents(); err != nil {
+			return importFailed("%v", err)
+		}
+		if s.edgesDeleted, err = s.backup("edges", "1 = 1"); err != nil {
+			return importFailed("%v", err)
+		}
+		if s.nodesDeleted, err = s.backup("nodes", "1 = 1"); err != nil {
+			return importFailed("%v", err)
+		}
+		if err := h.clearExistingData(s.tx); err != nil {
+			return importFailed("Failed to clear existing data: %v", err)
+		}
+	}
+
+	var err error
+	if s.nodeSet, err = h.getExistingNodeIDs(s.tx); err != nil {
+		return importFailed("Failed to get existing nodes")
+	}
+
+	// Remember stored IDs for merge conflict detection
+	if s.strategy == strategyMerge {
+		s.storedNodeIDs = make(map[string]bool, len(s.nodeSet))
+		for id := range s.nodeSet {
+			s.storedNodeIDs[id] = true
+		}
+		if s.storedEdgeIDs, err = h.getExistingEdgeIDs(s.tx); err != nil {
+			return importFailed("Failed to get existing edges")
+		}
+		if s.names, err = loadResolver(s.tx); err != nil {
+			return importFailed("Failed to load existing names")
+		}
+	}
+	if matchesExisting(s.strategy) {
+		if s.existingNodes, err = loadExistingRecords(s.tx, "nodes"); err != nil {
+			return importFailed("Failed to get existing nodes: %v", err)
+		}
+		if s.existingEdges, err = loadExistingRecords(s.tx, "edges"); err != nil {
+			return importFailed("Failed to get existing edges: %v", err)
+		}
+	}
+
+	if s.insertNode, err = s.tx.Prepare(`
+        INSERT INTO nodes (id, name, type, description, x, y, connection_direction, properties, created_at, updated_at, import_batch_id)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `); err != nil {
+		return importFailed("Failed to prepare node insert: %v", err)
+	}
+	if s.insertEdge, err = s.tx.Prepare(`
+        INSERT INTO edges (id, source_node_id, target_node_id, source_handle, target_handle, relationship, properties, created_at, import_batch_id)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `); err != nil {
+		return importFailed("Failed to prepare edge insert: %v", err)
+	}
+
+	return nil
+}
+
+// finishImport runs the checks that need the whole import written
+func (h *ImportHandler) finishImport(s *importSession) error {
+	s.insertNode.Close()
+	s.insertEdge.Close()
+
+	if err := s.finishBatch(s.nodesDeleted, s.edgesDeleted); err != nil {
+		return importFailed("%v", err)
+	}
+	s.response.BatchID = s.batchID
+
+	if err := indexAllLinks(s.tx); err != nil {
+		return importFailed("Failed to index links: %v", err)
+	}
+
+	// Reject imports that would make an event (transitively) cause itself
+	cycle, err := checkCausalCycles(s.tx)
+	if err != nil {
+		return importFailed("Failed to check causality: %v", err)
+	}
+	if cycle != nil {
+		return &importError{status: http.StatusConflict, body: gin.H{
+			"error": "Imported edges would create a causal cycle between events",
+			"cycle": cycle,
+		}}
+	}
+
+	return nil
 }
 
 func (h *ImportHandler) clearTable(tx *sql.Tx, tableName string) error {
@@ -193,8 +463,32 @@ func (h *ImportHandler) getExistingNodeIDs(tx *sql.Tx) (map[string]bool, error)
 	return existing, rows.Err()
 }
 
-func (h *ImportHandler) processNodes(tx *sql.Tx, nodes []ImportNode, existingNodes map[string]bool,
-	nodeIdMapping, tempIdToNodeId map[string]string, strategy string, now time.Time, response *ImportResponse) error {
+func (h *ImportHandler) getExistingEdgeIDs(tx *sql.Tx) (map[string]bool, error) {
+	existing := make(map[string]bool)
+
+	rows, err := tx.Query("SELECT id FROM edges")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		existing[id] = true
+	}
+
+	return existing, rows.Err()
+}
+
+// processNodes writes a run of nodes. It may be called repeatedly with
+// consecutive chunks of one import.
+func (h *ImportHandler) processNodes(s *importSession, nodes []ImportNode) error {
+	if s.names != nil {
+		h.warnPossibleDuplicates(s.names, nodes, s.response)
+	}
 
 	for _, importNode := range nodes {
 		nodeId := importNode.ID
@@ -205,26 +499,33 @@ func (h *ImportHandler) processNodes(tx *sql.Tx, nodes []ImportNode, existingNod
 			return fmt.Errorf("node missing ID")
 		}
 
+		// Update or skip the stored node this one corresponds to
+		if s.existingNodes != nil {
+			if storedId := s.existingNodes.match(nodeId); storedId != "" {
+				if err := h.updateExistingNode(s, storedId, importNode); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
 		// Handle ID conflicts in merge mode
-		if strategy == "merge" && existingNodes[nodeId] {
-			nodeId = fmt.Sprintf("%s_imported_%d", originalId, now.Unix())
-			nodeIdMapping[originalId] = nodeId
-			response.Conflicts = append(response.Conflicts,
-				fmt.Sprintf("Node %s renamed to %s due to conflict", originalId, nodeId))
+		if s.strategy == strategyMerge && s.storedNodeIDs[nodeId] {
+			nodeId = fmt.Sprintf("%s_imported_%d", originalId, s.now.Unix())
+			s.nodeIDs[originalId] = nodeId
+			s.conflict("Node %s renamed to %s due to conflict", originalId, nodeId)
 		}
 
 		// Extract and validate node data from the actual JSON structure
 		name := importNode.Data.Name
 		if name == "" {
-			response.Warnings = append(response.Warnings,
-				fmt.Sprintf("Node %s missing name, using ID as name", nodeId))
+			s.warn("Node %s missing name, using ID as name", nodeId)
 			name = nodeId
 		}
 
 		nodeType := importNode.Data.Type
 		if nodeType == "" {
-			response.Warnings = append(response.Warnings,
-				fmt.Sprintf("Node %s missing type, using default 'character'", nodeId))
+			s.warn("Node %s missing type, using default 'character'", nodeId)
 			nodeType = "character"
 		}
 
@@ -250,7 +551,7 @@ func (h *ImportHandler) processNodes(tx *sql.Tx, nodes []ImportNode, existingNod
 
 		// Store tempId mapping if present
 		if tempId, ok := properties["tempId"].(string); ok {
-			tempIdToNodeId[tempId] = nodeId
+			s.tempIDs[tempId] = nodeId
 		}
 
 		propertiesJSON, err := json.Marshal(properties)
@@ -259,53 +560,55 @@ func (h *ImportHandler) processNodes(tx *sql.Tx, nodes []ImportNode, existingNod
 		}
 
 		// Insert node
-		_, err = tx.Exec(`
-            INSERT INTO nodes (id, name, type, description, x, y, connection_direction, properties, created_at, updated_at)
-            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-        `, nodeId, name, nodeType, description,
+		_, err = s.insertNode.Exec(nodeId, name, nodeType, description,
 			importNode.Position.X, importNode.Position.Y, connectionDirection,
-			string(propertiesJSON), now, now)
+			string(propertiesJSON), s.now, s.now, s.batchID)
 
 		if err != nil {
 			return fmt.Errorf("failed to insert node %s: %v", nodeId, err)
 		}
 
-		response.NodesCreated++
+		s.nodeSet[nodeId] = true
+		if s.existingNodes != nil {
+			s.existingNodes.add(nodeId, "", "", "", "")
+		}
+
+		s.response.NodesCreated++
 	}
 
 	return nil
 }
 
-func (h *ImportHandler) processEdges(tx *sql.Tx, edges []map[string]interface{},
-	nodeIdMapping, tempIdToNodeId map[string]string, strategy string, now time.Time, response *ImportResponse) error {
-
-	// Get existing edge IDs for conflict detection in merge mode
-	existingEdges := make(map[string]bool)
-	if strategy == "merge" {
-		rows, err := tx.Query("SELECT id FROM edges")
-		if err != nil {
-			return fmt.Errorf("failed to get existing edges: %v", err)
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var id string
-			if err := rows.Scan(&id); err != nil {
-				return fmt.Errorf("failed to scan edge ID: %v", err)
-			}
-			existingEdges[id] = true
+// warnPossibleDuplicates flags imported nodes whose name resolves to a
+// different node already in the map. They are still imported; merging them
+// is left to the user.
+func (h *ImportHandler) warnPossibleDuplicates(ix *resolver.Index, nodes []ImportNode, response *ImportResponse) {
+	for _, importNode := range nodes {
+		if importNode.Data.Name == "" {
+			continue
 		}
-
-		if err := rows.Err(); err != nil {
-			return fmt.Errorf("error iterating edge rows: %v", err)
+		matches := ix.Resolve(importNode.Data.Name, resolver.Options{Type: importNode.Data.Type, Limit: 1})
+		if len(matches) == 0 || matches[0].NodeID == importNode.ID {
+			continue
 		}
+		m := matches[0]
+		response.Warnings = append(response.Warnings,
+			fmt.Sprintf("Node %s (%s) may duplicate existing node %s (%s, %s match on %q)",
+				importNode.ID, importNode.Data.Name, m.NodeID, m.Name, m.Kind, m.Matched))
 	}
+}
+
+// processEdges writes a run of edges. It may be called repeatedly with
+// consecutive chunks of one import, after all of its nodes.
+func (h *ImportHandler) processEdges(s *importSession, edges []map[string]interface{}) error {
+	for _, edgeMap := range edges {
+		i := s.edgeIndex
+		s.edgeIndex++
 
-	for i, edgeMap := range edges {
 		// Extract or generate edge ID
 		edgeId, hasId := edgeMap["id"].(string)
 		if !hasId || edgeId == "" {
-			edgeId = fmt.Sprintf("edge_%d_%d", now.UnixNano(), i)
+			edgeId = fmt.Sprintf("edge_%d_%d", s.now.UnixNano(), i)
 		}
 
 		originalEdgeId := edgeId
@@ -315,42 +618,39 @@ func (h *ImportHandler) processEdges(tx *sql.Tx, edges []map[string]interface{},
 		target, hasTarget := edgeMap["target"].(string)
 
 		if !hasSource || !hasTarget || source == "" || target == "" {
-			response.Warnings = append(response.Warnings,
-				fmt.Sprintf("Edge %s missing source or target, skipping", edgeId))
+			s.skipEdge(edgeId, "Edge %s missing source or target, skipping", edgeId)
 			continue
 		}
 
 		// Handle source ID mapping
 		if strings.HasPrefix(source, "temp_") {
-			if realId, ok := tempIdToNodeId[source]; ok {
+			if realId, ok := s.tempIDs[source]; ok {
 				source = realId
 			} else {
-				response.Warnings = append(response.Warnings,
-					fmt.Sprintf("Edge %s references non-existent source node %s", edgeId, source))
+				s.skipEdge(edgeId, "Edge %s references non-existent source node %s", edgeId, source)
 				continue
 			}
-		} else if remappedId, ok := nodeIdMapping[source]; ok {
+		} else if remappedId, ok := s.nodeIDs[source]; ok {
 			source = remappedId
 		}
 
 		// Handle target ID mapping
 		if strings.HasPrefix(target, "temp_") {
-			if realId, ok := tempIdToNodeId[target]; ok {
+			if realId, ok := s.tempIDs[target]; ok {
 				target = realId
 			} else {
-				response.Warnings = append(response.Warnings,
-					fmt.Sprintf("Edge %s references non-existent target node %s", edgeId, target))
+				s.skipEdge(edgeId, "Edge %s references non-existent target node %s", edgeId, target)
 				continue
 			}
-		} else if remappedId, ok := nodeIdMapping[target]; ok {
+		} else if remappedId, ok := s.nodeIDs[target]; ok {
 			target = remappedId
 		}
 
 		// Handle edge ID conflicts in merge mode
-		if strategy == "merge" && existingEdges[edgeId] {
-			edgeId = fmt.Sprintf("%s_imported_%d", originalEdgeId, now.Unix())
-			response.Conflicts = append(response.Conflicts,
-				fmt.Sprintf("Edge %s renamed to %s due to conflict", originalEdgeId, edgeId))
+		if s.strategy == strategyMerge && s.storedEdgeIDs[edgeId] {
+			edgeId = fmt.Sprintf("%s_imported_%d", originalEdgeId, s.now.Unix())
+			s.edgeIDs[originalEdgeId] = edgeId
+			s.conflict("Edge %s renamed to %s due to conflict", originalEdgeId, edgeId)
 		}
 
 		// Extract handles
@@ -411,38 +711,46 @@ func (h *ImportHandler) processEdges(tx *sql.Tx, edges []map[string]interface{},
 		}
 
 		// Verify that source and target nodes exist
-		var sourceExists, targetExists bool
-		err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM nodes WHERE id = ?)", source).Scan(&sourceExists)
-		if err != nil {
-			return fmt.Errorf("failed to check source node existence: %v", err)
-		}
-		err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM nodes WHERE id = ?)", target).Scan(&targetExists)
-		if err != nil {
-			return fmt.Errorf("failed to check target node existence: %v", err)
-		}
-
-		if !sourceExists {
-			response.Warnings = append(response.Warnings,
-				fmt.Sprintf("Edge %s references non-existent source node %s, skipping", edgeId, source))
+		if !s.nodeSet[source] {
+			s.skipEdge(edgeId, "Edge %s references non-existent source node %s, skipping", edgeId, source)
 			continue
 		}
-		if !targetExists {
-			response.Warnings = append(response.Warnings,
-				fmt.Sprintf("Edge %s references non-existent target node %s, skipping", edgeId, target))
+		if !s.nodeSet[target] {
+			s.skipEdge(edgeId, "Edge %s references non-existent target node %s, skipping", edgeId, target)
 			continue
 		}
 
+		// Update or skip the stored edge this one corresponds to
+		if s.existingEdges != nil {
+			storedId := ""
+			if hasId {
+				storedId = s.existingEdges.match(originalEdgeId)
+			}
+			if storedId == "" {
+				storedId = s.existingEdges.byKey[edgeKey(source, target, relationship)]
+			}
+			if storedId != "" {
+				edge := importedEdge{id: edgeId, source: source, target: target, sourceHandle: sourceHandle,
+					targetHandle: targetHandle, relationship: relationship, properties: properties}
+				if err := h.updateExistingEdge(s, storedId, edge); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
 		// Insert edge
-		_, err = tx.Exec(`
-            INSERT INTO edges (id, source_node_id, target_node_id, source_handle, target_handle, relationship, properties, created_at)
-            VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-        `, edgeId, source, target, sourceHandle, targetHandle, relationship, string(propertiesJSON), now)
+		_, err = s.insertEdge.Exec(edgeId, source, target, sourceHandle, targetHandle, relationship, string(propertiesJSON), s.now, s.batchID)
 
 		if err != nil {
 			return fmt.Errorf("failed to insert edge %s: %v", edgeId, err)
 		}
 
-		response.EdgesCreated++
+		if s.existingEdges != nil {
+			s.existingEdges.add(edgeId, "", source, target, relationship)
+		}
+
+		s.response.EdgesCreated++
 	}
 
 	return nil
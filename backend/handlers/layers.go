@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mythsmith-backend/geom"
+	"mythsmith-backend/models"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+const mapLayerColumns = `
+    l.id, l.map_id, l.name, COALESCE(l.color, ''), l.hidden, l.sort_order,
+    (SELECT COUNT(*) FROM map_shapes WHERE layer_id = l.id),
+    (SELECT COUNT(*) FROM map_pins WHERE layer_id = l.id),
+    l.created_at, l.updated_at
+`
+
+func scanMapLayer(row rowScanner) (models.MapLayer, error) {
+	var l models.MapLayer
+	err := row.Scan(&l.ID, &l.MapID, &l.Name, &l.Color, &l.Hidden, &l.SortOrder, &l.ShapeCount, &l.PinCount, &l.CreatedAt, &l.UpdatedAt)
+	return l, err
+}
+
+const mapShapeColumns = `
+    s.id, s.layer_id, COALESCE(s.name, ''), s.points, COALESCE(s.color, ''), s.created_at, s.updated_at
+`
+
+func scanMapShape(row rowScanner) (models.MapShape, error) {
+	var s models.MapShape
+	var pointsJSON string
+	err := row.Scan(&s.ID, &s.LayerID, &s.Name, &pointsJSON, &s.Color, &s.CreatedAt, &s.UpdatedAt)
+	s.Points = []models.MapPosition{}
+	json.Unmarshal([]byte(pointsJSON), &s.Points)
+	return s, err
+}
+
+// toPolygon converts map positions to a polygon
+func toPolygon(points []models.MapPosition) geom.Polygon {
+	poly := make(geom.Polygon, len(points))
+	for i, p := range points {
+		poly[i] = geom.Point{X: p.X, Y: p.Y}
+	}
+	return poly
+}
+
+// validatePolygon checks a polygon has at least three points, all on the map
+// image
+func validatePolygon(c *gin.Context, m models.WorldMap, points []models.MapPosition) bool {
+	if len(points) < 3 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A polygon needs at least three points"})
+		return false
+	}
+	for _, p := range points {
+		if p.X < 0 || p.Y < 0 || p.X > float64(m.Width) || p.Y > float64(m.Height) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Polygon points must lie within the %dx%d map image", m.Width, m.Height)})
+			return false
+		}
+	}
+	return true
+}
+
+func validateColor(c *gin.Context, color *string) bool {
+	*color = strings.TrimSpace(*color)
+	if *color != "" && !colorPattern.MatchString(*color) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "color must be written as #rrggbb"})
+		return false
+	}
+	return true
+}
+
+// loadLayers reads a map's layers in drawing order
+func loadLayers(q queryer, mapID string) ([]models.MapLayer, error) {
+	rows, err := q.Query("SELECT "+mapLayerColumns+" FROM map_layers l WHERE l.map_id = ? ORDER BY l.sort_order, l.created_at, l.id", mapID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query layers: %v", err)
+	}
+	defer rows.Close()
+
+	layers := []models.MapLayer{}
+	for rows.Next() {
+		layer, err := scanMapLayer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan layer: %v", err)
+		}
+		layers = append(layers, layer)
+	}
+	return layers, rows.Err()
+}
+
+// loadShapes reads a layer's shapes
+func loadShapes(q queryer, layerID string) ([]models.MapShape, error) {
+	rows, err := q.Query("SELECT "+mapShapeColumns+" FROM map_shapes s WHERE s.layer_id = ? ORDER BY s.created_at, s.id", layerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shapes: %v", err)
+	}
+	defer rows.Close()
+
+	shapes := []models.MapShape{}
+	for rows.Next() {
+		shape, err := scanMapShape(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan shape: %v", err)
+		}
+		shapes = append(shapes, shape)
+	}
+	return shapes, rows.Err()
+}
+
+// loadLayer responds with 404 and returns false when the layer is not on the map
+func (h *WorldMapHandler) loadLayer(c *gin.Context, mapID, layerID string) (models.MapLayer, bool) {
+	layer, err := scanMapLayer(h.db.QueryRow("SELECT "+mapLayerColumns+" FROM map_layers l WHERE l.id = ? AND l.map_id = ?", layerID, mapID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Layer not found"})
+		return layer, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve layer"})
+		return layer, false
+	}
+	return layer, true
+}
+
+func (h *WorldMapHandler) GetLayers(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.loadWorldMap(c, id); !ok {
+		return
+	}
+
+	layers, err := loadLayers(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve layers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"layers": layers,
+		"count":  len(layers),
+	})
+}
+
+func (h *WorldMapHandler) CreateLayer(c *gin.Context) {
+	id := c.Param("id")
+	var req models.MapLayerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must not be blank"})
+		return
+	}
+	if !validateColor(c, &req.Color) {
+		return
+	}
+	if _, ok := h.loadWorldMap(c, id); !ok {
+		return
+	}
+
+	layerID := uuid.NewString()
+	now := time.Now()
+	_, err := h.db.Exec(`
+		INSERT INTO map_layers (id, map_id, name, color, hidden, sort_order, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, layerID, id, req.Name, req.Color, req.Hidden, req.SortOrder, now, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create layer"})
+		return
+	}
+
+	layer, ok := h.loadLayer(c, id, layerID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusCreated, layer)
+}
+
+// UpdateLayer renames, recolours, reorders or hides a layer
+func (h *WorldMapHandler) UpdateLayer(c *gin.Context) {
+	id, layerID := c.Param("id"), c.Param("layerId")
+	var req models.MapLayerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must not be blank"})
+		return
+	}
+	if !validateColor(c, &req.Color) {
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE map_layers SET name = ?, color = ?, hidden = ?, sort_order = ?, updated_at = ?
+		WHERE id = ? AND map_id = ?
+	`, req.Name, req.Color, req.Hidden, req.SortOrder, time.Now(), layerID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update layer"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Layer not found"})
+		return
+	}
+
+	layer, ok := h.loadLayer(c, id, layerID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, layer)
+}
+
+// DeleteLayer deletes a layer with its shapes and pins
+func (h *WorldMapHandler) DeleteLayer(c *gin.Context) {
+	id, layerID := c.Param("id"), c.Param("layerId")
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	err = deleteRouteEdges(tx, `
+		from_pin_id IN (SELECT id FROM map_pins WHERE layer_id = ?) OR to_pin_id IN (SELECT id FROM map_pins WHERE layer_id = ?)
+	`, layerID, layerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := tx.Exec("DELETE FROM map_layers WHERE id = ? AND map_id = ?", layerID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete layer"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Layer not found"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Layer deleted successfully"})
+}
+
+func (h *WorldMapHandler) GetShapes(c *gin.Context) {
+	id, layerID := c.Param("id"), c.Param("layerId")
+	if _, ok := h.loadLayer(c, id, layerID); !ok {
+		return
+	}
+
+	shapes, err := loadShapes(h.db, layerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve shapes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"shapes": shapes,
+		"count":  len(shapes),
+	})
+}
+
+// bindShape reads and checks a shape body for a layer on the map
+func (h *WorldMapHandler) bindShape(c *gin.Context) (models.MapShapeRequest, string, bool) {
+	var req models.MapShapeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, "", false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if !validateColor(c, &req.Color) {
+		return req, "", false
+	}
+	m, ok := h.loadWorldMap(c, c.Param("id"))
+	if !ok {
+		return req, "", false
+	}
+	if _, ok := h.loadLayer(c, m.ID, c.Param("layerId")); !ok {
+		return req, "", false
+	}
+	if !validatePolygon(c, m, req.Points) {
+		return req, "", false
+	}
+	pointsJSON, err := json.Marshal(req.Points)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal shape points"})
+		return req, "", false
+	}
+	return req, string(pointsJSON), true
+}
+
+func (h *WorldMapHandler) loadShape(layerID, shapeID string) (models.MapShape, error) {
+	return scanMapShape(h.db.QueryRow("SELECT "+mapShapeColumns+" FROM map_shapes s WHERE s.id = ? AND s.layer_id = ?", shapeID, layerID))
+}
+
+func (h *WorldMapHandler) CreateShape(c *gin.Context) {
+	req, pointsJSON, ok := h.bindShape(c)
+	if !ok {
+		return
+	}
+	layerID := c.Param("layerId")
+
+	shapeID := uuid.NewString()
+	now := time.Now()
+	_, err := h.db.Exec(`
+		INSERT INTO map_shapes (id, layer_id, name, points, color, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, shapeID, layerID, req.Name, pointsJSON, req.Color, now, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create shape"})
+		return
+	}
+
+	shape, err := h.loadShape(layerID, shapeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve shape"})
+		return
+	}
+	c.JSON(http.StatusCreated, shape)
+}
+
+func (h *WorldMapHandler) UpdateShape(c *gin.Context) {
+	req, pointsJSON, ok := h.bindShape(c)
+	if !ok {
+		return
+	}
+	layerID, shapeID := c.Param("layerId"), c.Param("shapeId")
+
+	result, err := h.db.Exec(`
+		UPDATE map_shapes SET name = ?, points = ?, color = ?, updated_at = ?
+		WHERE id = ? AND layer_id = ?
+	`, req.Name, pointsJSON, req.Color, time.Now(), shapeID, layerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shape"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shape not found"})
+		return
+	}
+
+	shape, err := h.loadShape(layerID, shapeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve shape"})
+		return
+	}
+	c.JSON(http.StatusOK, shape)
+}
+
+func (h *WorldMapHandler) DeleteShape(c *gin.Context) {
+	result, err := h.db.Exec(`
+		DELETE FROM map_shapes WHERE id = ? AND layer_id IN (SELECT id FROM map_layers WHERE id = ? AND map_id = ?)
+	`, c.Param("shapeId"), c.Param("layerId"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete shape"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shape not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shape deleted successfully"})
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"mythsmith-backend/models"
+	"mythsmith-backend/wikilink"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// linkStore is satisfied by both *database.DB and *sql.Tx
+type linkStore interface {
+	queryer
+	execer
+}
+
+// resolveLink maps a link target to a node ID. Targets are tried as IDs first,
+// then as names and aliases.
+func (mt *mentionTerms) resolveLink(target string) string {
+	if mt.Has(target) {
+		return target
+	}
+	return mt.lookup(target)
+}
+
+// indexNodeLinks replaces the stored links written in one node's description
+func indexNodeLinks(s linkStore, mt *mentionTerms, nodeID, description string) error {
+	if _, err := s.Exec("DELETE FROM mentions WHERE source_node_id = ?", nodeID); err != nil {
+		return fmt.Errorf("failed to clear links: %v", err)
+	}
+	for _, link := range wikilink.Parse(description) {
+		_, err := s.Exec(`
+			INSERT INTO mentions (source_node_id, target_node_id, target_text, label, position)
+			VALUES (?, ?, ?, ?, ?)
+		`, nodeID, nullString(mt.resolveLink(link.Target)), link.Target, link.Label, link.Start)
+		if err != nil {
+			return fmt.Errorf("failed to insert link: %v", err)
+		}
+	}
+	return nil
+}
+
+// indexAllLinks rebuilds the links of every node, for bulk writes such as map
+// saves and imports
+func indexAllLinks(s linkStore) error {
+	mt, err := loadMentionTerms(s)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.Query("SELECT id, description FROM nodes")
+	if err != nil {
+		return fmt.Errorf("failed to query nodes: %v", err)
+	}
+	descriptions := make(map[string]string)
+	for rows.Next() {
+		var id string
+		var description sql.NullString
+		if err := rows.Scan(&id, &description); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan node: %v", err)
+		}
+		descriptions[id] = description.String
+	}
+	rows.Close()
+
+	for id, description := range descriptions {
+		if err := indexNodeLinks(s, mt, id, description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveDanglingLinks points links that did not resolve when written at the
+// nodes they name now, e.g. after the node was created or renamed
+func resolveDanglingLinks(s linkStore, mt *mentionTerms) error {
+	rows, err := s.Query("SELECT id, target_text FROM mentions WHERE target_node_id IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to query links: %v", err)
+	}
+	resolved := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var target string
+		if err := rows.Scan(&id, &target); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan link: %v", err)
+		}
+		if nodeID := mt.resolveLink(target); nodeID != "" {
+			resolved[id] = nodeID
+		}
+	}
+	rows.Close()
+
+	for id, nodeID := range resolved {
+		if _, err := s.Exec("UPDATE mentions SET target_node_id = ? WHERE id = ?", nodeID, id); err != nil {
+			return fmt.Errorf("failed to resolve link: %v", err)
+		}
+	}
+	return nil
+}
+
+// resolveNodeLinks resolves the links pointing at one node again, so links
+// written with a name or alias it no longer has stop pointing at it
+func resolveNodeLinks(s linkStore, mt *mentionTerms, nodeID string) error {
+	rows, err := s.Query("SELECT id, target_text FROM mentions WHERE target_node_id = ?", nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to query links: %v", err)
+	}
+	stale := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var target string
+		if err := rows.Scan(&id, &target); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan link: %v", err)
+		}
+		if resolved := mt.resolveLink(target); resolved != nodeID {
+			stale[id] = resolved
+		}
+	}
+	rows.Close()
+
+	for id, resolved := range stale {
+		if _, err := s.Exec("UPDATE mentions SET target_node_id = ? WHERE id = ?", nullString(resolved), id); err != nil {
+			return fmt.Errorf("failed to resolve link: %v", err)
+		}
+	}
+	return nil
+}
+
+// rewriteLinkNames changes [[oldName]] links to a renamed node into
+// [[newName]] in every description that contains them. Links written with the
+// node ID or an alias are left alone. It returns the number of links changed.
+func rewriteLinkNames(s linkStore, mt *mentionTerms, nodeID, oldName, newName string) (int, error) {
+	rows, err := s.Query(`
+		SELECT DISTINCT n.id, n.description
+		FROM mentions m JOIN nodes n ON n.id = m.source_node_id
+		WHERE m.target_node_id = ?
+	`, nodeID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query linking nodes: %v", err)
+	}
+	descriptions := make(map[string]string)
+	for rows.Next() {
+		var id string
+		var description sql.NullString
+		if err := rows.Scan(&id, &description); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan node: %v", err)
+		}
+		descriptions[id] = description.String
+	}
+	rows.Close()
+
+	total := 0
+	for id, description := range descriptions {
+		rewritten, count := wikilink.Rewrite(description, func(link wikilink.Link) (wikilink.Link, bool) {
+			if !strings.EqualFold(link.Target, oldName) {
+				return link, false
+			}
+			link.Target = newName
+			return link, true
+		})
+		if count == 0 {
+			continue
+		}
+		if _, err := s.Exec("UPDATE nodes SET description = ? WHERE id = ?", rewritten, id); err != nil {
+			return total, fmt.Errorf("failed to rewrite description: %v", err)
+		}
+		if err := indexNodeLinks(s, mt, id, rewritten); err != nil {
+			return total, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// refreshNodeLinks updates the link index after a single node was written.
+// Like rule evaluation it runs after the write has been saved, so failures
+// are logged rather than failing the request.
+func refreshNodeLinks(s linkStore, nodeID string, description *string) {
+	mt, err := loadMentionTerms(s)
+	if err == nil && description != nil {
+		err = indexNodeLinks(s, mt, nodeID, *description)
+	}
+	if err == nil {
+		err = resolveDanglingLinks(s, mt)
+	}
+	if err != nil {
+		log.Printf("Failed to index links for node %s: %v", nodeID, err)
+	}
+}
+
+// refreshAliasLinks updates the link index after one of a node's aliases was
+// changed or deleted: links that resolved through the old alias are dropped
+// or pointed elsewhere, and links the new alias names are resolved
+func refreshAliasLinks(s linkStore, nodeID string) {
+	mt, err := loadMentionTerms(s)
+	if err == nil {
+		err = resolveNodeLinks(s, mt, nodeID)
+	}
+	if err == nil {
+		err = resolveDanglingLinks(s, mt)
+	}
+	if err != nil {
+		log.Printf("Failed to index links for node %s: %v", nodeID, err)
+	}
+}
+
+// GetBacklinks lists the nodes whose descriptions link to this one
+func (h *NodeHandler) GetBacklinks(c *gin.Context) {
+	id := c.Param("id")
+	if !h.nodeExists(c, id) {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT n.id, n.name, n.type, m.target_text, m.label, m.position
+		FROM mentions m JOIN nodes n ON n.id = m.source_node_id
+		WHERE m.target_node_id = ?
+		ORDER BY n.name, n.id, m.position
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve backlinks"})
+		return
+	}
+	defer rows.Close()
+
+	backlinks := []models.Backlink{}
+	for rows.Next() {
+		var nodeID, name string
+		var nodeType models.NodeType
+		var link models.WikiLink
+		if err := rows.Scan(&nodeID, &name, &nodeType, &link.Target, &link.Label, &link.Position); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan backlink data"})
+			return
+		}
+		if n := len(backlinks); n == 0 || backlinks[n-1].NodeID != nodeID {
+			backlinks = append(backlinks, models.Backlink{NodeID: nodeID, Name: name, Type: nodeType})
+		}
+		last := &backlinks[len(backlinks)-1]
+		last.Links = append(last.Links, link)
+		last.Count++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"node":      id,
+		"backlinks": backlinks,
+		"count":     len(backlinks),
+	})
+}
@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mythsmith-backend/database"
+	"mythsmith-backend/manuscript"
+	"mythsmith-backend/models"
+	"mythsmith-backend/resolver"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ManuscriptHandler struct {
+	db *database.DB
+}
+
+func NewManuscriptHandler(db *database.DB) *ManuscriptHandler {
+	return &ManuscriptHandler{db: db}
+}
+
+// ManuscriptImportRequest is the JSON form of a manuscript import. The same
+// fields can be sent as multipart form values with the text in a "file" part.
+type ManuscriptImportRequest struct {
+	Title    string `json:"title"`
+	Format   string `json:"format"`
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+}
+
+// mentionTerms pairs the shared name resolver with the terms used to find
+// mentions in manuscript text
+type mentionTerms struct {
+	*resolver.Index
+	terms []manuscript.Term
+}
+
+func loadMentionTerms(q queryer) (*mentionTerms, error) {
+	ix, err := loadResolver(q)
+	if err != nil {
+		return nil, err
+	}
+	mt := &mentionTerms{Index: ix}
+	for _, e := range ix.Entries() {
+		mt.terms = append(mt.terms, manuscript.Term{NodeID: e.NodeID, Text: e.Text})
+	}
+	return mt, nil
+}
+
+// lookup resolves a POV or location name to a node ID
+func (mt *mentionTerms) lookup(name string) string {
+	return mt.Lookup(name)
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// storeManuscriptContent inserts the chapters and scenes of a parsed
+// manuscript and records appearances against the given source revision.
+// Names that could not be resolved to a node are returned as warnings.
+func storeManuscriptContent(tx *sql.Tx, manuscriptID string, parsed *manuscript.Manuscript, mt *mentionTerms, revision string) (int, []string, error) {
+	warnings := []string{}
+	sceneCount := 0
+
+	for chapterIndex, chapter := range parsed.Chapters {
+		chapterID := uuid.NewString()
+		if _, err := tx.Exec("INSERT INTO chapters (id, manuscript_id, ordinal, title) VALUES (?, ?, ?, ?)",
+			chapterID, manuscriptID, chapterIndex+1, chapter.Title); err != nil {
+			return 0, nil, fmt.Errorf("failed to insert chapter: %v", err)
+		}
+
+		for sceneIndex, scene := range chapter.Scenes {
+			sceneWarnings, err := insertScene(tx, manuscriptID, chapterID, sceneIndex+1, scene, mt, revision)
+			if err != nil {
+				return 0, nil, err
+			}
+			warnings = append(warnings, sceneWarnings...)
+			sceneCount++
+		}
+	}
+
+	return sceneCount, warnings, nil
+}
+
+func insertScene(tx *sql.Tx, manuscriptID, chapterID string, ordinal int, scene manuscript.Scene, mt *mentionTerms, revision string) ([]string, error) {
+	sceneID := uuid.NewString()
+	povNodeID, locationNodeID, warnings := resolveSceneMetadata(scene, mt)
+
+	_, err := tx.Exec(`
+		INSERT INTO scenes (id, manuscript_id, chapter_id, ordinal, title, pov_name, pov_node_id,
+		                    location_name, location_node_id, word_count, content, content_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, sceneID, manuscriptID, chapterID, ordinal, scene.Title, scene.POV, nullString(povNodeID),
+		scene.Location, nullString(locationNodeID), scene.WordCount(), scene.Text, contentHash(scene.Text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert scene: %v", err)
+	}
+
+	if err := storeAppearances(tx, sceneID, scene, povNodeID, locationNodeID, mt, revision); err != nil {
+		return nil, err
+	}
+	return warnings, nil
+}
+
+func resolveSceneMetadata(scene manuscript.Scene, mt *mentionTerms) (string, string, []string) {
+	var warnings []string
+	label := scene.Title
+	if label == "" {
+		label = "untitled scene"
+	}
+	povNodeID := mt.lookup(scene.POV)
+	if scene.POV != "" && povNodeID == "" {
+		warnings = append(warnings, fmt.Sprintf("POV %q in %s does not match any node", scene.POV, label))
+	}
+	locationNodeID := mt.lookup(scene.Location)
+	if scene.Location != "" && locationNodeID == "" {
+		warnings = append(warnings, fmt.Sprintf("Location %q in %s does not match any node", scene.Location, label))
+	}
+	return povNodeID, locationNodeID, warnings
+}
+
+// storeAppearances replaces the appearance links of a scene, stamping them
+// with the source revision they were computed from. POV and location nodes
+// appear even when the text never names them.
+func storeAppearances(tx *sql.Tx, sceneID string, scene manuscript.Scene, povNodeID, locationNodeID string, mt *mentionTerms, revision string) error {
+	if _, err := tx.Exec("DELETE FROM appearances WHERE scene_id = ?", sceneID); err != nil {
+		return fmt.Errorf("failed to clear appearances: %v", err)
+	}
+
+	type appearance struct {
+		manuscript.Mention
+		pov, location bool
+	}
+	var ordered []*appearance
+	byNode := make(map[string]*appearance)
+	for _, m := range manuscript.FindMentions(scene.Text, mt.terms) {
+		a := &appearance{Mention: m}
+		byNode[m.NodeID] = a
+		ordered = append(ordered, a)
+	}
+	for _, role := range []struct {
+		nodeID string
+		pov    bool
+	}{{povNodeID, true}, {locationNodeID, false}} {
+		if role.nodeID == "" {
+			continue
+		}
+		a, ok := byNode[role.nodeID]
+		if !ok {
+			a = &appearance{Mention: manuscript.Mention{NodeID: role.nodeID}}
+			byNode[role.nodeID] = a
+			ordered = append(ordered, a)
+		}
+		if role.pov {
+			a.pov = true
+		} else {
+			a.location = true
+		}
+	}
+
+	now := time.Now()
+	for _, a := range ordered {
+		if _, err := tx.Exec(`
+			INSERT INTO appearances (scene_id, node_id, mention_count, first_offset, matched_text,
+			                         is_pov, is_location, source_revision, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, sceneID, a.NodeID, a.Count, a.FirstOffset, a.Matched, a.pov, a.location, revision, now); err != nil {
+			return fmt.Errorf("failed to insert appearance: %v", err)
+		}
+	}
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// readManuscriptRequest accepts either a JSON body or a multipart upload
+func readManuscriptRequest(c *gin.Context) (ManuscriptImportRequest, error) {
+	var req ManuscriptImportRequest
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return req, err
+		}
+		return req, nil
+	}
+
+	req.Title = c.PostForm("title")
+	req.Format = c.PostForm("format")
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return req, fmt.Errorf("missing manuscript file: %v", err)
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return req, fmt.Errorf("failed to open manuscript file: %v", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return req, fmt.Errorf("failed to read manuscript file: %v", err)
+	}
+	req.Filename = fileHeader.Filename
+	req.Content = string(data)
+	return req, nil
+}
+
+// ImportManuscript parses a Markdown or Fountain manuscript into chapters and
+// scenes and links every scene to the nodes it mentions
+func (h *ManuscriptHandler) ImportManuscript(c *gin.Context) {
+	req, err := readManuscriptRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if strings.TrimSpace(req.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Manuscript is empty"})
+		return
+	}
+
+	format := manuscript.Format(req.Format)
+	if format == "" {
+		var ok bool
+		if format, ok = manuscript.FormatForFile(req.Filename); !ok {
+			format = manuscript.FormatMarkdown
+		}
+	}
+
+	parsed, err := manuscript.Parse(format, req.Content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	title := req.Title
+	if title == "" {
+		title = parsed.Title
+	}
+	if title == "" && req.Filename != "" {
+		title = strings.TrimSuffix(filepath.Base(req.Filename), filepath.Ext(req.Filename))
+	}
+	if title == "" {
+		title = "Untitled manuscript"
+	}
+
+	mt, err := loadMentionTerms(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load node names"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	id := uuid.NewString()
+	now := time.Now()
+	revision := contentHash(req.Content)
+	if _, err := tx.Exec(`
+		INSERT INTO manuscripts (id, title, format, content_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, id, title, format, revision, now, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create manuscript"})
+		return
+	}
+
+	sceneCount, warnings, err := storeManuscriptContent(tx, id, parsed, mt, revision)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"manuscript": models.ManuscriptSummary{
+			ID:           id,
+			Title:        title,
+			Format:       string(format),
+			ChapterCount: len(parsed.Chapters),
+			SceneCount:   sceneCount,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		"warnings": warnings,
+	})
+}
+
+const manuscriptSummaryQuery = `
+    SELECT m.id, m.title, m.format, m.source_path,
+           (SELECT COUNT(*) FROM chapters WHERE manuscript_id = m.id),
+           (SELECT COUNT(*) FROM scenes WHERE manuscript_id = m.id),
+           m.created_at, m.updated_at
+    FROM manuscripts m
+`
+
+func scanManuscriptSummary(row rowScanner) (models.ManuscriptSummary, error) {
+	var m models.ManuscriptSummary
+	err := row.Scan(&m.ID, &m.Title, &m.Format, &m.SourcePath, &m.ChapterCount, &m.SceneCount, &m.CreatedAt, &m.UpdatedAt)
+	return m, err
+}
+
+func (h *ManuscriptHandler) GetManuscripts(c *gin.Context) {
+	rows, err := h.db.Query(manuscriptSummaryQuery + " ORDER BY m.title")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve manuscripts"})
+		return
+	}
+	defer rows.Close()
+
+	manuscripts := []models.ManuscriptSummary{}
+	for rows.Next() {
+		m, err := scanManuscriptSummary(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan manuscript data"})
+			return
+		}
+		manuscripts = append(manuscripts, m)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"manuscripts": manuscripts,
+		"count":       len(manuscripts),
+	})
+}
+
+// GetManuscript returns a manuscript's chapters and scenes with the nodes
+// appearing in each scene
+func (h *ManuscriptHandler) GetManuscript(c *gin.Context) {
+	id := c.Param("id")
+
+	summary, err := scanManuscriptSummary(h.db.QueryRow(manuscriptSummaryQuery+" WHERE m.id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Manuscript not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve manuscript"})
+		}
+		return
+	}
+
+	appearing := make(map[string][]models.SceneAppearing)
+	appearanceRows, err := h.db.Query(`
+		SELECT a.scene_id, a.node_id, n.name, a.mention_count
+		FROM appearances a
+		JOIN scenes s ON s.id = a.scene_id
+		JOIN nodes n ON n.id = a.node_id
+		WHERE s.manuscript_id = ?
+		ORDER BY a.first_offset
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appearances"})
+		return
+	}
+	defer appearanceRows.Close()
+	for appearanceRows.Next() {
+		var sceneID string
+		var a models.SceneAppearing
+		if err := appearanceRows.Scan(&sceneID, &a.NodeID, &a.Name, &a.MentionCount); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan appearance data"})
+			return
+		}
+		appearing[sceneID] = append(appearing[sceneID], a)
+	}
+
+	rows, err := h.db.Query(`
+		SELECT ch.id, ch.ordinal, ch.title, s.id, s.ordinal, s.title, s.pov_name,
+		       COALESCE(s.pov_node_id, ''), s.location_name, COALESCE(s.location_node_id, ''), s.word_count
+		FROM chapters ch
+		LEFT JOIN scenes s ON s.chapter_id = ch.id
+		WHERE ch.manuscript_id = ?
+		ORDER BY ch.ordinal, s.ordinal
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scenes"})
+		return
+	}
+	defer rows.Close()
+
+	chapters := []models.ChapterView{}
+	for rows.Next() {
+		var chapter models.ChapterView
+		var sceneID, sceneTitle, povName, povNodeID, locationName, locationNodeID sql.NullString
+		var sceneOrdinal, wordCount sql.NullInt64
+		if err := rows.Scan(&chapter.ID, &chapter.Ordinal, &chapter.Title, &sceneID, &sceneOrdinal, &sceneTitle,
+			&povName, &povNodeID, &locationName, &locationNodeID, &wordCount); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan scene data"})
+			return
+		}
+
+		if len(chapters) == 0 || chapters[len(chapters)-1].ID != chapter.ID {
+			chapter.Scenes = []models.SceneView{}
+			chapters = append(chapters, chapter)
+		}
+		if !sceneID.Valid {
+			continue
+		}
+
+		scene := models.SceneView{
+			ID:             sceneID.String,
+			Ordinal:        int(sceneOrdinal.Int64),
+			Title:          sceneTitle.String,
+			POVName:        povName.String,
+			POVNodeID:      povNodeID.String,
+			LocationName:   locationName.String,
+			LocationNodeID: locationNodeID.String,
+			WordCount:      int(wordCount.Int64),
+			Appearances:    appearing[sceneID.String],
+		}
+		if scene.Appearances == nil {
+			scene.Appearances = []models.SceneAppearing{}
+		}
+		last := &chapters[len(chapters)-1]
+		last.Scenes = append(last.Scenes, scene)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"manuscript": summary,
+		"chapters":   chapters,
+	})
+}
+
+func (h *ManuscriptHandler) DeleteManuscript(c *gin.Context) {
+	result, err := h.db.Exec("DELETE FROM manuscripts WHERE id = ?", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete manuscript"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Manuscript not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Manuscript deleted successfully"})
+}
+
+// GetNodeAppearances lists every chapter and scene a node appears in, in
+// reading order
+func (h *ManuscriptHandler) GetNodeAppearances(c *gin.Context) {
+	id := c.Param("id")
+
+	var name string
+	if err := h.db.QueryRow("SELECT name FROM nodes WHERE id = ?", id).Scan(&name); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve node"})
+		}
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT m.id, m.title, ch.id, ch.ordinal, ch.title, s.id, s.ordinal, s.title,
+		       a.mention_count, a.first_offset, a.matched_text, a.is_pov, a.is_location,
+		       COALESCE(a.source_revision, ''), a.updated_at
+		FROM appearances a
+		JOIN scenes s ON s.id = a.scene_id
+		JOIN chapters ch ON ch.id = s.chapter_id
+		JOIN manuscripts m ON m.id = s.manuscript_id
+		WHERE a.node_id = ?
+		ORDER BY m.title, ch.ordinal, s.ordinal
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appearances"})
+		return
+	}
+	defer rows.Close()
+
+	appearances := []models.Appearance{}
+	for rows.Next() {
+		var a models.Appearance
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&a.ManuscriptID, &a.ManuscriptTitle, &a.ChapterID, &a.ChapterOrdinal, &a.ChapterTitle,
+			&a.SceneID, &a.SceneOrdinal, &a.SceneTitle, &a.MentionCount, &a.FirstOffset, &a.MatchedText,
+			&a.IsPOV, &a.IsLocation, &a.SourceRevision, &updatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan appearance data"})
+			return
+		}
+		if updatedAt.Valid {
+			a.UpdatedAt = &updatedAt.Time
+		}
+		appearances = append(appearances, a)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"nodeId":      id,
+		"name":        name,
+		"appearances": appearances,
+		"count":       len(appearances),
+	})
+}
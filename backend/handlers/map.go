@@ -99,11 +99,33 @@ func (h *MapHandler) SaveMap(c *gin.Context) {
 		}
 	}
 
+	if err = indexAllLinks(tx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to index links"})
+		return
+	}
+
+	// Reject writes that would make an event (transitively) cause itself
+	cycle, err := checkCausalCycles(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check causality"})
+		return
+	}
+	if cycle != nil {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Edges would create a causal cycle between events",
+			"cycle": cycle,
+		})
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
+	runWriteRules(h.db)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Map synchronized successfully"})
 }
 
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"math/rand"
+	"mythsmith-backend/mapgen"
+	"mythsmith-backend/models"
+	"mythsmith-backend/tiles"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Size limits for generated maps, in pixels
+const (
+	minGeneratedSide = 256
+	maxGeneratedSide = 4096
+)
+
+// Most nodes of each kind placed on a generated map
+const maxGeneratedSites = 100
+
+// Defaults for generated maps
+const (
+	defaultGeneratedWidth     = 1600
+	defaultGeneratedHeight    = 1200
+	defaultGeneratedCities    = 8
+	defaultGeneratedLocations = 6
+)
+
+// GenerateWorldMap draws a continent from a seed and stores it as a world
+// map, optionally with generated city and location nodes pinned on it.
+// Generated seeds stay below 2^53 so they survive JSON numbers in JavaScript.
+func (h *WorldMapHandler) GenerateWorldMap(c *gin.Context) {
+	var req models.GenerateMapRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Width == 0 {
+		req.Width = defaultGeneratedWidth
+	}
+	if req.Height == 0 {
+		req.Height = defaultGeneratedHeight
+	}
+	if req.Width < minGeneratedSide || req.Height < minGeneratedSide || req.Width > maxGeneratedSide || req.Height > maxGeneratedSide {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("width and height must be between %d and %d pixels", minGeneratedSide, maxGeneratedSide)})
+		return
+	}
+	if req.PlaceNodes {
+		if req.Cities == 0 && req.Locations == 0 {
+			req.Cities, req.Locations = defaultGeneratedCities, defaultGeneratedLocations
+		}
+		if req.Cities < 0 || req.Locations < 0 || req.Cities > maxGeneratedSites || req.Locations > maxGeneratedSites {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cities and locations must be between 0 and %d", maxGeneratedSites)})
+			return
+		}
+	} else {
+		req.Cities, req.Locations = 0, 0
+	}
+	seed := rand.Int63n(1 << 53)
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = fmt.Sprintf("Generated map %d", seed)
+	}
+
+	generated := mapgen.Generate(mapgen.Options{
+		Seed:      seed,
+		Width:     req.Width,
+		Height:    req.Height,
+		Cities:    req.Cities,
+		Locations: req.Locations,
+	})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, generated.Image); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode map image"})
+		return
+	}
+
+	now := time.Now()
+	m := models.WorldMap{
+		ID:          uuid.NewString(),
+		Name:        req.Name,
+		ContentType: "image/png",
+		Width:       req.Width,
+		Height:      req.Height,
+		Tiles: models.MapTiles{
+			Status:   models.TileStatusPending,
+			Total:    tiles.Count(req.Width, req.Height),
+			MaxZoom:  tiles.MaxZoom(req.Width, req.Height),
+			TileSize: tiles.Size,
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	imagePath := path.Join(mapImageDir, m.ID+".png")
+	dest := filepath.Join(assetDir, filepath.FromSlash(imagePath))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store map image"})
+		return
+	}
+	if err := os.WriteFile(dest, buf.Bytes(), 0o644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store map image"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		os.Remove(dest)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := insertWorldMap(tx, m, imagePath); err != nil {
+		os.Remove(dest)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create world map"})
+		return
+	}
+
+	pinIDs := make([]string, 0, len(generated.Sites))
+	for _, site := range generated.Sites {
+		nodeType, description := models.NodeTypeLocation, fmt.Sprintf("A landmark in the %s of %s.", site.Biome, m.Name)
+		if site.Kind == mapgen.SiteCity {
+			nodeType, description = models.NodeTypeCity, fmt.Sprintf("A settlement in the %s of %s.", site.Biome, m.Name)
+		}
+		propertiesJSON, _ := json.Marshal(map[string]interface{}{"biome": site.Biome})
+
+		nodeID, pinID := uuid.NewString(), uuid.NewString()
+		_, err := tx.Exec(`
+			INSERT INTO nodes (id, name, type, description, x, y, connection_direction, properties, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, nodeID, site.Name, nodeType, description, site.X, site.Y, models.ConnectionDirectionAll, string(propertiesJSON), now, now)
+		if err == nil {
+			_, err = tx.Exec(`
+				INSERT INTO map_pins (id, map_id, node_id, x, y, icon, label, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, '', '', ?, ?)
+			`, pinID, m.ID, nodeID, site.X, site.Y, now, now)
+		}
+		if err != nil {
+			os.Remove(dest)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place generated nodes"})
+			return
+		}
+		pinIDs = append(pinIDs, pinID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		os.Remove(dest)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	h.tiler.Wake()
+	if len(pinIDs) > 0 {
+		runWriteRules(h.db)
+	}
+
+	result := models.GeneratedMap{Seed: seed, Map: m, Pins: []models.MapPin{}}
+	result.Map.PinCount = len(pinIDs)
+	for _, pinID := range pinIDs {
+		pin, err := h.loadPin(m.ID, pinID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pin"})
+			return
+		}
+		result.Pins = append(result.Pins, pin)
+	}
+	c.JSON(http.StatusCreated, result)
+}
@@ -0,0 +1,545 @@
+package handlers
+
+import (
+	"container/heap"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mythsmith-backend/database"
+	"mythsmith-backend/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const mapRouteColumns = `
+    r.id, r.map_id, r.from_pin_id, r.to_pin_id, fp.node_id, tp.node_id, r.name, COALESCE(r.points, '[]'),
+    r.terrain, r.speed_modifier, r.toll, r.danger, fp.x, fp.y, tp.x, tp.y, r.created_at, r.updated_at
+`
+
+const mapRouteTables = `
+    map_routes r
+    JOIN map_pins fp ON fp.id = r.from_pin_id
+    JOIN map_pins tp ON tp.id = r.to_pin_id
+`
+
+// scanMapRoute reads a route and measures its polyline in pixels
+func scanMapRoute(row rowScanner) (models.MapRoute, error) {
+	var r models.MapRoute
+	var pointsJSON string
+	var from, to models.MapPosition
+	err := row.Scan(&r.ID, &r.MapID, &r.FromPinID, &r.ToPinID, &r.FromNodeID, &r.ToNodeID, &r.Name, &pointsJSON,
+		&r.Terrain, &r.SpeedModifier, &r.Toll, &r.Danger, &from.X, &from.Y, &to.X, &to.Y, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return r, err
+	}
+	r.Points = []models.MapPosition{}
+	json.Unmarshal([]byte(pointsJSON), &r.Points)
+	r.Pixels = polylineLength(from, r.Points, to)
+	return r, nil
+}
+
+// polylineLength returns the length of the line from one pin through the
+// points to the other
+func polylineLength(from models.MapPosition, points []models.MapPosition, to models.MapPosition) float64 {
+	length := 0.0
+	prev := from
+	for _, p := range append(append([]models.MapPosition(nil), points...), to) {
+		length += math.Hypot(p.X-prev.X, p.Y-prev.Y)
+		prev = p
+	}
+	return length
+}
+
+func validTerrain(terrain string) bool {
+	for _, t := range models.Terrains {
+		if t == terrain {
+			return true
+		}
+	}
+	return false
+}
+
+// loadRoutes reads the routes matching where, or every route when where is
+// empty, measured in their map's unit when the map has a scale
+func loadRoutes(q queryer, where string, args ...interface{}) ([]models.MapRoute, error) {
+	query := "SELECT " + mapRouteColumns + " FROM " + mapRouteTables
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := q.Query(query+" ORDER BY r.created_at, r.id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query routes: %v", err)
+	}
+	defer rows.Close()
+
+	routes := []models.MapRoute{}
+	for rows.Next() {
+		route, err := scanMapRoute(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan route: %v", err)
+		}
+		routes = append(routes, route)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	scales := make(map[string]*models.MapScale)
+	for i := range routes {
+		r := &routes[i]
+		scale, ok := scales[r.MapID]
+		if !ok {
+			if scale, err = mapScale(q, r.MapID); err != nil {
+				return nil, err
+			}
+			scales[r.MapID] = scale
+		}
+		if scale != nil {
+			r.Distance = r.Pixels / scale.PixelsPerUnit
+			r.Unit = scale.Unit
+		}
+	}
+	return routes, nil
+}
+
+// syncRouteEdges writes the "route" edge of each route matching where,
+// between the nodes its pins mark
+func syncRouteEdges(e execer, where string, args ...interface{}) error {
+	_, err := e.Exec(`
+		INSERT INTO edges (id, source_node_id, target_node_id, source_handle, target_handle, relationship, properties, created_at)
+		SELECT r.id, fp.node_id, tp.node_id, '', '', ?,
+		       json_object('routeId', r.id, 'mapId', r.map_id, 'name', r.name, 'terrain', r.terrain), r.created_at
+		FROM `+mapRouteTables+`
+		WHERE `+where+`
+		ON CONFLICT(id) DO UPDATE SET
+		    source_node_id = excluded.source_node_id,
+		    target_node_id = excluded.target_node_id,
+		    relationship = excluded.relationship,
+		    properties = excluded.properties
+	`, append([]interface{}{models.RelationshipRoute}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to write route edges: %v", err)
+	}
+	return nil
+}
+
+// deleteRouteEdges removes the "route" edges of the routes matching where,
+// before the routes themselves go
+func deleteRouteEdges(e execer, where string, args ...interface{}) error {
+	_, err := e.Exec("DELETE FROM edges WHERE relationship = ? AND id IN (SELECT id FROM map_routes WHERE "+where+")",
+		append([]interface{}{models.RelationshipRoute}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to delete route edges: %v", err)
+	}
+	return nil
+}
+
+// validateRoute checks the route's pins are two different pins on the map
+// and its terrain, modifier, toll and danger are in range
+func (h *WorldMapHandler) validateRoute(c *gin.Context, m models.WorldMap, req *models.MapRouteRequest) bool {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Terrain = strings.ToLower(strings.TrimSpace(req.Terrain))
+	if req.Points == nil {
+		req.Points = []models.MapPosition{}
+	}
+	if req.SpeedModifier == 0 {
+		req.SpeedModifier = 1
+	}
+
+	if req.FromPinID == req.ToPinID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A route must join two different pins"})
+		return false
+	}
+	for _, pinID := range []string{req.FromPinID, req.ToPinID} {
+		var exists bool
+		if err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM map_pins WHERE id = ? AND map_id = ?)", pinID, m.ID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pin"})
+			return false
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Pin %s is not on this map", pinID)})
+			return false
+		}
+	}
+	for _, p := range req.Points {
+		if p.X < 0 || p.Y < 0 || p.X > float64(m.Width) || p.Y > float64(m.Height) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Route points must lie within the %dx%d map image", m.Width, m.Height)})
+			return false
+		}
+	}
+	if !validTerrain(req.Terrain) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("terrain must be one of %s", strings.Join(models.Terrains, ", "))})
+		return false
+	}
+	if req.SpeedModifier < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "speedModifier must be positive"})
+		return false
+	}
+	if req.Toll < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "toll must not be negative"})
+		return false
+	}
+	if req.Danger < 0 || req.Danger > models.MaxDanger {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("danger must be between 0 and %d", models.MaxDanger)})
+		return false
+	}
+	return true
+}
+
+// respondRoute sends a single route after a write
+func (h *WorldMapHandler) respondRoute(c *gin.Context, status int, routeID string) {
+	routes, err := loadRoutes(h.db, "r.id = ?", routeID)
+	if err != nil || len(routes) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve route"})
+		return
+	}
+	c.JSON(status, routes[0])
+}
+
+func (h *WorldMapHandler) GetRoutes(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.loadWorldMap(c, id); !ok {
+		return
+	}
+
+	routes, err := loadRoutes(h.db, "r.map_id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve routes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"routes": routes,
+		"count":  len(routes),
+	})
+}
+
+// CreateRoute draws a route between two pins on the map and adds a "route"
+// edge between their nodes to the world graph
+func (h *WorldMapHandler) CreateRoute(c *gin.Context) {
+	id := c.Param("id")
+	var req models.MapRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m, ok := h.loadWorldMap(c, id)
+	if !ok || !h.validateRoute(c, m, &req) {
+		return
+	}
+	pointsJSON, err := json.Marshal(req.Points)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal route points"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	routeID := uuid.NewString()
+	now := time.Now()
+	_, err = tx.Exec(`
+		INSERT INTO map_routes (id, map_id, from_pin_id, to_pin_id, name, points, terrain, speed_modifier, toll, danger, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, routeID, id, req.FromPinID, req.ToPinID, req.Name, string(pointsJSON), req.Terrain, req.SpeedModifier, req.Toll, req.Danger, now, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create route"})
+		return
+	}
+	if err := syncRouteEdges(tx, "r.id = ?", routeID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	h.respondRoute(c, http.StatusCreated, routeID)
+}
+
+// UpdateRoute redraws a route and updates its edge in the world graph
+func (h *WorldMapHandler) UpdateRoute(c *gin.Context) {
+	id, routeID := c.Param("id"), c.Param("routeId")
+	var req models.MapRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m, ok := h.loadWorldMap(c, id)
+	if !ok || !h.validateRoute(c, m, &req) {
+		return
+	}
+	pointsJSON, err := json.Marshal(req.Points)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal route points"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE map_routes SET from_pin_id = ?, to_pin_id = ?, name = ?, points = ?, terrain = ?,
+		       speed_modifier = ?, toll = ?, danger = ?, updated_at = ?
+		WHERE id = ? AND map_id = ?
+	`, req.FromPinID, req.ToPinID, req.Name, string(pointsJSON), req.Terrain, req.SpeedModifier, req.Toll, req.Danger, time.Now(), routeID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update route"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+		return
+	}
+	if err := syncRouteEdges(tx, "r.id = ?", routeID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	h.respondRoute(c, http.StatusOK, routeID)
+}
+
+// DeleteRoute deletes a route and its edge
+func (h *WorldMapHandler) DeleteRoute(c *gin.Context) {
+	id, routeID := c.Param("id"), c.Param("routeId")
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := deleteRouteEdges(tx, "id = ? AND map_id = ?", routeID, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := tx.Exec("DELETE FROM map_routes WHERE id = ? AND map_id = ?", routeID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete route"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Route deleted successfully"})
+}
+
+type RouteHandler struct {
+	db *database.DB
+}
+
+func NewRouteHandler(db *database.DB) *RouteHandler {
+	return &RouteHandler{db: db}
+}
+
+// routeLeg is a route travelled in one direction
+type routeLeg struct {
+	route models.MapRoute
+	to    string
+	days  float64
+}
+
+// pathQueue is a min-heap of nodes by travel time, for Dijkstra's algorithm
+type pathQueue []pathEntry
+
+type pathEntry struct {
+	node string
+	days float64
+}
+
+func (q pathQueue) Len() int            { return len(q) }
+func (q pathQueue) Less(i, j int) bool  { return q[i].days < q[j].days }
+func (q pathQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x interface{}) { *q = append(*q, x.(pathEntry)) }
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// FindPath finds the quickest path between the nodes ?from= and ?to= over the
+// routes of every calibrated map, travelling by ?mode= (the first travel mode
+// by default). Routes run both ways; a mode only uses routes whose terrain it
+// can travel, and ?maxDanger= leaves out routes rated above it.
+func (h *RouteHandler) FindPath(c *gin.Context) {
+	from, to := c.Query("from"), c.Query("to")
+	if from == "" || to == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to node IDs are required"})
+		return
+	}
+	maxDanger := models.MaxDanger
+	if value := c.Query("maxDanger"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "maxDanger must be a non-negative integer"})
+			return
+		}
+		maxDanger = n
+	}
+
+	modes, err := loadTravelModes(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load travel modes"})
+		return
+	}
+	if len(modes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No travel modes are configured"})
+		return
+	}
+	mode := modes[0]
+	if name := c.Query("mode"); name != "" {
+		found := false
+		for _, m := range modes {
+			if strings.EqualFold(m.Name, name) {
+				mode, found = m, true
+				break
+			}
+		}
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown travel mode %q", name)})
+			return
+		}
+	}
+
+	locations := make(map[string]models.PathLocation)
+	for _, nodeID := range []string{from, to} {
+		var loc models.PathLocation
+		err := h.db.QueryRow("SELECT id, name, type FROM nodes WHERE id = ?", nodeID).Scan(&loc.NodeID, &loc.Name, &loc.Type)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve node"})
+			return
+		}
+		locations[nodeID] = loc
+	}
+
+	routes, err := loadRoutes(h.db, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve routes"})
+		return
+	}
+	legs := make(map[string][]routeLeg)
+	for _, r := range routes {
+		// Routes on maps without a scale have no length to travel
+		if r.Unit == "" || r.Danger > maxDanger || !mode.CanUse(r.Terrain) || r.FromNodeID == r.ToNodeID {
+			continue
+		}
+		days := convertDistance(r.Distance, r.Unit, mode.Unit) / (mode.Speed * r.SpeedModifier * mode.HoursPerDay)
+		legs[r.FromNodeID] = append(legs[r.FromNodeID], routeLeg{route: r, to: r.ToNodeID, days: days})
+		legs[r.ToNodeID] = append(legs[r.ToNodeID], routeLeg{route: r, to: r.FromNodeID, days: days})
+	}
+
+	// Dijkstra's algorithm over travel time
+	best := map[string]float64{from: 0}
+	via := make(map[string]routeLeg)
+	prev := make(map[string]string)
+	done := make(map[string]bool)
+	queue := &pathQueue{{node: from}}
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(pathEntry)
+		if done[current.node] {
+			continue
+		}
+		done[current.node] = true
+		if current.node == to {
+			break
+		}
+		for _, leg := range legs[current.node] {
+			days := current.days + leg.days
+			if old, seen := best[leg.to]; !seen || days < old {
+				best[leg.to] = days
+				via[leg.to] = leg
+				prev[leg.to] = current.node
+				heap.Push(queue, pathEntry{node: leg.to, days: days})
+			}
+		}
+	}
+	if !done[to] {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No %s route from %s to %s", mode.Name, locations[from].Name, locations[to].Name)})
+		return
+	}
+
+	cal, err := loadCalendar(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return
+	}
+
+	path := models.RoutePath{
+		From:  from,
+		To:    to,
+		Mode:  mode.Name,
+		Unit:  mode.Unit,
+		Days:  best[to],
+		Steps: []models.PathStep{},
+	}
+	nodeIDs := []string{to}
+	for node := to; node != from; node = prev[node] {
+		leg := via[node]
+		r := leg.route
+		distance := convertDistance(r.Distance, r.Unit, mode.Unit)
+		path.Steps = append([]models.PathStep{{
+			RouteID:    r.ID,
+			MapID:      r.MapID,
+			Name:       r.Name,
+			FromNodeID: prev[node],
+			ToNodeID:   node,
+			Terrain:    r.Terrain,
+			Distance:   distance,
+			Days:       leg.days,
+			Toll:       r.Toll,
+			Danger:     r.Danger,
+		}}, path.Steps...)
+		path.Distance += distance
+		path.Toll += r.Toll
+		if r.Danger > path.MaxDanger {
+			path.MaxDanger = r.Danger
+		}
+		nodeIDs = append([]string{prev[node]}, nodeIDs...)
+	}
+	path.Duration = cal.Duration(path.Days)
+
+	for _, nodeID := range nodeIDs {
+		loc, ok := locations[nodeID]
+		if !ok {
+			loc.NodeID = nodeID
+			if err := h.db.QueryRow("SELECT name, type FROM nodes WHERE id = ?", nodeID).Scan(&loc.Name, &loc.Type); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve node"})
+				return
+			}
+		}
+		path.Locations = append(path.Locations, loc)
+	}
+
+	c.JSON(http.StatusOK, path)
+}
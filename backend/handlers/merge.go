@@ -0,0 +1,629 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mythsmith-backend/database"
+	"mythsmith-backend/models"
+	"mythsmith-backend/resolver"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type MergeHandler struct {
+	db *database.DB
+}
+
+func NewMergeHandler(db *database.DB) *MergeHandler {
+	return &MergeHandler{db: db}
+}
+
+// Weights of the duplicate score components
+const (
+	duplicateNameWeight     = 0.6
+	duplicateTypeWeight     = 0.15
+	duplicateNeighborWeight = 0.25
+	duplicateMinNameScore   = 0.75
+)
+
+// GetDuplicates suggests pairs of nodes that likely describe the same entity.
+// Pairs need similar names or aliases; matching types and shared neighbours
+// raise the score. ?minScore= (default 0.65), ?type= and ?limit= narrow the
+// list.
+func (h *MergeHandler) GetDuplicates(c *gin.Context) {
+	minScore, err := strconv.ParseFloat(c.DefaultQuery("minScore", "0.65"), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "minScore must be a number"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	nodeType := c.Query("type")
+
+	nodes, err := loadNodes(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load nodes"})
+		return
+	}
+	edges, err := loadEdges(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load edges"})
+		return
+	}
+	ix, err := loadResolver(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load names"})
+		return
+	}
+
+	names := make(map[string][]string)
+	for _, e := range ix.Entries() {
+		names[e.NodeID] = append(names[e.NodeID], e.Text)
+	}
+	neighbors := make(map[string]map[string]bool)
+	link := func(a, b string) {
+		if neighbors[a] == nil {
+			neighbors[a] = make(map[string]bool)
+		}
+		neighbors[a][b] = true
+	}
+	for _, e := range edges {
+		link(e.SourceNodeID, e.TargetNodeID)
+		link(e.TargetNodeID, e.SourceNodeID)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	candidates := []models.DuplicateCandidate{}
+	for i, a := range nodes {
+		if nodeType != "" && string(a.Type) != nodeType {
+			continue
+		}
+		for _, b := range nodes[i+1:] {
+			if nodeType != "" && string(b.Type) != nodeType {
+				continue
+			}
+
+			nameScore, matched := closestNames(names[a.ID], names[b.ID])
+			if nameScore < duplicateMinNameScore {
+				continue
+			}
+
+			shared := []string{}
+			union := 0
+			for n := range neighbors[a.ID] {
+				if n == b.ID {
+					continue
+				}
+				union++
+				if neighbors[b.ID][n] {
+					shared = append(shared, n)
+				}
+			}
+			for n := range neighbors[b.ID] {
+				if n != a.ID && !neighbors[a.ID][n] {
+					union++
+				}
+			}
+			sort.Strings(shared)
+
+			score := duplicateNameWeight * nameScore
+			if a.Type == b.Type {
+				score += duplicateTypeWeight
+			}
+			if union > 0 {
+				score += duplicateNeighborWeight * float64(len(shared)) / float64(union)
+			}
+			if score < minScore {
+				continue
+			}
+
+			candidates = append(candidates, models.DuplicateCandidate{
+				A:               models.NodeRef{ID: a.ID, Name: a.Name, Type: a.Type},
+				B:               models.NodeRef{ID: b.ID, Name: b.Name, Type: b.Type},
+				Score:           roundScore(score),
+				NameScore:       roundScore(nameScore),
+				SameType:        a.Type == b.Type,
+				SharedNeighbors: shared,
+				MatchedNames:    matched,
+			})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"duplicates": candidates,
+		"count":      len(candidates),
+	})
+}
+
+// closestNames returns the best similarity between any name or alias of one
+// node and any of the other, and the pair that achieved it
+func closestNames(a, b []string) (float64, []string) {
+	best := 0.0
+	var pair []string
+	for _, x := range a {
+		for _, y := range b {
+			if s := resolver.Similarity(x, y); s > best {
+				best, pair = s, []string{x, y}
+			}
+		}
+	}
+	return best, pair
+}
+
+func roundScore(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+// Properties that record where a node came from rather than what it is. The
+// surviving node keeps its own and the merged node's are dropped.
+var mergeBookkeeping = map[string]bool{"originalId": true, "importedAs": true, "tempId": true}
+
+// mergeValues resolves a conflicting property according to the policy
+func mergeValues(target, source interface{}, policy models.MergePolicy) interface{} {
+	switch policy {
+	case models.MergeKeepSource:
+		return source
+	case models.MergeCombine:
+		targetList, targetIsList := target.([]interface{})
+		sourceList, sourceIsList := source.([]interface{})
+		if !targetIsList && !sourceIsList {
+			ts, ok1 := target.(string)
+			ss, ok2 := source.(string)
+			if ok1 && ok2 {
+				return ts + "; " + ss
+			}
+			return target // Numbers and objects cannot be combined
+		}
+		if !targetIsList {
+			targetList = []interface{}{target}
+		}
+		if !sourceIsList {
+			sourceList = []interface{}{source}
+		}
+		combined := append([]interface{}{}, targetList...)
+		for _, v := range sourceList {
+			present := false
+			for _, existing := range combined {
+				if reflect.DeepEqual(existing, v) {
+					present = true
+					break
+				}
+			}
+			if !present {
+				combined = append(combined, v)
+			}
+		}
+		return combined
+	}
+	return target
+}
+
+// mergeNodeFields folds the source node's type, description and properties
+// into the target and reports every field where they disagreed
+func mergeNodeFields(target *models.Node, source models.Node, policy models.MergePolicy) []models.MergeConflict {
+	conflicts := []models.MergeConflict{}
+
+	if target.Type != source.Type {
+		result := target.Type
+		if policy == models.MergeKeepSource {
+			result = source.Type
+		}
+		conflicts = append(conflicts, models.MergeConflict{Field: "type", TargetValue: target.Type, SourceValue: source.Type, Result: result})
+		target.Type = result
+	}
+
+	switch {
+	case source.Description == "" || source.Description == target.Description:
+	case target.Description == "":
+		target.Description = source.Description
+	default:
+		result := target.Description
+		switch policy {
+		case models.MergeKeepSource:
+			result = source.Description
+		case models.MergeCombine:
+			result = target.Description + "\n\n" + source.Description
+		}
+		conflicts = append(conflicts, models.MergeConflict{Field: "description", TargetValue: target.Description, SourceValue: source.Description, Result: result})
+		target.Description = result
+	}
+
+	keys := make([]string, 0, len(source.Properties))
+	for key := range source.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := source.Properties[key]
+		existing, ok := target.Properties[key]
+		switch {
+		case mergeBookkeeping[key]:
+		case !ok:
+			target.Properties[key] = value
+		case !reflect.DeepEqual(existing, value):
+			result := mergeValues(existing, value, policy)
+			conflicts = append(conflicts, models.MergeConflict{Field: key, TargetValue: existing, SourceValue: value, Result: result})
+			target.Properties[key] = result
+		}
+	}
+
+	return conflicts
+}
+
+// repointEdges moves the source node's edges onto the target. Edges between
+// the two nodes would become self-loops and edges the target already has
+// would be duplicates; both are dropped, except route edges, which mirror
+// the map's routes and move with them.
+func repointEdges(tx *sql.Tx, targetID, sourceID string) (int, int, error) {
+	rows, err := tx.Query(`
+		SELECT id, source_node_id, target_node_id, COALESCE(relationship, '')
+		FROM edges
+		WHERE source_node_id IN (?, ?) OR target_node_id IN (?, ?)
+		ORDER BY created_at, id
+	`, targetID, sourceID, targetID, sourceID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query edges: %v", err)
+	}
+	type edgeRow struct{ id, source, target, relationship string }
+	var edges []edgeRow
+	for rows.Next() {
+		var e edgeRow
+		if err := rows.Scan(&e.id, &e.source, &e.target, &e.relationship); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to scan edge: %v", err)
+		}
+		edges = append(edges, e)
+	}
+	rows.Close()
+
+	key := func(e edgeRow) string { return e.source + "\x00" + e.target + "\x00" + e.relationship }
+	seen := make(map[string]bool)
+	for _, e := range edges {
+		if e.source != sourceID && e.target != sourceID {
+			seen[key(e)] = true
+		}
+	}
+
+	repointed, dropped := 0, 0
+	for _, e := range edges {
+		if e.source != sourceID && e.target != sourceID {
+			continue
+		}
+		moved := e
+		if moved.source == sourceID {
+			moved.source = targetID
+		}
+		if moved.target == sourceID {
+			moved.target = targetID
+		}
+
+		// A route edge stands for a route drawn on a map, which is still there
+		// however the nodes at its ends were merged
+		if e.relationship != models.RelationshipRoute && (moved.source == moved.target || seen[key(moved)]) {
+			if _, err := tx.Exec("DELETE FROM edges WHERE id = ?", e.id); err != nil {
+				return repointed, dropped, fmt.Errorf("failed to drop edge: %v", err)
+			}
+			dropped++
+			continue
+		}
+		seen[key(moved)] = true
+
+		if _, err := tx.Exec("UPDATE edges SET source_node_id = ?, target_node_id = ? WHERE id = ?",
+			moved.source, moved.target, e.id); err != nil {
+			return repointed, dropped, fmt.Errorf("failed to re-point edge: %v", err)
+		}
+		repointed++
+	}
+
+	return repointed, dropped, nil
+}
+
+// repointReferences moves aliases, wiki-links, manuscript appearances, map
+// pins and regions, and earlier merge records of the source node onto the
+// target, so a chain of merges keeps its history. Appearances in a scene both nodes
+// appear in are folded into the target's row.
+func repointReferences(tx *sql.Tx, targetID, sourceID string) error {
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"UPDATE node_aliases SET node_id = ? WHERE node_id = ?", []interface{}{targetID, sourceID}},
+		{"UPDATE mentions SET target_node_id = ? WHERE target_node_id = ?", []interface{}{targetID, sourceID}},
+		{"UPDATE scenes SET pov_node_id = ? WHERE pov_node_id = ?", []interface{}{targetID, sourceID}},
+		{"UPDATE scenes SET location_node_id = ? WHERE location_node_id = ?", []interface{}{targetID, sourceID}},
+		{`
+			UPDATE appearances SET
+				mention_count = mention_count + (SELECT s.mention_count FROM appearances s
+					WHERE s.scene_id = appearances.scene_id AND s.node_id = ?),
+				is_pov = MAX(is_pov, (SELECT s.is_pov FROM appearances s
+					WHERE s.scene_id = appearances.scene_id AND s.node_id = ?)),
+				is_location = MAX(is_location, (SELECT s.is_location FROM appearances s
+					WHERE s.scene_id = appearances.scene_id AND s.node_id = ?))
+			WHERE node_id = ? AND scene_id IN (SELECT scene_id FROM appearances WHERE node_id = ?)
+		`, []interface{}{sourceID, sourceID, sourceID, targetID, sourceID}},
+		{`
+			DELETE FROM appearances
+			WHERE node_id = ? AND scene_id IN (SELECT scene_id FROM appearances WHERE node_id = ?)
+		`, []interface{}{sourceID, targetID}},
+		{"UPDATE appearances SET node_id = ? WHERE node_id = ?", []interface{}{targetID, sourceID}},
+		{"UPDATE map_pins SET node_id = ? WHERE node_id = ?", []interface{}{targetID, sourceID}},
+		{"UPDATE map_regions SET node_id = ? WHERE node_id = ?", []interface{}{targetID, sourceID}},
+		{"UPDATE node_merges SET target_node_id = ? WHERE target_node_id = ?", []interface{}{targetID, sourceID}},
+	}
+	for _, s := range statements {
+		if _, err := tx.Exec(s.query, s.args...); err != nil {
+			return fmt.Errorf("failed to re-point references: %v", err)
+		}
+	}
+	return nil
+}
+
+// repointMaps moves the maps showing the source node onto the target, then
+// links the target's pins on their parent maps to them. It runs after the
+// pins have been re-pointed.
+func repointMaps(tx *sql.Tx, targetID, sourceID string) error {
+	if _, err := tx.Exec("UPDATE world_maps SET node_id = ? WHERE node_id = ?", targetID, sourceID); err != nil {
+		return fmt.Errorf("failed to re-point maps: %v", err)
+	}
+	rows, err := tx.Query("SELECT "+worldMapColumns+" FROM world_maps m WHERE m.node_id = ?", targetID)
+	if err != nil {
+		return fmt.Errorf("failed to query maps: %v", err)
+	}
+	var maps []models.WorldMap
+	for rows.Next() {
+		m, err := scanWorldMap(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan map: %v", err)
+		}
+		maps = append(maps, m)
+	}
+	rows.Close()
+
+	for _, m := range maps {
+		if err := linkChildPins(tx, m); err != nil {
+			return fmt.Errorf("failed to link pins to map: %v", err)
+		}
+	}
+	return nil
+}
+
+// MergeNodes folds one node into another in a single transaction: edges and
+// references move to the target, properties are combined under the conflict
+// policy, the merged name becomes an alias and a provenance record is kept.
+func (h *MergeHandler) MergeNodes(c *gin.Context) {
+	var req models.MergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.TargetID == req.SourceID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot merge a node into itself"})
+		return
+	}
+	switch req.Policy {
+	case "":
+		req.Policy = models.MergeKeepTarget
+	case models.MergeKeepTarget, models.MergeKeepSource, models.MergeCombine:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown merge policy %q", req.Policy)})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	target, err := loadNode(tx, req.TargetID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target node not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve target node"})
+		return
+	}
+	source, err := loadNode(tx, req.SourceID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source node not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve source node"})
+		return
+	}
+
+	now := time.Now()
+	merge := models.NodeMerge{
+		ID:         uuid.NewString(),
+		TargetID:   target.ID,
+		SourceID:   source.ID,
+		SourceName: source.Name,
+		Source:     source,
+		Policy:     req.Policy,
+		CreatedAt:  now,
+	}
+
+	merged := target
+	merged.Properties = make(models.ExtendedProperties, len(target.Properties))
+	for k, v := range target.Properties {
+		merged.Properties[k] = v
+	}
+	merge.Conflicts = mergeNodeFields(&merged, source, req.Policy)
+
+	merge.EdgesRepointed, merge.EdgesDropped, err = repointEdges(tx, target.ID, source.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := repointReferences(tx, target.ID, source.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := repointMaps(tx, target.ID, source.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Keep the merged name findable, unless the target already answers to it
+	var known bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM node_aliases WHERE node_id = ? AND LOWER(alias) = LOWER(?))
+	`, target.ID, source.Name).Scan(&known)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check aliases"})
+		return
+	}
+	if !known && resolver.Fold(source.Name) != resolver.Fold(target.Name) {
+		if _, err := tx.Exec("INSERT INTO node_aliases (id, node_id, alias, created_at) VALUES (?, ?, ?, ?)",
+			uuid.NewString(), target.ID, source.Name, now); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add alias"})
+			return
+		}
+	}
+
+	propertiesJSON, err := json.Marshal(merged.Properties)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal properties"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE nodes SET type = ?, description = ?, properties = ?, updated_at = ? WHERE id = ?",
+		merged.Type, merged.Description, string(propertiesJSON), now, target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update target node"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM nodes WHERE id = ?", source.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete source node"})
+		return
+	}
+
+	// The target's description may have gained links, and links to the merged
+	// name now resolve through the new alias
+	mt, err := loadMentionTerms(tx)
+	if err == nil {
+		err = indexNodeLinks(tx, mt, target.ID, merged.Description)
+	}
+	if err == nil {
+		err = resolveDanglingLinks(tx, mt)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Merging two events can close a loop between their causes and effects
+	cycle, err := checkCausalCycles(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check causality"})
+		return
+	}
+	if cycle != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Merging these nodes would create a causal cycle between events",
+			"cycle": cycle,
+		})
+		return
+	}
+
+	snapshotJSON, err := json.Marshal(source)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal source node"})
+		return
+	}
+	conflictsJSON, err := json.Marshal(merge.Conflicts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal conflicts"})
+		return
+	}
+	_, err = tx.Exec(`
+		INSERT INTO node_merges (id, target_node_id, source_node_id, source_name, source_snapshot,
+		                         policy, conflicts, edges_repointed, edges_dropped, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, merge.ID, merge.TargetID, merge.SourceID, merge.SourceName, string(snapshotJSON),
+		merge.Policy, string(conflictsJSON), merge.EdgesRepointed, merge.EdgesDropped, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record merge"})
+		return
+	}
+
+	summary := fmt.Sprintf("Merged %s into %s", source.Name, target.Name)
+	if err := recordChange(tx, "node", target.ID, "merged", summary, gin.H{
+		"mergeId":  merge.ID,
+		"sourceId": source.ID,
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	runWriteRules(h.db)
+
+	result, err := loadNode(h.db, target.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve merged node"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"node":  result.ToReactFlowNode(),
+		"merge": merge,
+	})
+}
+
+// GetMerges lists the nodes that were merged into a node, newest first
+func (h *MergeHandler) GetMerges(c *gin.Context) {
+	id := c.Param("id")
+
+	rows, err := h.db.Query(`
+		SELECT id, target_node_id, source_node_id, source_name, source_snapshot, policy,
+		       conflicts, edges_repointed, edges_dropped, created_at
+		FROM node_merges
+		WHERE target_node_id = ?
+		ORDER BY created_at DESC
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve merges"})
+		return
+	}
+	defer rows.Close()
+
+	merges := []models.NodeMerge{}
+	for rows.Next() {
+		var merge models.NodeMerge
+		var snapshotJSON, conflictsJSON string
+		if err := rows.Scan(&merge.ID, &merge.TargetID, &merge.SourceID, &merge.SourceName, &snapshotJSON,
+			&merge.Policy, &conflictsJSON, &merge.EdgesRepointed, &merge.EdgesDropped, &merge.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan merge data"})
+			return
+		}
+		json.Unmarshal([]byte(snapshotJSON), &merge.Source)
+		json.Unmarshal([]byte(conflictsJSON), &merge.Conflicts)
+		merges = append(merges, merge)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"merges": merges,
+		"count":  len(merges),
+	})
+}
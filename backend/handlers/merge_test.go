@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mythsmith-backend/database"
+	"mythsmith-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func openTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func insertTestNode(t *testing.T, db *database.DB, id, name string, nodeType models.NodeType) {
+	t.Helper()
+	_, err := db.Exec(`
+		INSERT INTO nodes (id, name, type, description, x, y, connection_direction, properties)
+		VALUES (?, ?, ?, '', 0, 0, 'all', '{}')
+	`, id, name, nodeType)
+	if err != nil {
+		t.Fatalf("failed to insert node %s: %v", name, err)
+	}
+}
+
+// insertTestMap stores a 100x100 map, filling in the fields tests don't care
+// about
+func insertTestMap(t *testing.T, db *database.DB, m models.WorldMap) {
+	t.Helper()
+	now := time.Now()
+	m.Name, m.ContentType, m.Width, m.Height = m.ID, "image/png", 100, 100
+	m.Tiles.Status, m.CreatedAt, m.UpdatedAt = models.TileStatusDone, now, now
+	if err := insertWorldMap(db, m, "maps/"+m.ID+".png"); err != nil {
+		t.Fatalf("failed to insert map %s: %v", m.ID, err)
+	}
+}
+
+func mergeTestNodes(t *testing.T, db *database.DB, targetID, sourceID string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/nodes/merge", NewMergeHandler(db).MergeNodes)
+
+	body, _ := json.Marshal(models.MergeRequest{TargetID: targetID, SourceID: sourceID})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/nodes/merge", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("merge returned %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMergeKeepsRegions(t *testing.T) {
+	db := openTestDB(t)
+	insertTestNode(t, db, "target", "Highmarch", models.NodeTypeLocation)
+	insertTestNode(t, db, "source", "The High March", models.NodeTypeLocation)
+
+	insertTestMap(t, db, models.WorldMap{ID: "map"})
+	_, err := db.Exec("INSERT INTO map_regions (id, map_id, node_id, points) VALUES ('region', 'map', 'source', ?)",
+		`[{"x":10,"y":10},{"x":50,"y":10},{"x":50,"y":50}]`)
+	if err != nil {
+		t.Fatalf("failed to insert region: %v", err)
+	}
+
+	mergeTestNodes(t, db, "target", "source")
+
+	var nodeID string
+	if err := db.QueryRow("SELECT node_id FROM map_regions WHERE id = 'region'").Scan(&nodeID); err != nil {
+		t.Fatalf("region did not survive the merge: %v", err)
+	}
+	if nodeID != "target" {
+		t.Errorf("region belongs to %q, want the merged node %q", nodeID, "target")
+	}
+}
+
+func TestMergeKeepsMapNode(t *testing.T) {
+	db := openTestDB(t)
+	insertTestNode(t, db, "target", "Port Ashby", models.NodeTypeCity)
+	insertTestNode(t, db, "source", "Ashby", models.NodeTypeCity)
+	insertTestMap(t, db, models.WorldMap{ID: "world"})
+	insertTestMap(t, db, models.WorldMap{ID: "city", ParentID: "world", NodeID: "source",
+		Bounds: &models.MapBounds{X: 10, Y: 10, Width: 20, Height: 20}})
+	if _, err := db.Exec("INSERT INTO map_pins (id, map_id, node_id, x, y) VALUES ('pin', 'world', 'target', 20, 20)"); err != nil {
+		t.Fatalf("failed to insert pin: %v", err)
+	}
+
+	mergeTestNodes(t, db, "target", "source")
+
+	var nodeID string
+	if err := db.QueryRow("SELECT COALESCE(node_id, '') FROM world_maps WHERE id = 'city'").Scan(&nodeID); err != nil {
+		t.Fatalf("failed to load city map: %v", err)
+	}
+	if nodeID != "target" {
+		t.Errorf("city map shows %q, want the merged node %q", nodeID, "target")
+	}
+	var childMapID string
+	if err := db.QueryRow("SELECT COALESCE(child_map_id, '') FROM map_pins WHERE id = 'pin'").Scan(&childMapID); err != nil {
+		t.Fatalf("failed to load pin: %v", err)
+	}
+	if childMapID != "city" {
+		t.Errorf("pin opens %q, want the city map", childMapID)
+	}
+}
+
+func TestMergeKeepsRouteEdges(t *testing.T) {
+	db := openTestDB(t)
+	insertTestNode(t, db, "target", "Kestrel", models.NodeTypeCity)
+	insertTestNode(t, db, "source", "Kestrel Ford", models.NodeTypeCity)
+	insertTestNode(t, db, "other", "Dunmere", models.NodeTypeCity)
+	insertTestMap(t, db, models.WorldMap{ID: "map"})
+	for _, pin := range [][2]string{{"pin-target", "target"}, {"pin-source", "source"}, {"pin-other", "other"}} {
+		if _, err := db.Exec("INSERT INTO map_pins (id, map_id, node_id, x, y) VALUES (?, 'map', ?, 10, 10)", pin[0], pin[1]); err != nil {
+			t.Fatalf("failed to insert pin: %v", err)
+		}
+	}
+	// One route joins the merged nodes, and two join each of them to the same
+	// third node, so merging turns them into a self-loop and a duplicate
+	for _, route := range [][3]string{{"between", "pin-target", "pin-source"}, {"road", "pin-target", "pin-other"}, {"trail", "pin-source", "pin-other"}} {
+		if _, err := db.Exec("INSERT INTO map_routes (id, map_id, from_pin_id, to_pin_id, terrain) VALUES (?, 'map', ?, ?, 'road')", route[0], route[1], route[2]); err != nil {
+			t.Fatalf("failed to insert route: %v", err)
+		}
+	}
+	if err := syncRouteEdges(db, "r.map_id = ?", "map"); err != nil {
+		t.Fatal(err)
+	}
+
+	mergeTestNodes(t, db, "target", "source")
+
+	for _, id := range []string{"between", "road", "trail"} {
+		var source, target string
+		if err := db.QueryRow("SELECT source_node_id, target_node_id FROM edges WHERE id = ?", id).Scan(&source, &target); err != nil {
+			t.Errorf("edge for route %s was dropped: %v", id, err)
+			continue
+		}
+		if source == "source" || target == "source" {
+			t.Errorf("edge for route %s still points at the merged node", id)
+		}
+	}
+}
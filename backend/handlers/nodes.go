@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"mythsmith-backend/database"
 	"mythsmith-backend/models"
 	"net/http"
@@ -183,6 +184,9 @@ func (h *NodeHandler) CreateNode(c *gin.Context) {
 		UpdatedAt:           now,
 	}
 
+	refreshNodeLinks(h.db, id, &req.Description)
+	runWriteRules(h.db)
+
 	c.JSON(http.StatusCreated, node.ToReactFlowNode())
 }
 
@@ -195,6 +199,16 @@ func (h *NodeHandler) UpdateNode(c *gin.Context) {
 		return
 	}
 
+	// With ?rewriteLinks=true a rename also rewrites [[Old Name]] links in
+	// other descriptions, so the old name is needed before it is overwritten
+	var oldName string
+	if req.Name != nil && c.Query("rewriteLinks") == "true" {
+		if err := h.db.QueryRow("SELECT name FROM nodes WHERE id = ?", id).Scan(&oldName); err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve node"})
+			return
+		}
+	}
+
 	setParts := []string{"updated_at = ?"}
 	args := []interface{}{time.Now()}
 
@@ -276,6 +290,20 @@ func (h *NodeHandler) UpdateNode(c *gin.Context) {
 		return
 	}
 
+	if oldName != "" && oldName != *req.Name {
+		mt, err := loadMentionTerms(h.db)
+		if err == nil {
+			_, err = rewriteLinkNames(h.db, mt, id, oldName, *req.Name)
+		}
+		if err != nil {
+			log.Printf("Failed to rewrite links to node %s: %v", id, err)
+		}
+	}
+	if req.Name != nil || req.Description != nil || len(req.Properties) > 0 {
+		refreshNodeLinks(h.db, id, req.Description)
+	}
+	runWriteRules(h.db)
+
 	h.GetNode(c)
 }
 
@@ -339,5 +367,7 @@ func (h *NodeHandler) DeleteNode(c *gin.Context) {
 		return
 	}
 
+	runWriteRules(h.db)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Node deleted successfully"})
 }
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mythsmith-backend/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// How long a dry-run token can be confirmed
+const importPlanTTL = 30 * time.Minute
+
+// worldSnapshot maps node or edge IDs to their comparable fields
+type worldSnapshot map[string]map[string]string
+
+// canonicalJSON re-encodes a JSON object so equal objects compare equal
+func canonicalJSON(raw string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return raw
+	}
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+func snapshotNodes(q queryer) (worldSnapshot, error) {
+	rows, err := q.Query(`
+		SELECT id, name, type, COALESCE(description, ''), x, y, COALESCE(connection_direction, ''),
+		       COALESCE(properties, '{}')
+		FROM nodes
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query nodes: %v", err)
+	}
+	defer rows.Close()
+
+	snapshot := make(worldSnapshot)
+	for rows.Next() {
+		var id, name, nodeType, description, direction, properties string
+		var x, y float64
+		if err := rows.Scan(&id, &name, &nodeType, &description, &x, &y, &direction, &properties); err != nil {
+			return nil, fmt.Errorf("failed to scan node: %v", err)
+		}
+		snapshot[id] = map[string]string{
+			"name":                name,
+			"type":                nodeType,
+			"description":         description,
+			"x":                   strconv.FormatFloat(x, 'g', -1, 64),
+			"y":                   strconv.FormatFloat(y, 'g', -1, 64),
+			"connectionDirection": direction,
+			"properties":          canonicalJSON(properties),
+		}
+	}
+	return snapshot, rows.Err()
+}
+
+func snapshotEdges(q queryer) (worldSnapshot, error) {
+	rows, err := q.Query(`
+		SELECT id, source_node_id, target_node_id, COALESCE(source_handle, ''),
+		       COALESCE(target_handle, ''), COALESCE(relationship, ''), COALESCE(properties, '{}')
+		FROM edges
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query edges: %v", err)
+	}
+	defer rows.Close()
+
+	snapshot := make(worldSnapshot)
+	for rows.Next() {
+		var id, source, target, sourceHandle, targetHandle, relationship, properties string
+		if err := rows.Scan(&id, &source, &target, &sourceHandle, &targetHandle, &relationship, &properties); err != nil {
+			return nil, fmt.Errorf("failed to scan edge: %v", err)
+		}
+		snapshot[id] = map[string]string{
+			"source":       source,
+			"target":       target,
+			"sourceHandle": sourceHandle,
+			"targetHandle": targetHandle,
+			"relationship": relationship,
+			"properties":   canonicalJSON(properties),
+		}
+	}
+	return snapshot, rows.Err()
+}
+
+// compareSnapshots returns the sorted IDs added, changed and deleted between
+// two snapshots, and the changed fields of each changed ID
+func compareSnapshots(before, after worldSnapshot) (added, changed, deleted []string, fields map[string][]string) {
+	fields = make(map[string][]string)
+	for id, row := range after {
+		old, ok := before[id]
+		if !ok {
+			added = append(added, id)
+			continue
+		}
+		for field, value := range row {
+			if old[field] != value {
+				fields[id] = append(fields[id], field)
+			}
+		}
+		if len(fields[id]) > 0 {
+			sort.Strings(fields[id])
+			changed = append(changed, id)
+		}
+	}
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			deleted = append(deleted, id)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(deleted)
+	return added, changed, deleted, fields
+}
+
+// importSnapshot is the world before an import runs
+type importSnapshot struct {
+	nodes, edges worldSnapshot
+}
+
+func takeImportSnapshot(q queryer) (importSnapshot, error) {
+	nodes, err := snapshotNodes(q)
+	if err != nil {
+		return importSnapshot{}, err
+	}
+	edges, err := snapshotEdges(q)
+	if err != nil {
+		return importSnapshot{}, err
+	}
+	return importSnapshot{nodes: nodes, edges: edges}, nil
+}
+
+// diff compares the snapshot with the state the session's transaction is in
+func (before importSnapshot) diff(s *importSession) (models.ImportDiff, error) {
+	after, err := takeImportSnapshot(s.tx)
+	if err != nil {
+		return models.ImportDiff{}, err
+	}
+
+	d := models.ImportDiff{
+		NodesAdded:   []models.NodeRef{},
+		NodesChanged: []models.ImportChange{},
+		NodesDeleted: []models.NodeRef{},
+		EdgesAdded:   []models.EdgeRef{},
+		EdgesChanged: []models.ImportChange{},
+		EdgesDeleted: []models.EdgeRef{},
+		NodeIDRemaps: make(map[string]string),
+		EdgeIDRemaps: s.edgeIDs,
+		SkippedEdges: s.skippedEdges,
+		Warnings:     s.response.Warnings,
+		Conflicts:    s.response.Conflicts,
+	}
+	if d.SkippedEdges == nil {
+		d.SkippedEdges = []string{}
+	}
+	for from, to := range s.nodeIDs {
+		d.NodeIDRemaps[from] = to
+	}
+	for from, to := range s.tempIDs {
+		d.NodeIDRemaps[from] = to
+	}
+
+	nodeRef := func(id string, row map[string]string) models.NodeRef {
+		return models.NodeRef{ID: id, Name: row["name"], Type: models.NodeType(row["type"])}
+	}
+	edgeRef := func(id string, row map[string]string) models.EdgeRef {
+		return models.EdgeRef{ID: id, Source: row["source"], Target: row["target"], Relationship: row["relationship"]}
+	}
+
+	added, changed, deleted, fields := compareSnapshots(before.nodes, after.nodes)
+	for _, id := range added {
+		d.NodesAdded = append(d.NodesAdded, nodeRef(id, after.nodes[id]))
+	}
+	for _, id := range changed {
+		d.NodesChanged = append(d.NodesChanged, models.ImportChange{ID: id, Name: after.nodes[id]["name"], Fields: fields[id]})
+	}
+	for _, id := range deleted {
+		d.NodesDeleted = append(d.NodesDeleted, nodeRef(id, before.nodes[id]))
+	}
+
+	added, changed, deleted, fields = compareSnapshots(before.edges, after.edges)
+	for _, id := range added {
+		d.EdgesAdded = append(d.EdgesAdded, edgeRef(id, after.edges[id]))
+	}
+	for _, id := range changed {
+		d.EdgesChanged = append(d.EdgesChanged, models.ImportChange{ID: id, Fields: fields[id]})
+	}
+	for _, id := range deleted {
+		d.EdgesDeleted = append(d.EdgesDeleted, edgeRef(id, before.edges[id]))
+	}
+
+	return d, nil
+}
+
+// planImport runs the import in a transaction that is always rolled back and
+// returns the diff it would have produced
+func (h *ImportHandler) planImport(req ImportRequest, now time.Time) (models.ImportDiff, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return models.ImportDiff{}, importFailed("Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	before, err := takeImportSnapshot(tx)
+	if err != nil {
+		return models.ImportDiff{}, importFailed("Failed to read current world: %v", err)
+	}
+	session := newImportSession(tx, req.Strategy, now)
+	session.fieldPrecedence = req.FieldPrecedence
+	if err := h.runImport(session, req); err != nil {
+		return models.ImportDiff{}, err
+	}
+	diff, err := before.diff(session)
+	if err != nil {
+		return models.ImportDiff{}, importFailed("Failed to compute diff: %v", err)
+	}
+	return diff, nil
+}
+
+func diffHash(diff models.ImportDiff) (string, error) {
+	encoded, err := json.Marshal(diff)
+	if err != nil {
+		return "", err
+	}
+	return contentHash(string(encoded)), nil
+}
+
+// previewImport answers POST /import/map?dryRun=true with the diff and a
+// token that confirms exactly this plan
+func (h *ImportHandler) previewImport(c *gin.Context, req ImportRequest) {
+	now := time.Now()
+	diff, err := h.planImport(req, now)
+	if err != nil {
+		writeImportError(c, err)
+		return
+	}
+
+	hash, err := diffHash(diff)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash diff"})
+		return
+	}
+	requestJSON, err := json.Marshal(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store import plan"})
+		return
+	}
+
+	token := uuid.NewString()
+	expiresAt := now.Add(importPlanTTL)
+	if _, err := h.db.Exec("DELETE FROM import_plans WHERE expires_at < ?", now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear expired import plans"})
+		return
+	}
+	_, err = h.db.Exec(`
+		INSERT INTO import_plans (token, request, planned_at, diff_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, token, string(requestJSON), now.UnixNano(), hash, expiresAt, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store import plan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dryRun":    true,
+		"token":     token,
+		"expiresAt": expiresAt,
+		"diff":      diff,
+	})
+}
+
+// ConfirmImport applies a previewed import. The stored request is replayed
+// with the same timestamp, and the result must match the previewed diff;
+// if the world changed in between, nothing is written.
+func (h *ImportHandler) ConfirmImport(c *gin.Context) {
+	var body struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var requestJSON, hash string
+	var plannedAt int64
+	var expiresAt time.Time
+	err := h.db.QueryRow("SELECT request, planned_at, diff_hash, expires_at FROM import_plans WHERE token = ?",
+		body.Token).Scan(&requestJSON, &plannedAt, &hash, &expiresAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import plan not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve import plan"})
+		return
+	}
+	if time.Now().After(expiresAt) {
+		h.db.Exec("DELETE FROM import_plans WHERE token = ?", body.Token)
+		c.JSON(http.StatusGone, gin.H{"error": "Import plan has expired; run the dry run again"})
+		return
+	}
+
+	var req ImportRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read import plan"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := takeImportSnapshot(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read current world: %v", err)})
+		return
+	}
+	session := newImportSession(tx, req.Strategy, time.Unix(0, plannedAt))
+	session.fieldPrecedence = req.FieldPrecedence
+	if err := h.runImport(session, req); err != nil {
+		writeImportError(c, err)
+		return
+	}
+	diff, err := before.diff(session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to compute diff: %v", err)})
+		return
+	}
+	if replayed, err := diffHash(diff); err != nil || replayed != hash {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "The world changed since the dry run; run it again to get a new plan",
+			"diff":  diff,
+		})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM import_plans WHERE token = ?", body.Token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to consume import plan"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	runWriteRules(h.db)
+
+	response := session.response
+	response.Message = importMessage(response)
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mythsmith-backend/geom"
+	"mythsmith-backend/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const mapRegionColumns = `
+    r.id, r.map_id, r.node_id, n.name, n.type, COALESCE(r.name, ''), r.points, COALESCE(r.color, ''),
+    r.created_at, r.updated_at
+`
+
+const mapRegionTables = `map_regions r JOIN nodes n ON n.id = r.node_id`
+
+func scanMapRegion(row rowScanner) (models.MapRegion, error) {
+	var r models.MapRegion
+	var pointsJSON string
+	err := row.Scan(&r.ID, &r.MapID, &r.NodeID, &r.NodeName, &r.NodeType, &r.Name, &pointsJSON, &r.Color,
+		&r.CreatedAt, &r.UpdatedAt)
+	r.Points = []models.MapPosition{}
+	json.Unmarshal([]byte(pointsJSON), &r.Points)
+	return r, err
+}
+
+// setArea fills in the region's area when its map has a scale
+func setArea(r *models.MapRegion, scale *models.MapScale) {
+	if scale == nil {
+		return
+	}
+	r.Area = &models.RegionArea{
+		Value: toPolygon(r.Points).Area() / (scale.PixelsPerUnit * scale.PixelsPerUnit),
+		Unit:  scale.Unit,
+	}
+}
+
+// loadRegions reads the regions drawn on a map
+func loadRegions(q queryer, mapID string) ([]models.MapRegion, error) {
+	scale, err := mapScale(q, mapID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load map scale: %v", err)
+	}
+	rows, err := q.Query("SELECT "+mapRegionColumns+" FROM "+mapRegionTables+" WHERE r.map_id = ? ORDER BY r.created_at, r.id", mapID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query regions: %v", err)
+	}
+	defer rows.Close()
+
+	regions := []models.MapRegion{}
+	for rows.Next() {
+		region, err := scanMapRegion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan region: %v", err)
+		}
+		setArea(&region, scale)
+		regions = append(regions, region)
+	}
+	return regions, rows.Err()
+}
+
+func findRegion(q queryer, mapID, regionID string) (models.MapRegion, error) {
+	region, err := scanMapRegion(q.QueryRow("SELECT "+mapRegionColumns+" FROM "+mapRegionTables+" WHERE r.id = ? AND r.map_id = ?", regionID, mapID))
+	if err != nil {
+		return region, err
+	}
+	scale, err := mapScale(q, mapID)
+	setArea(&region, scale)
+	return region, err
+}
+
+// mapRegions is a map with the regions drawn on it
+type mapRegions struct {
+	m       models.WorldMap
+	regions []models.MapRegion
+}
+
+// loadRegionChain returns the regions of a map and of every map above it,
+// starting with the map itself
+func loadRegionChain(q queryer, id string) ([]mapRegions, error) {
+	chain, err := mapChain(q, id)
+	if err != nil {
+		return nil, err
+	}
+	levels := make([]mapRegions, 0, len(chain))
+	for i := len(chain) - 1; i >= 0; i-- {
+		regions, err := loadRegions(q, chain[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, mapRegions{m: chain[i], regions: regions})
+	}
+	return levels, nil
+}
+
+// regionsAt returns the regions containing a point on the first map of the
+// chain, innermost first: the map's own regions from smallest to largest,
+// then those of its parent map, and so on up to the root map
+func regionsAt(levels []mapRegions, x, y float64) []models.MapRegion {
+	found := []models.MapRegion{}
+	for _, level := range levels {
+		var here []models.MapRegion
+		for _, region := range level.regions {
+			if toPolygon(region.Points).Contains(geom.Point{X: x, Y: y}) {
+				here = append(here, region)
+			}
+		}
+		sort.SliceStable(here, func(i, j int) bool {
+			return toPolygon(here[i].Points).Area() < toPolygon(here[j].Points).Area()
+		})
+		found = append(found, here...)
+
+		b := level.m.Bounds
+		if b == nil {
+			break
+		}
+		x = b.X + x*b.Width/float64(level.m.Width)
+		y = b.Y + y*b.Height/float64(level.m.Height)
+	}
+	return found
+}
+
+func (h *WorldMapHandler) GetRegions(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.loadWorldMap(c, id); !ok {
+		return
+	}
+
+	regions, err := loadRegions(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve regions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"regions": regions,
+		"count":   len(regions),
+	})
+}
+
+// bindRegion reads and validates a region body for the map in the path
+func (h *WorldMapHandler) bindRegion(c *gin.Context) (models.MapRegionRequest, string, bool) {
+	var req models.MapRegionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, "", false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if !validateColor(c, &req.Color) {
+		return req, "", false
+	}
+	m, ok := h.loadWorldMap(c, c.Param("id"))
+	if !ok {
+		return req, "", false
+	}
+
+	var nodeType models.NodeType
+	err := h.db.QueryRow("SELECT type FROM nodes WHERE id = ?", req.NodeID).Scan(&nodeType)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Node %s does not exist", req.NodeID)})
+		return req, "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve node"})
+		return req, "", false
+	}
+	if nodeType != models.NodeTypeFaction && nodeType != models.NodeTypeLocation && nodeType != models.NodeTypeCity {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A region must outline a faction, location or city"})
+		return req, "", false
+	}
+
+	if !validatePolygon(c, m, req.Points) {
+		return req, "", false
+	}
+	pointsJSON, err := json.Marshal(req.Points)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal region points"})
+		return req, "", false
+	}
+	return req, string(pointsJSON), true
+}
+
+func (h *WorldMapHandler) CreateRegion(c *gin.Context) {
+	req, pointsJSON, ok := h.bindRegion(c)
+	if !ok {
+		return
+	}
+	mapID := c.Param("id")
+
+	regionID := uuid.NewString()
+	now := time.Now()
+	_, err := h.db.Exec(`
+		INSERT INTO map_regions (id, map_id, node_id, name, points, color, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, regionID, mapID, req.NodeID, req.Name, pointsJSON, req.Color, now, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create region"})
+		return
+	}
+
+	region, err := findRegion(h.db, mapID, regionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve region"})
+		return
+	}
+	c.JSON(http.StatusCreated, region)
+}
+
+func (h *WorldMapHandler) UpdateRegion(c *gin.Context) {
+	req, pointsJSON, ok := h.bindRegion(c)
+	if !ok {
+		return
+	}
+	mapID, regionID := c.Param("id"), c.Param("regionId")
+
+	result, err := h.db.Exec(`
+		UPDATE map_regions SET node_id = ?, name = ?, points = ?, color = ?, updated_at = ?
+		WHERE id = ? AND map_id = ?
+	`, req.NodeID, req.Name, pointsJSON, req.Color, time.Now(), regionID, mapID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update region"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Region not found"})
+		return
+	}
+
+	region, err := findRegion(h.db, mapID, regionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve region"})
+		return
+	}
+	c.JSON(http.StatusOK, region)
+}
+
+func (h *WorldMapHandler) DeleteRegion(c *gin.Context) {
+	result, err := h.db.Exec("DELETE FROM map_regions WHERE id = ? AND map_id = ?", c.Param("regionId"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete region"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Region not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Region deleted successfully"})
+}
+
+// GetRegionsAt returns every region containing a point on the map, including
+// the regions of the maps above it, innermost first
+func (h *WorldMapHandler) GetRegionsAt(c *gin.Context) {
+	x, errX := strconv.ParseFloat(c.Query("x"), 64)
+	y, errY := strconv.ParseFloat(c.Query("y"), 64)
+	if errX != nil || errY != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "x and y must be numbers"})
+		return
+	}
+	m, ok := h.loadWorldMap(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if x < 0 || y < 0 || x > float64(m.Width) || y > float64(m.Height) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Point must lie within the %dx%d map image", m.Width, m.Height)})
+		return
+	}
+
+	levels, err := loadRegionChain(h.db, m.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve regions"})
+		return
+	}
+	regions := regionsAt(levels, x, y)
+
+	c.JSON(http.StatusOK, gin.H{
+		"x":       x,
+		"y":       y,
+		"regions": regions,
+		"count":   len(regions),
+	})
+}
+
+// CheckRegions finds pins of locations and cities whose containment edges
+// disagree with the regions drawn on the map and the maps above it. Faction
+// regions are left out, as containment edges only link locations and cities.
+func (h *WorldMapHandler) CheckRegions(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.loadWorldMap(c, id); !ok {
+		return
+	}
+	levels, err := loadRegionChain(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve regions"})
+		return
+	}
+	containers, err := loadContainment(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve containment edges"})
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+mapPinColumns+` FROM map_pins p JOIN nodes n ON n.id = p.node_id
+		WHERE p.map_id = ? AND n.type IN (?, ?)
+		ORDER BY p.created_at, p.id
+	`, id, models.NodeTypeLocation, models.NodeTypeCity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pins"})
+		return
+	}
+	defer rows.Close()
+	var pins []models.MapPin
+	for rows.Next() {
+		pin, err := scanMapPin(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan pin data"})
+			return
+		}
+		pins = append(pins, pin)
+	}
+
+	conflicts := []models.RegionConflict{}
+	for _, pin := range pins {
+		inside := make(map[string]bool)
+		for _, region := range regionsAt(levels, pin.X, pin.Y) {
+			if region.NodeType == string(models.NodeTypeFaction) || region.NodeID == pin.NodeID || inside[region.NodeID] {
+				continue
+			}
+			inside[region.NodeID] = true
+			if !liesWithin(containers, pin.NodeID, region.NodeID) {
+				conflicts = append(conflicts, models.RegionConflict{
+					Type:    models.RegionConflictMissingEdge,
+					Pin:     pin,
+					Region:  region,
+					Message: fmt.Sprintf("%s lies inside %s on the map but is not linked to it by a containment edge", pin.NodeName, region.NodeName),
+				})
+			}
+		}
+
+		reported := make(map[string]bool)
+		for _, level := range levels {
+			for _, region := range level.regions {
+				if region.NodeType == string(models.NodeTypeFaction) || region.NodeID == pin.NodeID ||
+					inside[region.NodeID] || reported[region.NodeID] {
+					continue
+				}
+				if liesWithin(containers, pin.NodeID, region.NodeID) {
+					reported[region.NodeID] = true
+					conflicts = append(conflicts, models.RegionConflict{
+						Type:    models.RegionConflictOutsideRegion,
+						Pin:     pin,
+						Region:  region,
+						Message: fmt.Sprintf("%s lies within %s by its edges but outside its region on the map", pin.NodeName, region.NodeName),
+					})
+				}
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conflicts": conflicts,
+		"count":     len(conflicts),
+	})
+}
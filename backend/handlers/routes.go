@@ -20,8 +20,22 @@ func SetupRoutes(r *gin.Engine, db *database.DB) {
 		nodeGroup.PUT("/:id", nodeHandler.UpdateNode)
 		nodeGroup.PUT("/positions", nodeHandler.UpdateNodePositions)
 		nodeGroup.DELETE("/:id", nodeHandler.DeleteNode)
+		nodeGroup.GET("/:id/appearances", NewManuscriptHandler(db).GetNodeAppearances)
+		nodeGroup.GET("/:id/backlinks", nodeHandler.GetBacklinks)
+		nodeGroup.GET("/:id/aliases", nodeHandler.GetAliases)
+		nodeGroup.POST("/:id/aliases", nodeHandler.CreateAlias)
+		nodeGroup.PUT("/:id/aliases/:aliasId", nodeHandler.UpdateAlias)
+		nodeGroup.DELETE("/:id/aliases/:aliasId", nodeHandler.DeleteAlias)
+
+		mergeHandler := NewMergeHandler(db)
+		nodeGroup.POST("/merge", mergeHandler.MergeNodes)
+		nodeGroup.GET("/:id/merges", mergeHandler.GetMerges)
 	}
 
+	// Name resolution routes
+	r.GET("/resolve", NewResolveHandler(db).Resolve)
+	r.GET("/duplicates", NewMergeHandler(db).GetDuplicates)
+
 	// Edge routes
 	edgeGroup := r.Group("/edges")
 	{
@@ -29,6 +43,75 @@ func SetupRoutes(r *gin.Engine, db *database.DB) {
 		edgeGroup.GET("", edgeHandler.GetEdges)
 	}
 
+	// Event causality routes
+	eventGroup := r.Group("/events")
+	{
+		causalityHandler := NewCausalityHandler(db)
+		eventGroup.GET("/order", causalityHandler.GetOrder)
+		eventGroup.GET("/:id/causes", causalityHandler.GetCauses)
+		eventGroup.GET("/:id/consequences", causalityHandler.GetConsequences)
+	}
+
+	// Calendar routes
+	calendarGroup := r.Group("/calendar")
+	{
+		calendarHandler := NewCalendarHandler(db)
+		calendarGroup.GET("", calendarHandler.GetCalendar)
+		calendarGroup.PUT("", calendarHandler.UpdateCalendar)
+	}
+
+	// Travel mode routes
+	travelGroup := r.Group("/travelmodes")
+	{
+		travelHandler := NewTravelHandler(db)
+		travelGroup.GET("", travelHandler.GetTravelModes)
+		travelGroup.PUT("", travelHandler.UpdateTravelModes)
+	}
+
+	// World seed and weather routes
+	weatherHandler := NewWeatherHandler(db)
+	r.GET("/worldseed", weatherHandler.GetWorldSeed)
+	r.PUT("/worldseed", weatherHandler.UpdateWorldSeed)
+	r.GET("/locations/:id/weather", weatherHandler.GetWeather)
+
+	// Species and lifecycle routes
+	speciesHandler := NewSpeciesHandler(db)
+	r.GET("/species", speciesHandler.GetSpecies)
+	r.GET("/species/checks", speciesHandler.GetChecks)
+	r.GET("/characters/:id/age", speciesHandler.GetCharacterAge)
+
+	// Lore consistency rule routes
+	ruleGroup := r.Group("/rules")
+	{
+		ruleHandler := NewRuleHandler(db)
+		ruleGroup.GET("", ruleHandler.GetRules)
+		ruleGroup.GET("/findings", ruleHandler.GetFindings)
+		ruleGroup.POST("/evaluate", ruleHandler.EvaluateRules)
+		ruleGroup.GET("/:id", ruleHandler.GetRule)
+		ruleGroup.POST("", ruleHandler.CreateRule)
+		ruleGroup.PUT("/:id", ruleHandler.UpdateRule)
+		ruleGroup.DELETE("/:id", ruleHandler.DeleteRule)
+	}
+
+	// Manuscript routes
+	manuscriptGroup := r.Group("/manuscripts")
+	{
+		manuscriptHandler := NewManuscriptHandler(db)
+		manuscriptGroup.GET("", manuscriptHandler.GetManuscripts)
+		manuscriptGroup.GET("/:id", manuscriptHandler.GetManuscript)
+		manuscriptGroup.POST("", manuscriptHandler.ImportManuscript)
+		manuscriptGroup.DELETE("/:id", manuscriptHandler.DeleteManuscript)
+
+		watcher := NewManuscriptWatcher(db)
+		go watcher.Run()
+		manuscriptGroup.GET("/watch", watcher.GetWatchStatus)
+		manuscriptGroup.PUT("/watch", watcher.UpdateWatchConfig)
+		manuscriptGroup.POST("/watch/scan", watcher.ScanNow)
+	}
+
+	// Change feed routes
+	r.GET("/changes", NewChangeHandler(db).GetChanges)
+
 	// Map routes
 	mapGroup := r.Group("/map")
 	{
@@ -36,10 +119,100 @@ func SetupRoutes(r *gin.Engine, db *database.DB) {
 		mapGroup.PUT("", mapHandler.SaveMap)
 	}
 
+	// World map routes
+	tiler := NewTileGenerator(db)
+	go tiler.Run()
+	worldMapGroup := r.Group("/worldmaps")
+	{
+		worldMapHandler := NewWorldMapHandler(db, tiler)
+		worldMapGroup.GET("", worldMapHandler.GetWorldMaps)
+		worldMapGroup.POST("", worldMapHandler.CreateWorldMap)
+		worldMapGroup.POST("/generate", worldMapHandler.GenerateWorldMap)
+		worldMapGroup.GET("/:id", worldMapHandler.GetWorldMap)
+		worldMapGroup.PUT("/:id", worldMapHandler.UpdateWorldMap)
+		worldMapGroup.DELETE("/:id", worldMapHandler.DeleteWorldMap)
+		worldMapGroup.GET("/:id/image", worldMapHandler.GetWorldMapImage)
+		worldMapGroup.GET("/:id/tiles", worldMapHandler.GetTiles)
+		worldMapGroup.POST("/:id/tiles", worldMapHandler.RegenerateTiles)
+		worldMapGroup.GET("/:id/tiles/:z/:x/:y", worldMapHandler.GetTile)
+		worldMapGroup.GET("/:id/breadcrumbs", worldMapHandler.GetBreadcrumbs)
+		worldMapGroup.GET("/:id/convert", worldMapHandler.ConvertPoint)
+		worldMapGroup.PUT("/:id/scale", worldMapHandler.SetScale)
+		worldMapGroup.DELETE("/:id/scale", worldMapHandler.DeleteScale)
+		worldMapGroup.GET("/:id/distance", worldMapHandler.GetDistance)
+		worldMapGroup.GET("/:id/pins", worldMapHandler.GetPins)
+		worldMapGroup.POST("/:id/pins", worldMapHandler.CreatePin)
+		worldMapGroup.PUT("/:id/pins/:pinId", worldMapHandler.UpdatePin)
+		worldMapGroup.DELETE("/:id/pins/:pinId", worldMapHandler.DeletePin)
+		worldMapGroup.GET("/:id/routes", worldMapHandler.GetRoutes)
+		worldMapGroup.POST("/:id/routes", worldMapHandler.CreateRoute)
+		worldMapGroup.PUT("/:id/routes/:routeId", worldMapHandler.UpdateRoute)
+		worldMapGroup.DELETE("/:id/routes/:routeId", worldMapHandler.DeleteRoute)
+		worldMapGroup.GET("/:id/layers", worldMapHandler.GetLayers)
+		worldMapGroup.POST("/:id/layers", worldMapHandler.CreateLayer)
+		worldMapGroup.PUT("/:id/layers/:layerId", worldMapHandler.UpdateLayer)
+		worldMapGroup.DELETE("/:id/layers/:layerId", worldMapHandler.DeleteLayer)
+		worldMapGroup.GET("/:id/layers/:layerId/shapes", worldMapHandler.GetShapes)
+		worldMapGroup.POST("/:id/layers/:layerId/shapes", worldMapHandler.CreateShape)
+		worldMapGroup.PUT("/:id/layers/:layerId/shapes/:shapeId", worldMapHandler.UpdateShape)
+		worldMapGroup.DELETE("/:id/layers/:layerId/shapes/:shapeId", worldMapHandler.DeleteShape)
+		worldMapGroup.GET("/:id/regions", worldMapHandler.GetRegions)
+		worldMapGroup.POST("/:id/regions", worldMapHandler.CreateRegion)
+		worldMapGroup.GET("/:id/regions/check", worldMapHandler.CheckRegions)
+		worldMapGroup.PUT("/:id/regions/:regionId", worldMapHandler.UpdateRegion)
+		worldMapGroup.DELETE("/:id/regions/:regionId", worldMapHandler.DeleteRegion)
+		worldMapGroup.GET("/:id/at", worldMapHandler.GetRegionsAt)
+	}
+
+	// Campaign, fog of war and player view routes. The player view routes
+	// only ever return what the campaign's players may see.
+	campaignGroup := r.Group("/campaigns")
+	{
+		campaignHandler := NewCampaignHandler(db)
+		campaignGroup.GET("", campaignHandler.GetCampaigns)
+		campaignGroup.POST("", campaignHandler.CreateCampaign)
+		campaignGroup.GET("/:id", campaignHandler.GetCampaign)
+		campaignGroup.PUT("/:id", campaignHandler.UpdateCampaign)
+		campaignGroup.DELETE("/:id", campaignHandler.DeleteCampaign)
+		campaignGroup.GET("/:id/fog/:mapId", campaignHandler.GetFog)
+		campaignGroup.POST("/:id/fog/:mapId", campaignHandler.RevealFog)
+		campaignGroup.DELETE("/:id/fog/:mapId", campaignHandler.ResetFog)
+		campaignGroup.DELETE("/:id/fog/:mapId/:revealId", campaignHandler.DeleteReveal)
+		campaignGroup.GET("/:id/view/:mapId", campaignHandler.GetPlayerView)
+		campaignGroup.GET("/:id/view/:mapId/tiles/:z/:x/:y", campaignHandler.GetPlayerTile)
+	}
+
+	// Route network routes
+	routeHandler := NewRouteHandler(db)
+	r.GET("/routes/path", routeHandler.FindPath)
+
 	// Import routes
 	importGroup := r.Group("/import")
 	{
-		importHandler := NewImportHandler(db)
+		importHandler := NewImportHandler(db, tiler)
 		importGroup.POST("/map", importHandler.ImportMap)
+		importGroup.POST("/map/confirm", importHandler.ConfirmImport)
+		importGroup.POST("/map/stream", importHandler.StreamImport)
+		importGroup.POST("/csv", importHandler.ImportCSV)
+		importGroup.GET("/tools", importHandler.GetImportTools)
+		importGroup.POST("/tool", importHandler.ImportTool)
+		importGroup.POST("/bundle", importHandler.ImportBundle)
+		importGroup.POST("/file", importHandler.ImportFile)
+	}
+
+	// Export routes
+	exportGroup := r.Group("/export")
+	{
+		exportHandler := NewImportHandler(db, tiler)
+		exportGroup.GET("/json", exportHandler.ExportJSON)
+		exportGroup.GET("/bundle", exportHandler.ExportBundle)
+	}
+
+	// Import batch routes
+	importsGroup := r.Group("/imports")
+	{
+		importHandler := NewImportHandler(db, tiler)
+		importsGroup.GET("", importHandler.GetImports)
+		importsGroup.DELETE("/:id", importHandler.RevertImport)
 	}
 }
@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mythsmith-backend/database"
+	"mythsmith-backend/rules"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RuleHandler struct {
+	db *database.DB
+}
+
+func NewRuleHandler(db *database.DB) *RuleHandler {
+	return &RuleHandler{db: db}
+}
+
+// RuleRequest is the body for creating or updating a rule. On update only the
+// fields that are present are changed.
+type RuleRequest struct {
+	Name            *string         `json:"name"`
+	Description     *string         `json:"description"`
+	Severity        *rules.Severity `json:"severity"`
+	Message         *string         `json:"message"`
+	Spec            *rules.Spec     `json:"spec"`
+	Enabled         *bool           `json:"enabled"`
+	EvaluateOnWrite *bool           `json:"evaluateOnWrite"`
+}
+
+// StoredFinding is a finding as persisted by the last evaluation of its rule
+type StoredFinding struct {
+	ID int64 `json:"id"`
+	rules.Finding
+	NodeName  string    `json:"nodeName"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+const ruleColumns = "id, name, description, severity, message, spec, enabled, evaluate_on_write"
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRule(row rowScanner) (rules.Rule, error) {
+	var rule rules.Rule
+	var specJSON string
+	if err := row.Scan(&rule.ID, &rule.Name, &rule.Description, &rule.Severity,
+		&rule.Message, &specJSON, &rule.Enabled, &rule.EvaluateOnWrite); err != nil {
+		return rule, err
+	}
+	if err := json.Unmarshal([]byte(specJSON), &rule.Spec); err != nil {
+		return rule, fmt.Errorf("failed to parse spec of rule %s: %v", rule.ID, err)
+	}
+	return rule, nil
+}
+
+// loadRules returns enabled rules, optionally only those evaluated after writes
+func loadRules(q queryer, onWriteOnly bool) ([]rules.Rule, error) {
+	query := "SELECT " + ruleColumns + " FROM rules WHERE enabled = 1"
+	if onWriteOnly {
+		query += " AND evaluate_on_write = 1"
+	}
+	query += " ORDER BY name"
+
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []rules.Rule
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rule)
+	}
+	return result, rows.Err()
+}
+
+// evaluateRules runs the rules against the current world and replaces their
+// stored findings
+func evaluateRules(db *database.DB, ruleSet []rules.Rule) (map[string][]rules.Finding, error) {
+	nodes, err := loadNodes(db)
+	if err != nil {
+		return nil, err
+	}
+	edges, err := loadEdges(db)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := rules.EvaluateAll(ruleSet, rules.World{Nodes: nodes, Edges: edges})
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, rule := range ruleSet {
+		if _, err := tx.Exec("DELETE FROM rule_findings WHERE rule_id = ?", rule.ID); err != nil {
+			return nil, fmt.Errorf("failed to clear findings: %v", err)
+		}
+		for _, finding := range findings[rule.ID] {
+			if _, err := tx.Exec(
+				"INSERT INTO rule_findings (rule_id, node_id, severity, message, created_at) VALUES (?, ?, ?, ?, ?)",
+				finding.RuleID, finding.NodeID, finding.Severity, finding.Message, now,
+			); err != nil {
+				return nil, fmt.Errorf("failed to store finding: %v", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit findings: %v", err)
+	}
+	return findings, nil
+}
+
+// runWriteRules re-evaluates the rules flagged to run after every write.
+// Failures are logged rather than failing the write that triggered them.
+func runWriteRules(db *database.DB) {
+	ruleSet, err := loadRules(db, true)
+	if err != nil {
+		log.Printf("Failed to load write rules: %v", err)
+		return
+	}
+	if len(ruleSet) == 0 {
+		return
+	}
+	if _, err := evaluateRules(db, ruleSet); err != nil {
+		log.Printf("Failed to evaluate write rules: %v", err)
+	}
+}
+
+func (h *RuleHandler) GetRules(c *gin.Context) {
+	rows, err := h.db.Query("SELECT " + ruleColumns + " FROM rules ORDER BY name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rules"})
+		return
+	}
+	defer rows.Close()
+
+	result := []rules.Rule{}
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan rule data"})
+			return
+		}
+		result = append(result, rule)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules": result,
+		"count": len(result),
+	})
+}
+
+func (h *RuleHandler) GetRule(c *gin.Context) {
+	rule, err := scanRule(h.db.QueryRow("SELECT "+ruleColumns+" FROM rules WHERE id = ?", c.Param("id")))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rule"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *RuleHandler) CreateRule(c *gin.Context) {
+	var req RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name == nil || *req.Name == "" || req.Spec == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rule name and spec are required"})
+		return
+	}
+
+	rule := rules.Rule{
+		ID:       uuid.NewString(),
+		Name:     *req.Name,
+		Severity: rules.SeverityWarning,
+		Spec:     *req.Spec,
+		Enabled:  true,
+	}
+	applyRuleRequest(&rule, req)
+
+	if err := validateRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	specJSON, err := json.Marshal(rule.Spec)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal rule spec"})
+		return
+	}
+
+	now := time.Now()
+	_, err = h.db.Exec(`
+		INSERT INTO rules (id, name, description, severity, message, spec, enabled, evaluate_on_write, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, rule.ID, rule.Name, rule.Description, rule.Severity, rule.Message,
+		string(specJSON), rule.Enabled, rule.EvaluateOnWrite, now, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *RuleHandler) UpdateRule(c *gin.Context) {
+	id := c.Param("id")
+
+	var req RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := scanRule(h.db.QueryRow("SELECT "+ruleColumns+" FROM rules WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rule"})
+		}
+		return
+	}
+
+	before := rule
+	applyRuleRequest(&rule, req)
+	if err := validateRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	specJSON, err := json.Marshal(rule.Spec)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal rule spec"})
+		return
+	}
+
+	_, err = h.db.Exec(`
+		UPDATE rules SET name = ?, description = ?, severity = ?, message = ?, spec = ?,
+		       enabled = ?, evaluate_on_write = ?, updated_at = ?
+		WHERE id = ?
+	`, rule.Name, rule.Description, rule.Severity, rule.Message, string(specJSON),
+		rule.Enabled, rule.EvaluateOnWrite, time.Now(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rule"})
+		return
+	}
+
+	// Findings of a disabled rule would otherwise linger forever, and those of
+	// a changed rule would describe what it used to check
+	beforeSpec, _ := json.Marshal(before.Spec)
+	switch {
+	case !rule.Enabled:
+		if _, err := h.db.Exec("DELETE FROM rule_findings WHERE rule_id = ?", id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear rule findings"})
+			return
+		}
+	case string(beforeSpec) != string(specJSON) || before.Severity != rule.Severity || before.Message != rule.Message || !before.Enabled:
+		if _, err := evaluateRules(h.db, []rules.Rule{rule}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to evaluate rule: %v", err)})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *RuleHandler) DeleteRule(c *gin.Context) {
+	result, err := h.db.Exec("DELETE FROM rules WHERE id = ?", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete rule"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted successfully"})
+}
+
+// EvaluateRules runs every enabled rule, or only the one given by ?ruleId=,
+// and stores the findings
+func (h *RuleHandler) EvaluateRules(c *gin.Context) {
+	ruleSet, err := loadRules(h.db, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load rules"})
+		return
+	}
+
+	if ruleID := c.Query("ruleId"); ruleID != "" {
+		var selected []rules.Rule
+		for _, rule := range ruleSet {
+			if rule.ID == ruleID {
+				selected = append(selected, rule)
+			}
+		}
+		if len(selected) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Enabled rule not found"})
+			return
+		}
+		ruleSet = selected
+	}
+
+	findings, err := evaluateRules(h.db, ruleSet)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to evaluate rules: %v", err)})
+		return
+	}
+
+	all := []rules.Finding{}
+	for _, rule := range ruleSet {
+		all = append(all, findings[rule.ID]...)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rulesEvaluated": len(ruleSet),
+		"findings":       all,
+		"count":          len(all),
+	})
+}
+
+// GetFindings returns stored findings, filtered by ?ruleId=, ?nodeId= and ?severity=
+func (h *RuleHandler) GetFindings(c *gin.Context) {
+	query := `
+        SELECT f.id, f.rule_id, f.node_id, f.severity, f.message, n.name, f.created_at
+        FROM rule_findings f
+        JOIN nodes n ON n.id = f.node_id
+    `
+	var conditions []string
+	var args []interface{}
+	for param, column := range map[string]string{"ruleId": "f.rule_id", "nodeId": "f.node_id", "severity": "f.severity"} {
+		if value := c.Query(param); value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY f.rule_id, f.node_id"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve findings"})
+		return
+	}
+	defer rows.Close()
+
+	findings := []StoredFinding{}
+	for rows.Next() {
+		var f StoredFinding
+		if err := rows.Scan(&f.ID, &f.RuleID, &f.NodeID, &f.Severity, &f.Message, &f.NodeName, &f.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan finding data"})
+			return
+		}
+		findings = append(findings, f)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"findings": findings,
+		"count":    len(findings),
+	})
+}
+
+func applyRuleRequest(rule *rules.Rule, req RuleRequest) {
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Description != nil {
+		rule.Description = *req.Description
+	}
+	if req.Severity != nil {
+		rule.Severity = *req.Severity
+	}
+	if req.Message != nil {
+		rule.Message = *req.Message
+	}
+	if req.Spec != nil {
+		rule.Spec = *req.Spec
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if req.EvaluateOnWrite != nil {
+		rule.EvaluateOnWrite = *req.EvaluateOnWrite
+	}
+}
+
+func validateRule(rule rules.Rule) error {
+	switch rule.Severity {
+	case rules.SeverityInfo, rules.SeverityWarning, rules.SeverityError:
+	default:
+		return fmt.Errorf("unknown severity %q", rule.Severity)
+	}
+	if rule.Name == "" {
+		return fmt.Errorf("rule name is required")
+	}
+	if err := rule.Spec.Validate(); err != nil {
+		return fmt.Errorf("invalid rule spec: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mythsmith-backend/calendar"
+	"mythsmith-backend/database"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const settingCalendar = "calendar"
+
+// execer is satisfied by both *database.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// loadSetting unmarshals the JSON value stored under key into dest. It
+// reports false, leaving dest untouched, when the setting has never been saved.
+func loadSetting(q queryer, key string, dest interface{}) (bool, error) {
+	var value string
+	err := q.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read setting %s: %v", key, err)
+	}
+	if err := json.Unmarshal([]byte(value), dest); err != nil {
+		return false, fmt.Errorf("failed to parse setting %s: %v", key, err)
+	}
+	return true, nil
+}
+
+// saveSetting stores value as JSON under key
+func saveSetting(e execer, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal setting %s: %v", key, err)
+	}
+	_, err = e.Exec(`
+		INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, key, string(data), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save setting %s: %v", key, err)
+	}
+	return nil
+}
+
+// loadCalendar returns the world's calendar, or the default one if none is configured
+func loadCalendar(q queryer) (calendar.Calendar, error) {
+	cal := calendar.Default()
+	if _, err := loadSetting(q, settingCalendar, &cal); err != nil {
+		return calendar.Default(), err
+	}
+	return cal, nil
+}
+
+type CalendarHandler struct {
+	db *database.DB
+}
+
+func NewCalendarHandler(db *database.DB) *CalendarHandler {
+	return &CalendarHandler{db: db}
+}
+
+func (h *CalendarHandler) GetCalendar(c *gin.Context) {
+	cal, err := loadCalendar(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cal)
+}
+
+func (h *CalendarHandler) UpdateCalendar(c *gin.Context) {
+	var cal calendar.Calendar
+	if err := c.ShouldBindJSON(&cal); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := cal.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := saveSetting(h.db, settingCalendar, cal); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save calendar"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cal)
+}
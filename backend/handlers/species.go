@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"fmt"
+	"mythsmith-backend/calendar"
+	"mythsmith-backend/database"
+	"mythsmith-backend/models"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SpeciesHandler struct {
+	db *database.DB
+}
+
+func NewSpeciesHandler(db *database.DB) *SpeciesHandler {
+	return &SpeciesHandler{db: db}
+}
+
+// lifeRecord gathers what is known about a character's lifetime
+type lifeRecord struct {
+	node    *models.Node
+	species *models.Species
+	birth   *calendar.Date
+	death   *calendar.Date
+}
+
+// lifeIndex is built from a world snapshot for the age and lineage checks
+type lifeIndex struct {
+	cal     calendar.Calendar
+	records map[string]*lifeRecord
+	parents map[string][]string // child -> parents
+}
+
+func loadLifeIndex(q queryer) (*lifeIndex, error) {
+	cal, err := loadCalendar(q)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := loadNodes(q)
+	if err != nil {
+		return nil, err
+	}
+	edges, err := loadEdges(q)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &lifeIndex{
+		cal:     cal,
+		records: make(map[string]*lifeRecord),
+		parents: make(map[string][]string),
+	}
+
+	byID := make(map[string]*models.Node, len(nodes))
+	species := make(map[string]*models.Species)
+	for i := range nodes {
+		node := &nodes[i]
+		byID[node.ID] = node
+		switch node.Type {
+		case models.NodeTypeSpecies:
+			s := models.SpeciesFromNode(node)
+			species[node.ID] = &s
+		case models.NodeTypeCharacter:
+			record := &lifeRecord{node: node}
+			// Explicit dates on the character are used when no event is linked
+			record.birth = idx.parseDate(node.Properties["birthDate"])
+			record.death = idx.parseDate(node.Properties["deathDate"])
+			idx.records[node.ID] = record
+		}
+	}
+
+	for _, edge := range edges {
+		switch edge.Relationship {
+		case models.RelationshipSpecies:
+			if record, ok := idx.records[edge.SourceNodeID]; ok && species[edge.TargetNodeID] != nil {
+				record.species = species[edge.TargetNodeID]
+			}
+		case models.RelationshipBirth, models.RelationshipDeath:
+			record, event := idx.records[edge.SourceNodeID], byID[edge.TargetNodeID]
+			if record == nil {
+				record, event = idx.records[edge.TargetNodeID], byID[edge.SourceNodeID]
+			}
+			if record == nil || event == nil || event.Type != models.NodeTypeEvent {
+				continue
+			}
+			if date := idx.parseDate(event.Properties["date"]); date != nil {
+				if edge.Relationship == models.RelationshipBirth {
+					record.birth = date
+				} else {
+					record.death = date
+				}
+			}
+		case models.RelationshipParent:
+			if idx.records[edge.SourceNodeID] != nil && idx.records[edge.TargetNodeID] != nil {
+				idx.parents[edge.TargetNodeID] = append(idx.parents[edge.TargetNodeID], edge.SourceNodeID)
+			}
+		}
+	}
+
+	return idx, nil
+}
+
+func (idx *lifeIndex) parseDate(value interface{}) *calendar.Date {
+	text, ok := value.(string)
+	if !ok || text == "" {
+		return nil
+	}
+	date, err := idx.cal.Parse(text)
+	if err != nil {
+		return nil
+	}
+	return &date
+}
+
+// ageAt computes a character's age, preferring dates over the stored age property
+func (idx *lifeIndex) ageAt(record *lifeRecord, at *calendar.Date) models.CharacterAge {
+	result := models.CharacterAge{
+		CharacterID: record.node.ID,
+		Name:        record.node.Name,
+		Species:     record.species,
+		Alive:       true,
+		Issues:      []string{},
+	}
+	if record.birth != nil {
+		result.BirthDate = idx.cal.Format(*record.birth)
+	}
+	if record.death != nil {
+		result.DeathDate = idx.cal.Format(*record.death)
+	}
+
+	// Without a reference date the age at death is the most useful answer
+	if at == nil && record.death != nil {
+		at = record.death
+	}
+
+	if record.birth != nil && at != nil {
+		result.At = idx.cal.Format(*at)
+		result.Source = "calendar"
+		result.Age = idx.cal.YearsBetween(*record.birth, *at)
+		if result.Age < 0 {
+			result.Issues = append(result.Issues, "Date is before the character's birth")
+		}
+		if record.death != nil && idx.cal.DayNumber(*at) >= idx.cal.DayNumber(*record.death) {
+			result.Alive = false
+			result.Age = idx.cal.YearsBetween(*record.birth, *record.death)
+		}
+	} else {
+		result.Source = "property"
+		result.Age = int(record.node.Properties.Number("age"))
+		result.Alive = record.death == nil
+	}
+
+	if record.species != nil && record.species.Lifespan > 0 && float64(result.Age) > record.species.Lifespan {
+		result.Issues = append(result.Issues, fmt.Sprintf("Age %d exceeds the %s lifespan of %g",
+			result.Age, record.species.Name, record.species.Lifespan))
+	}
+
+	return result
+}
+
+// checks returns every implausible age and parent/child gap in the world
+func (idx *lifeIndex) checks() []models.LifecycleIssue {
+	issues := []models.LifecycleIssue{}
+
+	ids := make([]string, 0, len(idx.records))
+	for id := range idx.records {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		record := idx.records[id]
+		for _, problem := range idx.ageAt(record, nil).Issues {
+			issues = append(issues, models.LifecycleIssue{Kind: "age", NodeID: id, Message: problem})
+		}
+
+		child := record
+		for _, parentID := range idx.parents[id] {
+			parent := idx.records[parentID]
+			if parent.birth == nil || child.birth == nil {
+				continue
+			}
+			issue := func(kind, format string, args ...interface{}) {
+				issues = append(issues, models.LifecycleIssue{
+					Kind:          kind,
+					NodeID:        parentID,
+					RelatedNodeID: id,
+					Message:       fmt.Sprintf(format, args...),
+				})
+			}
+
+			gap := idx.cal.YearsBetween(*parent.birth, *child.birth)
+			if idx.cal.DayNumber(*parent.birth) > idx.cal.DayNumber(*child.birth) {
+				issue("lineage", "%s was born after their child %s", parent.node.Name, child.node.Name)
+				continue
+			}
+
+			if parent.death != nil && idx.cal.YearsBetween(*parent.death, *child.birth) >= 1 {
+				issue("lineage", "%s died more than a year before their child %s was born",
+					parent.node.Name, child.node.Name)
+			}
+
+			if parent.species == nil {
+				continue
+			}
+			start, end := parent.species.FertileRange()
+			if start > 0 && float64(gap) < start {
+				issue("lineage", "%s was %d at the birth of %s, younger than the %s fertility age of %g",
+					parent.node.Name, gap, child.node.Name, parent.species.Name, start)
+			}
+			if end > 0 && float64(gap) > end {
+				issue("lineage", "%s was %d at the birth of %s, older than the %s fertility limit of %g",
+					parent.node.Name, gap, child.node.Name, parent.species.Name, end)
+			}
+		}
+	}
+
+	return issues
+}
+
+// GetSpecies lists species nodes with their lifecycle properties
+func (h *SpeciesHandler) GetSpecies(c *gin.Context) {
+	nodes, err := loadNodes(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve species"})
+		return
+	}
+
+	species := []models.Species{}
+	for i := range nodes {
+		if nodes[i].Type == models.NodeTypeSpecies {
+			species = append(species, models.SpeciesFromNode(&nodes[i]))
+		}
+	}
+	sort.Slice(species, func(i, j int) bool { return species[i].Name < species[j].Name })
+
+	c.JSON(http.StatusOK, gin.H{
+		"species": species,
+		"count":   len(species),
+	})
+}
+
+// GetCharacterAge computes a character's age at ?at= from their birth event
+// and the world calendar
+func (h *SpeciesHandler) GetCharacterAge(c *gin.Context) {
+	idx, err := loadLifeIndex(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load characters"})
+		return
+	}
+
+	record, ok := idx.records[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Character not found"})
+		return
+	}
+
+	var at *calendar.Date
+	if text := c.Query("at"); text != "" {
+		date, err := idx.cal.Parse(text)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		at = &date
+	}
+
+	c.JSON(http.StatusOK, idx.ageAt(record, at))
+}
+
+// GetChecks flags ages beyond a species' lifespan and impossible parent/child
+// age gaps in the lineage graph
+func (h *SpeciesHandler) GetChecks(c *gin.Context) {
+	idx, err := loadLifeIndex(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load characters"})
+		return
+	}
+
+	issues := idx.checks()
+	c.JSON(http.StatusOK, gin.H{
+		"issues": issues,
+		"count":  len(issues),
+	})
+}
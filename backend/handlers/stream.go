@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Nodes or edges decoded before they are written and progress is reported
+const importChunkSize = 500
+
+// importStream decodes an import request body piece by piece, so a world
+// file never has to be held in memory as a whole
+type importStream struct {
+	h   *ImportHandler
+	c   *gin.Context
+	dec *json.Decoder
+	req ImportRequest
+
+	session      *importSession
+	nodesRead    int
+	edgesRead    int
+	pendingEdges []map[string]interface{} // Edges that came before the nodes
+}
+
+// expectDelim reads the next token and fails unless it is the given delimiter
+func (st *importStream) expectDelim(want json.Delim) error {
+	tok, err := st.dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q, got %v", want, tok)
+	}
+	return nil
+}
+
+// key reads an object key, or returns "" at the end of the object
+func (st *importStream) key() (string, error) {
+	if !st.dec.More() {
+		return "", st.expectDelim('}')
+	}
+	tok, err := st.dec.Token()
+	if err != nil {
+		return "", err
+	}
+	k, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("expected an object key, got %v", tok)
+	}
+	return k, nil
+}
+
+func (st *importStream) progress(phase string) {
+	st.c.SSEvent("progress", gin.H{
+		"phase":          phase,
+		"nodesProcessed": st.nodesRead,
+		"edgesProcessed": st.edgesRead,
+	})
+	st.c.Writer.Flush()
+}
+
+// readData streams the "data" object, writing nodes and edges in chunks
+func (st *importStream) readData() error {
+	if err := st.expectDelim('{'); err != nil {
+		return importRejected("Invalid data: %v", err)
+	}
+	nodesSeen := false
+	for {
+		k, err := st.key()
+		if err != nil {
+			return importRejected("Invalid data: %v", err)
+		}
+		switch k {
+		case "":
+			// Edges listed before the nodes could not be checked until now
+			for len(st.pendingEdges) > 0 {
+				n := min(importChunkSize, len(st.pendingEdges))
+				if err := st.h.processEdges(st.session, st.pendingEdges[:n]); err != nil {
+					return importFailed("Failed to process edges: %v", err)
+				}
+				st.pendingEdges = st.pendingEdges[n:]
+				st.progress("edges")
+			}
+			return nil
+		case "nodes":
+			nodesSeen = true
+			if err := st.readNodes(); err != nil {
+				return err
+			}
+		case "edges":
+			if err := st.readEdges(!nodesSeen); err != nil {
+				return err
+			}
+		default:
+			var skip json.RawMessage
+			if err := st.dec.Decode(&skip); err != nil {
+				return importRejected("Invalid data: %v", err)
+			}
+		}
+	}
+}
+
+func (st *importStream) readNodes() error {
+	if err := st.expectDelim('['); err != nil {
+		return importRejected("Invalid nodes: %v", err)
+	}
+	chunk := make([]ImportNode, 0, importChunkSize)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		if err := st.h.processNodes(st.session, chunk); err != nil {
+			return importFailed("Failed to process nodes: %v", err)
+		}
+		chunk = chunk[:0]
+		st.progress("nodes")
+		return nil
+	}
+
+	for st.dec.More() {
+		var node ImportNode
+		if err := st.dec.Decode(&node); err != nil {
+			return importRejected("Invalid node at index %d: %v", st.nodesRead, err)
+		}
+		chunk = append(chunk, node)
+		st.nodesRead++
+		if len(chunk) == importChunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := st.expectDelim(']'); err != nil {
+		return importRejected("Invalid nodes: %v", err)
+	}
+	return flush()
+}
+
+// readEdges writes edges in chunks, or holds them back when hold is set
+// because the nodes they refer to have not been read yet
+func (st *importStream) readEdges(hold bool) error {
+	if err := st.expectDelim('['); err != nil {
+		return importRejected("Invalid edges: %v", err)
+	}
+	chunk := make([]map[string]interface{}, 0, importChunkSize)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		if err := st.h.processEdges(st.session, chunk); err != nil {
+			return importFailed("Failed to process edges: %v", err)
+		}
+		chunk = chunk[:0]
+		st.progress("edges")
+		return nil
+	}
+
+	for st.dec.More() {
+		var edge map[string]interface{}
+		if err := st.dec.Decode(&edge); err != nil {
+			return importRejected("Invalid edge at index %d: %v", st.edgesRead, err)
+		}
+		st.edgesRead++
+		if hold {
+			st.pendingEdges = append(st.pendingEdges, edge)
+			continue
+		}
+		chunk = append(chunk, edge)
+		if len(chunk) == importChunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := st.expectDelim(']'); err != nil {
+		return importRejected("Invalid edges: %v", err)
+	}
+	return flush()
+}
+
+// importRejected is an import that fails because of the request itself
+func importRejected(format string, args ...interface{}) *importError {
+	return &importError{status: http.StatusBadRequest, body: gin.H{"error": fmt.Sprintf(format, args...)}}
+}
+
+// StreamImport imports a request body of the same shape as ImportMap, but
+// decodes and writes it incrementally and reports progress as Server-Sent
+// Events: "start", "progress" after every chunk, then "complete" with the
+// import response or "error". ?strategy= and ?source= may replace the body
+// fields, which must otherwise come before "data". As with ImportMap, the
+// import runs in one transaction and nothing is kept if it fails.
+func (h *ImportHandler) StreamImport(c *gin.Context) {
+	// Progress is written while the body is still being read
+	if err := http.NewResponseController(c.Writer).EnableFullDuplex(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming is not supported by this connection"})
+		return
+	}
+
+	st := &importStream{h: h, c: c, dec: json.NewDecoder(c.Request.Body)}
+	st.req.Strategy = c.Query("strategy")
+	st.req.Source = c.Query("source")
+
+	started := false
+	fail := func(err error) {
+		if !started {
+			writeImportError(c, err)
+			return
+		}
+		body := gin.H{"status": http.StatusInternalServerError}
+		if ie, ok := err.(*importError); ok {
+			body["status"] = ie.status
+			for k, v := range ie.body {
+				body[k] = v
+			}
+		} else {
+			body["error"] = err.Error()
+		}
+		c.SSEvent("error", body)
+		c.Writer.Flush()
+	}
+
+	if err := st.expectDelim('{'); err != nil {
+		fail(importRejected("Invalid request format: %v", err))
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		fail(importFailed("Failed to start transaction"))
+		return
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for {
+		k, err := st.key()
+		if err != nil {
+			fail(importRejected("Invalid request format: %v", err))
+			return
+		}
+		if k == "" {
+			break
+		}
+
+		switch {
+		case k == "data" && st.session == nil:
+			if err := normalizeImportOptions(&st.req); err != nil {
+				fail(importRejected("%v", err))
+				return
+			}
+			st.session = newImportSession(tx, st.req.Strategy, time.Now())
+			st.session.fieldPrecedence = st.req.FieldPrecedence
+			if err := h.beginImport(st.session, st.req.Source); err != nil {
+				fail(err)
+				return
+			}
+			c.SSEvent("start", gin.H{"batchId": st.session.batchID, "strategy": st.req.Strategy})
+			c.Writer.Flush()
+			started = true
+
+			if err := st.readData(); err != nil {
+				fail(err)
+				return
+			}
+		case st.session != nil:
+			fail(importRejected("%q must come before \"data\"", k))
+			return
+		case k == "strategy" && c.Query("strategy") == "":
+			err = st.dec.Decode(&st.req.Strategy)
+		case k == "source" && c.Query("source") == "":
+			err = st.dec.Decode(&st.req.Source)
+		case k == "fieldPrecedence":
+			err = st.dec.Decode(&st.req.FieldPrecedence)
+		default:
+			var skip json.RawMessage
+			err = st.dec.Decode(&skip)
+		}
+		if err != nil {
+			fail(importRejected("Invalid %s: %v", k, err))
+			return
+		}
+	}
+	if _, err := st.dec.Token(); err != io.EOF {
+		fail(importRejected("Unexpected data after the request object"))
+		return
+	}
+
+	if st.session == nil || st.nodesRead+st.edgesRead == 0 {
+		fail(importRejected("No data to import"))
+		return
+	}
+	if err := h.finishImport(st.session); err != nil {
+		fail(err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fail(importFailed("Failed to commit transaction"))
+		return
+	}
+	tx = nil // Prevent rollback in defer
+
+	runWriteRules(h.db)
+
+	response := st.session.response
+	response.Message = importMessage(response)
+	c.SSEvent("complete", response)
+	c.Writer.Flush()
+}
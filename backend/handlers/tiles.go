@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"mythsmith-backend/database"
+	"mythsmith-backend/models"
+	"mythsmith-backend/tiles"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tile pyramids are derived from the map images, so they live outside the
+// asset directory and are left out of bundles
+const tileDir = "data/tiles"
+
+// Largest map image accepted, in pixels, so a decoded image fits in memory
+const maxMapPixels = 16384 * 16384
+
+// How often a running job writes its progress
+const tileProgressInterval = 250 * time.Millisecond
+
+// errTileJobStopped ends a job whose map was deleted or queued again
+var errTileJobStopped = errors.New("tile job stopped")
+
+// TileGenerator builds tile pyramids in the background, one map at a time.
+// The queue is the world_maps table: pending maps, and maps uploaded before
+// tiling existed, are picked up oldest first.
+type TileGenerator struct {
+	db   *database.DB
+	wake chan struct{}
+}
+
+func NewTileGenerator(db *database.DB) *TileGenerator {
+	return &TileGenerator{db: db, wake: make(chan struct{}, 1)}
+}
+
+// Wake tells the worker a map was queued
+func (g *TileGenerator) Wake() {
+	select {
+	case g.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Queue marks a map for tiling. A job already running for the map stops at
+// its next progress report and starts over.
+func (g *TileGenerator) Queue(id string) error {
+	_, err := g.db.Exec("UPDATE world_maps SET tile_status = ?, tiles_done = 0, tile_error = '' WHERE id = ?",
+		models.TileStatusPending, id)
+	if err != nil {
+		return err
+	}
+	g.Wake()
+	return nil
+}
+
+// Run works through the queue forever. Jobs interrupted by a restart start
+// over.
+func (g *TileGenerator) Run() {
+	if _, err := g.db.Exec("UPDATE world_maps SET tile_status = ? WHERE tile_status = ?",
+		models.TileStatusPending, models.TileStatusRunning); err != nil {
+		log.Printf("Failed to requeue tile jobs: %v", err)
+	}
+	if leftovers, err := filepath.Glob(filepath.Join(tileDir, ".*")); err == nil {
+		for _, dir := range leftovers {
+			os.RemoveAll(dir)
+		}
+	}
+
+	for {
+		var id string
+		err := g.db.QueryRow(`
+			SELECT id FROM world_maps WHERE COALESCE(tile_status, '') IN ('', ?)
+			ORDER BY created_at, id LIMIT 1
+		`, models.TileStatusPending).Scan(&id)
+		if err == sql.ErrNoRows {
+			<-g.wake
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to read tile queue: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		g.generate(id)
+	}
+}
+
+// generate builds a map's tile pyramid in a hidden directory and swaps it in
+// when every tile is written, so the old tiles are served until then
+func (g *TileGenerator) generate(id string) {
+	var imagePath string
+	var width, height int
+	err := g.db.QueryRow("SELECT image_path, width, height FROM world_maps WHERE id = ?", id).Scan(&imagePath, &width, &height)
+	if err != nil {
+		log.Printf("Failed to load world map %s for tiling: %v", id, err)
+		return
+	}
+	result, err := g.db.Exec(`
+		UPDATE world_maps SET tile_status = ?, tiles_done = 0, tiles_total = ?, tile_max_zoom = ?, tile_error = ''
+		WHERE id = ? AND COALESCE(tile_status, '') IN ('', ?)
+	`, models.TileStatusRunning, tiles.Count(width, height), tiles.MaxZoom(width, height), id, models.TileStatusPending)
+	if err != nil {
+		log.Printf("Failed to start tile job for world map %s: %v", id, err)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return
+	}
+
+	maxZoom, err := g.build(id, imagePath)
+	if err == nil {
+		result, err = g.db.Exec("UPDATE world_maps SET tile_status = ?, tile_max_zoom = ? WHERE id = ? AND tile_status = ?",
+			models.TileStatusDone, maxZoom, id, models.TileStatusRunning)
+		if err == nil {
+			if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+				err = errTileJobStopped
+			}
+		}
+	}
+	if err == errTileJobStopped {
+		// Remove the tiles of a map deleted while they were being built
+		var exists bool
+		if g.db.QueryRow("SELECT EXISTS(SELECT 1 FROM world_maps WHERE id = ?)", id).Scan(&exists); !exists {
+			os.RemoveAll(filepath.Join(tileDir, id))
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to tile world map %s: %v", id, err)
+		g.db.Exec("UPDATE world_maps SET tile_status = ?, tile_error = ? WHERE id = ? AND tile_status = ?",
+			models.TileStatusFailed, err.Error(), id, models.TileStatusRunning)
+	}
+}
+
+func (g *TileGenerator) build(id, imagePath string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(assetDir, filepath.FromSlash(imagePath)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read map image: %v", err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode map image: %v", err)
+	}
+
+	if err := os.MkdirAll(tileDir, 0o755); err != nil {
+		return 0, err
+	}
+	staging, err := os.MkdirTemp(tileDir, "."+id+"-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(staging)
+
+	var lastReport time.Time
+	maxZoom, err := tiles.Generate(img, staging, func(done, total int) error {
+		if done < total && time.Since(lastReport) < tileProgressInterval {
+			return nil
+		}
+		lastReport = time.Now()
+		result, err := g.db.Exec("UPDATE world_maps SET tiles_done = ? WHERE id = ? AND tile_status = ?",
+			done, id, models.TileStatusRunning)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return errTileJobStopped
+		}
+		return nil
+	})
+	if err != nil {
+		return maxZoom, err
+	}
+
+	dest := filepath.Join(tileDir, id)
+	if err := os.RemoveAll(dest); err != nil {
+		return maxZoom, err
+	}
+	return maxZoom, os.Rename(staging, dest)
+}
+
+// GetTiles reports the map's tile pyramid and the progress of its job
+func (h *WorldMapHandler) GetTiles(c *gin.Context) {
+	m, ok := h.loadWorldMap(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, m.Tiles)
+}
+
+// RegenerateTiles queues the map to have its tile pyramid built again
+func (h *WorldMapHandler) RegenerateTiles(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.loadWorldMap(c, id); !ok {
+		return
+	}
+	if err := h.tiler.Queue(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue tile generation"})
+		return
+	}
+
+	m, ok := h.loadWorldMap(c, id)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusAccepted, m.Tiles)
+}
+
+// GetTile serves one 256x256 PNG tile. Clients revalidate cached tiles
+// against their ETag on every use, since it changes when the pyramid is
+// rebuilt.
+func (h *WorldMapHandler) GetTile(c *gin.Context) {
+	var coords [3]int
+	for i, value := range []string{c.Param("z"), c.Param("x"), strings.TrimSuffix(c.Param("y"), ".png")} {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tile coordinates must be non-negative integers"})
+			return
+		}
+		coords[i] = n
+	}
+
+	id := c.Param("id")
+	if strings.ContainsAny(id, `/\.`) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tile not found"})
+		return
+	}
+	file := tiles.Path(filepath.Join(tileDir, id), coords[0], coords[1], coords[2])
+	info, err := os.Stat(file)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tile not found"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	c.Header("Content-Type", "image/png")
+	c.File(file)
+}
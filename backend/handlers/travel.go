@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"mythsmith-backend/database"
+	"mythsmith-backend/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const settingTravelModes = "travelModes"
+
+// loadTravelModes returns the world's travel modes, or the defaults if none
+// are configured
+func loadTravelModes(q queryer) ([]models.TravelMode, error) {
+	modes := models.DefaultTravelModes()
+	if _, err := loadSetting(q, settingTravelModes, &modes); err != nil {
+		return models.DefaultTravelModes(), err
+	}
+	return modes, nil
+}
+
+func validUnit(unit string) bool {
+	return unit == models.UnitMiles || unit == models.UnitKilometers
+}
+
+// convertDistance converts a distance between miles and kilometres
+func convertDistance(distance float64, from, to string) float64 {
+	switch {
+	case from == models.UnitMiles && to == models.UnitKilometers:
+		return distance * models.KilometersPerMile
+	case from == models.UnitKilometers && to == models.UnitMiles:
+		return distance / models.KilometersPerMile
+	}
+	return distance
+}
+
+// mapScale returns the map's scale. A map without one inherits the scale of
+// its closest calibrated ancestor, stretched by the rectangle each child
+// covers on its parent. It returns nil when no map on the path is calibrated.
+func mapScale(q queryer, id string) (*models.MapScale, error) {
+	chain, err := mapChain(q, id)
+	if err != nil {
+		return nil, err
+	}
+	// Child pixels per ancestor pixel
+	factor := 1.0
+	for i := len(chain) - 1; i >= 0; i-- {
+		m := chain[i]
+		if m.Scale != nil {
+			scale := *m.Scale
+			scale.PixelsPerUnit *= factor
+			if i != len(chain)-1 {
+				scale.InheritedFrom = m.ID
+			}
+			return &scale, nil
+		}
+		if m.Bounds == nil {
+			break
+		}
+		factor *= float64(m.Width) / m.Bounds.Width
+	}
+	return nil, nil
+}
+
+// SetScale calibrates a map from a known distance between two points on it
+func (h *WorldMapHandler) SetScale(c *gin.Context) {
+	id := c.Param("id")
+	var req models.MapScaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Unit = strings.ToLower(strings.TrimSpace(req.Unit))
+	if !validUnit(req.Unit) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unit must be %q or %q", models.UnitMiles, models.UnitKilometers)})
+		return
+	}
+	if req.Distance <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "distance must be positive"})
+		return
+	}
+	pixels := math.Hypot(req.To.X-req.From.X, req.To.Y-req.From.Y)
+	if pixels == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be different points"})
+		return
+	}
+	if _, ok := h.loadWorldMap(c, id); !ok {
+		return
+	}
+
+	_, err := h.db.Exec("UPDATE world_maps SET pixels_per_unit = ?, scale_unit = ?, updated_at = ? WHERE id = ?",
+		pixels/req.Distance, req.Unit, time.Now(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save map scale"})
+		return
+	}
+
+	m, ok := h.loadWorldMap(c, id)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// DeleteScale removes a map's own scale, so it inherits one again
+func (h *WorldMapHandler) DeleteScale(c *gin.Context) {
+	result, err := h.db.Exec("UPDATE world_maps SET pixels_per_unit = NULL, scale_unit = NULL, updated_at = ? WHERE id = ?",
+		time.Now(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete map scale"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "World map not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Map scale deleted successfully"})
+}
+
+// GetDistance returns the straight-line distance between the pins ?from= and
+// ?to= on a map, with the travel time in each travel mode, or only in ?mode=
+func (h *WorldMapHandler) GetDistance(c *gin.Context) {
+	id := c.Param("id")
+	if c.Query("from") == "" || c.Query("to") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to pin IDs are required"})
+		return
+	}
+	if _, ok := h.loadWorldMap(c, id); !ok {
+		return
+	}
+
+	var pins [2]models.MapPin
+	for i, pinID := range []string{c.Query("from"), c.Query("to")} {
+		pin, err := h.loadPin(id, pinID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Pin %s is not on this map", pinID)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pin"})
+			return
+		}
+		pins[i] = pin
+	}
+
+	scale, err := mapScale(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve parent maps"})
+		return
+	}
+	if scale == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Map has no scale; calibrate it or a parent map by measuring a known distance"})
+		return
+	}
+
+	modes, err := loadTravelModes(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load travel modes"})
+		return
+	}
+	if mode := c.Query("mode"); mode != "" {
+		var selected []models.TravelMode
+		for _, m := range modes {
+			if strings.EqualFold(m.Name, mode) {
+				selected = append(selected, m)
+			}
+		}
+		if len(selected) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown travel mode %q", mode)})
+			return
+		}
+		modes = selected
+	}
+	cal, err := loadCalendar(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return
+	}
+
+	pixels := math.Hypot(pins[1].X-pins[0].X, pins[1].Y-pins[0].Y)
+	result := models.MapDistance{
+		MapID:    id,
+		From:     pins[0],
+		To:       pins[1],
+		Pixels:   pixels,
+		Distance: pixels / scale.PixelsPerUnit,
+		Unit:     scale.Unit,
+		Scale:    *scale,
+		Travel:   make([]models.TravelEstimate, 0, len(modes)),
+	}
+	for _, mode := range modes {
+		days := convertDistance(result.Distance, scale.Unit, mode.Unit) / (mode.Speed * mode.HoursPerDay)
+		result.Travel = append(result.Travel, models.TravelEstimate{
+			Mode:     mode.Name,
+			Days:     days,
+			Duration: cal.Duration(days),
+		})
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+type TravelHandler struct {
+	db *database.DB
+}
+
+func NewTravelHandler(db *database.DB) *TravelHandler {
+	return &TravelHandler{db: db}
+}
+
+func (h *TravelHandler) GetTravelModes(c *gin.Context) {
+	modes, err := loadTravelModes(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load travel modes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"travelModes": modes,
+		"count":       len(modes),
+	})
+}
+
+// UpdateTravelModes replaces the world's travel modes
+func (h *TravelHandler) UpdateTravelModes(c *gin.Context) {
+	var req struct {
+		TravelModes []models.TravelMode `json:"travelModes" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	seen := make(map[string]bool)
+	for i := range req.TravelModes {
+		mode := &req.TravelModes[i]
+		mode.Name = strings.TrimSpace(mode.Name)
+		mode.Unit = strings.ToLower(strings.TrimSpace(mode.Unit))
+		if mode.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("travel mode %d has no name", i+1)})
+			return
+		}
+		if seen[strings.ToLower(mode.Name)] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("travel mode %s is listed twice", mode.Name)})
+			return
+		}
+		seen[strings.ToLower(mode.Name)] = true
+		if !validUnit(mode.Unit) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("travel mode %s: unit must be %q or %q", mode.Name, models.UnitMiles, models.UnitKilometers)})
+			return
+		}
+		for _, terrain := range mode.Terrains {
+			if !validTerrain(terrain) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("travel mode %s: unknown terrain %q", mode.Name, terrain)})
+				return
+			}
+		}
+		if mode.Speed <= 0 || mode.HoursPerDay <= 0 || mode.HoursPerDay > 24 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("travel mode %s needs a positive speed and up to 24 hours per day", mode.Name)})
+			return
+		}
+	}
+
+	if err := saveSetting(h.db, settingTravelModes, req.TravelModes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save travel modes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"travelModes": req.TravelModes,
+		"count":       len(req.TravelModes),
+	})
+}
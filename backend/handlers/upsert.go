@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mythsmith-backend/models"
+	"reflect"
+)
+
+// Import strategies
+const (
+	strategyReplace         = "replace"          // Clear the world, then insert everything
+	strategyMerge           = "merge"            // Insert everything, renaming clashing IDs
+	strategyUpsert          = "upsert"           // Update matching records, insert the rest
+	strategySkipExisting    = "skip-existing"    // Leave matching records alone, insert the rest
+	strategyOverwriteFields = "overwrite-fields" // Update matching records field by field
+)
+
+// Field precedence values for the overwrite-fields strategy
+const (
+	precedenceImport   = "import"
+	precedenceExisting = "existing"
+)
+
+// matchesExisting reports whether the strategy looks up records already in
+// the world instead of always inserting
+func matchesExisting(strategy string) bool {
+	return strategy == strategyUpsert || strategy == strategySkipExisting || strategy == strategyOverwriteFields
+}
+
+// existingRecords finds stored nodes or edges that an imported record
+// corresponds to: by ID, by the originalId an earlier import stored, or for
+// edges by endpoints and relationship
+type existingRecords struct {
+	ids        map[string]bool
+	byOriginal map[string]string
+	byKey      map[string]string
+}
+
+func edgeKey(source, target, relationship string) string {
+	return source + "\x00" + target + "\x00" + relationship
+}
+
+func loadExistingRecords(q queryer, table string) (*existingRecords, error) {
+	query := "SELECT id, '', '', '', COALESCE(properties, '{}') FROM nodes"
+	if table == "edges" {
+		query = "SELECT id, source_node_id, target_node_id, COALESCE(relationship, ''), COALESCE(properties, '{}') FROM edges"
+	}
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query existing %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	r := &existingRecords{ids: make(map[string]bool), byOriginal: make(map[string]string), byKey: make(map[string]string)}
+	for rows.Next() {
+		var id, source, target, relationship, propertiesJSON string
+		if err := rows.Scan(&id, &source, &target, &relationship, &propertiesJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan existing %s: %v", table, err)
+		}
+		var props map[string]interface{}
+		json.Unmarshal([]byte(propertiesJSON), &props)
+		originalID, _ := props["originalId"].(string)
+		r.add(id, originalID, source, target, relationship)
+	}
+	return r, rows.Err()
+}
+
+func (r *existingRecords) add(id, originalID, source, target, relationship string) {
+	r.ids[id] = true
+	if originalID != "" && originalID != id {
+		if _, taken := r.byOriginal[originalID]; !taken {
+			r.byOriginal[originalID] = id
+		}
+	}
+	if source != "" {
+		r.byKey[edgeKey(source, target, relationship)] = id
+	}
+}
+
+// match returns the stored ID for an imported ID, or "" when there is none
+func (r *existingRecords) match(id string) string {
+	if id == "" {
+		return ""
+	}
+	if r.ids[id] {
+		return id
+	}
+	return r.byOriginal[id]
+}
+
+// precedence says whether the imported or the stored value of a field wins
+func (s *importSession) precedence(field string) string {
+	if s.strategy != strategyOverwriteFields {
+		return precedenceImport
+	}
+	if p, ok := s.fieldPrecedence[field]; ok {
+		return p
+	}
+	if p, ok := s.fieldPrecedence["*"]; ok {
+		return p
+	}
+	return precedenceImport
+}
+
+func (s *importSession) takesImported(field string) bool {
+	return s.precedence(field) == precedenceImport
+}
+
+// mergeImportedProperties applies imported properties over stored ones under
+// the session's precedence. Bookkeeping keys keep their stored values.
+func (s *importSession) mergeImportedProperties(stored, imported map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(stored))
+	for k, v := range stored {
+		merged[k] = v
+	}
+	for k, v := range imported {
+		if mergeBookkeeping[k] {
+			if _, ok := merged[k]; ok {
+				continue
+			}
+		}
+		if _, ok := merged[k]; !ok || s.takesImported(k) {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// updateExistingNode applies an imported node to the stored node it matched
+func (h *ImportHandler) updateExistingNode(s *importSession, storedID string, importNode ImportNode) error {
+	if storedID != importNode.ID {
+		s.nodeIDs[importNode.ID] = storedID
+	}
+	if tempID, ok := importNode.Data.Properties["tempId"].(string); ok {
+		s.tempIDs[tempID] = storedID
+	}
+	if s.strategy == strategySkipExisting {
+		s.response.NodesSkipped++
+		return nil
+	}
+
+	existing, err := loadNode(s.tx, storedID)
+	if err != nil {
+		return fmt.Errorf("failed to load node %s: %v", storedID, err)
+	}
+	updated := existing
+
+	data := importNode.Data
+	if data.Name != "" && s.takesImported("name") {
+		updated.Name = data.Name
+	}
+	if data.Type != "" && s.takesImported("type") {
+		updated.Type = models.NodeType(data.Type)
+	}
+	if data.Description != "" && s.takesImported("description") {
+		updated.Description = data.Description
+	}
+	if data.ConnectionDirection != "" && s.takesImported("connectionDirection") {
+		updated.ConnectionDirection = models.ConnectionDirection(data.ConnectionDirection)
+	}
+	if s.takesImported("position") {
+		updated.X, updated.Y = importNode.Position.X, importNode.Position.Y
+	}
+	updated.Properties = s.mergeImportedProperties(existing.Properties, data.Properties)
+
+	if updated.Name == existing.Name && updated.Type == existing.Type &&
+		updated.Description == existing.Description && updated.ConnectionDirection == existing.ConnectionDirection &&
+		updated.X == existing.X && updated.Y == existing.Y &&
+		reflect.DeepEqual(map[string]interface{}(updated.Properties), map[string]interface{}(existing.Properties)) {
+		s.response.NodesUnchanged++
+		return nil
+	}
+
+	propertiesJSON, err := json.Marshal(updated.Properties)
+	if err != nil {
+		return fmt.Errorf("failed to marshal properties for node %s: %v", storedID, err)
+	}
+	if _, err := s.backup("nodes", "id = ?", storedID); err != nil {
+		return err
+	}
+	_, err = s.tx.Exec(`
+		UPDATE nodes SET name = ?, type = ?, description = ?, x = ?, y = ?, connection_direction = ?,
+		       properties = ?, updated_at = ?
+		WHERE id = ?
+	`, updated.Name, updated.Type, updated.Description, updated.X, updated.Y, updated.ConnectionDirection,
+		string(propertiesJSON), s.now, storedID)
+	if err != nil {
+		return fmt.Errorf("failed to update node %s: %v", storedID, err)
+	}
+
+	s.response.NodesUpdated++
+	return nil
+}
+
+// importedEdge is an edge after ID remapping, ready to insert or apply
+type importedEdge struct {
+	id, source, target, sourceHandle, targetHandle, relationship string
+	properties                                                   map[string]interface{}
+}
+
+// updateExistingEdge applies an imported edge to the stored edge it matched
+func (h *ImportHandler) updateExistingEdge(s *importSession, storedID string, edge importedEdge) error {
+	if s.strategy == strategySkipExisting {
+		s.response.EdgesSkipped++
+		return nil
+	}
+
+	var source, target, sourceHandle, targetHandle, relationship, propertiesJSON string
+	err := s.tx.QueryRow(`
+		SELECT source_node_id, target_node_id, COALESCE(source_handle, ''), COALESCE(target_handle, ''),
+		       COALESCE(relationship, ''), COALESCE(properties, '{}')
+		FROM edges WHERE id = ?
+	`, storedID).Scan(&source, &target, &sourceHandle, &targetHandle, &relationship, &propertiesJSON)
+	if err != nil {
+		return fmt.Errorf("failed to load edge %s: %v", storedID, err)
+	}
+	stored := make(map[string]interface{})
+	json.Unmarshal([]byte(propertiesJSON), &stored)
+
+	updated := importedEdge{id: storedID, source: source, target: target,
+		sourceHandle: sourceHandle, targetHandle: targetHandle, relationship: relationship}
+	if s.takesImported("source") {
+		updated.source = edge.source
+	}
+	if s.takesImported("target") {
+		updated.target = edge.target
+	}
+	if s.takesImported("sourceHandle") {
+		updated.sourceHandle = edge.sourceHandle
+	}
+	if s.takesImported("targetHandle") {
+		updated.targetHandle = edge.targetHandle
+	}
+	if s.takesImported("relationship") {
+		updated.relationship = edge.relationship
+	}
+	updated.properties = s.mergeImportedProperties(stored, edge.properties)
+
+	if updated.source == source && updated.target == target && updated.sourceHandle == sourceHandle &&
+		updated.targetHandle == targetHandle && updated.relationship == relationship &&
+		reflect.DeepEqual(updated.properties, stored) {
+		s.response.EdgesUnchanged++
+		return nil
+	}
+
+	encoded, err := json.Marshal(updated.properties)
+	if err != nil {
+		return fmt.Errorf("failed to marshal properties for edge %s: %v", storedID, err)
+	}
+	if _, err := s.backup("edges", "id = ?", storedID); err != nil {
+		return err
+	}
+	_, err = s.tx.Exec(`
+		UPDATE edges SET source_node_id = ?, target_node_id = ?, source_handle = ?, target_handle = ?,
+		       relationship = ?, properties = ?
+		WHERE id = ?
+	`, updated.source, updated.target, updated.sourceHandle, updated.targetHandle,
+		updated.relationship, string(encoded), storedID)
+	if err != nil {
+		return fmt.Errorf("failed to update edge %s: %v", storedID, err)
+	}
+
+	s.response.EdgesUpdated++
+	return nil
+}
@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"mythsmith-backend/database"
+	"mythsmith-backend/manuscript"
+	"mythsmith-backend/models"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	settingManuscriptWatch = "manuscriptWatch"
+	defaultWatchInterval   = 5 * time.Second
+)
+
+// fileState is what the watcher remembers about a file between passes so
+// unchanged files are skipped without being read
+type fileState struct {
+	modTime  time.Time
+	size     int64
+	revision string
+}
+
+// ManuscriptWatcher polls a configured directory for Markdown and Fountain
+// files and re-syncs the scenes of files whose content changed
+type ManuscriptWatcher struct {
+	db *database.DB
+
+	mu       sync.Mutex // Serialises passes and guards the fields below
+	files    map[string]fileState
+	lastScan time.Time
+	lastErr  string
+}
+
+func NewManuscriptWatcher(db *database.DB) *ManuscriptWatcher {
+	return &ManuscriptWatcher{db: db, files: make(map[string]fileState)}
+}
+
+func (w *ManuscriptWatcher) config() (models.ManuscriptWatchConfig, error) {
+	var cfg models.ManuscriptWatchConfig
+	_, err := loadSetting(w.db, settingManuscriptWatch, &cfg)
+	return cfg, err
+}
+
+// Run polls forever. The configuration is re-read on every pass so changes
+// made through the API apply without a restart.
+func (w *ManuscriptWatcher) Run() {
+	for {
+		interval := defaultWatchInterval
+		cfg, err := w.config()
+		if err != nil {
+			log.Printf("Failed to load manuscript watch config: %v", err)
+		} else {
+			if cfg.IntervalSeconds > 0 {
+				interval = time.Duration(cfg.IntervalSeconds) * time.Second
+			}
+			if cfg.Enabled && cfg.Directory != "" {
+				if _, err := w.Scan(cfg.Directory); err != nil {
+					log.Printf("Manuscript watcher failed: %v", err)
+				}
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Scan does one pass over the directory and returns the files that changed
+func (w *ManuscriptWatcher) Scan(dir string) ([]models.ManuscriptSync, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	results, err := w.scan(dir)
+	w.lastScan = time.Now()
+	w.lastErr = ""
+	if err != nil {
+		w.lastErr = err.Error()
+	}
+	return results, err
+}
+
+func (w *ManuscriptWatcher) scan(dir string) ([]models.ManuscriptSync, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, ok := manuscript.FormatForFile(path); ok {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", root, err)
+	}
+	sort.Strings(paths)
+
+	seen := make(map[string]bool, len(paths))
+	var mt *mentionTerms
+	results := []models.ManuscriptSync{}
+
+	for _, path := range paths {
+		seen[path] = true
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		state, known := w.files[path]
+		if known && state.modTime.Equal(info.ModTime()) && state.size == info.Size() {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return results, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		revision := contentHash(string(data))
+		current := fileState{modTime: info.ModTime(), size: info.Size(), revision: revision}
+		if known && state.revision == revision {
+			w.files[path] = current
+			continue // Touched but not edited
+		}
+
+		// Node names only need loading once a file has actually changed
+		if mt == nil {
+			if mt, err = loadMentionTerms(w.db); err != nil {
+				return results, err
+			}
+		}
+
+		result, err := syncManuscriptFile(w.db, path, string(data), mt)
+		if err != nil {
+			return results, fmt.Errorf("failed to sync %s: %v", path, err)
+		}
+		// Only a synced file is remembered, so a failed sync is retried on the
+		// next scan
+		w.files[path] = current
+		if result.Action != "unchanged" {
+			results = append(results, result)
+		}
+	}
+
+	for path := range w.files {
+		if strings.HasPrefix(path, root+string(filepath.Separator)) && !seen[path] {
+			delete(w.files, path)
+			var id string
+			if err := w.db.QueryRow("SELECT id FROM manuscripts WHERE source_path = ?", path).Scan(&id); err == nil {
+				recordChange(w.db, "manuscript", id, "source_missing",
+					fmt.Sprintf("Manuscript file %s was removed", filepath.Base(path)),
+					map[string]interface{}{"path": path})
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// existingScene is a stored scene considered for reuse during a sync
+type existingScene struct {
+	id, chapterID, title, pov, location, hash string
+	chapterOrdinal, ordinal                   int
+	used                                      bool
+}
+
+// syncManuscriptFile brings the manuscript stored for path in line with its
+// content. Scenes whose text is unchanged keep their ID and appearance links;
+// only edited, added and removed scenes touch the appearances table.
+func syncManuscriptFile(db *database.DB, path, content string, mt *mentionTerms) (models.ManuscriptSync, error) {
+	result := models.ManuscriptSync{Path: path, Revision: contentHash(content), Warnings: []string{}}
+
+	format, _ := manuscript.FormatForFile(path)
+	parsed, err := manuscript.Parse(format, content)
+	if err != nil {
+		return result, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return result, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var storedHash string
+	err = tx.QueryRow("SELECT id, content_hash FROM manuscripts WHERE source_path = ?", path).Scan(&result.ManuscriptID, &storedHash)
+	switch {
+	case err == sql.ErrNoRows:
+		result.ManuscriptID = uuid.NewString()
+		result.Action = "created"
+		title := parsed.Title
+		if title == "" {
+			title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO manuscripts (id, title, format, source_path, content_hash, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, result.ManuscriptID, title, format, path, result.Revision, now, now); err != nil {
+			return result, fmt.Errorf("failed to create manuscript: %v", err)
+		}
+		scenes, warnings, err := storeManuscriptContent(tx, result.ManuscriptID, parsed, mt, result.Revision)
+		if err != nil {
+			return result, err
+		}
+		result.ScenesAdded = scenes
+		result.Warnings = warnings
+	case err != nil:
+		return result, fmt.Errorf("failed to look up manuscript: %v", err)
+	case storedHash == result.Revision:
+		result.Action = "unchanged"
+		return result, nil
+	default:
+		result.Action = "updated"
+		if err := resyncScenes(tx, &result, parsed, mt); err != nil {
+			return result, err
+		}
+		if _, err := tx.Exec("UPDATE manuscripts SET content_hash = ?, updated_at = ? WHERE id = ?",
+			result.Revision, now, result.ManuscriptID); err != nil {
+			return result, fmt.Errorf("failed to update manuscript: %v", err)
+		}
+	}
+
+	summary := fmt.Sprintf("%s: %d scenes added, %d updated, %d removed", filepath.Base(path),
+		result.ScenesAdded, result.ScenesUpdated, result.ScenesRemoved)
+	if err := recordChange(tx, "manuscript", result.ManuscriptID, result.Action, summary, result); err != nil {
+		return result, err
+	}
+
+	return result, tx.Commit()
+}
+
+// resyncScenes matches the parsed scenes against the stored ones. A scene
+// with identical text is reused wherever it moved to; otherwise the scene at
+// the same position is treated as edited; anything left over is added or
+// removed.
+func resyncScenes(tx *sql.Tx, result *models.ManuscriptSync, parsed *manuscript.Manuscript, mt *mentionTerms) error {
+	chapterIDs := make(map[int]string)
+	rows, err := tx.Query("SELECT id, ordinal FROM chapters WHERE manuscript_id = ?", result.ManuscriptID)
+	if err != nil {
+		return fmt.Errorf("failed to load chapters: %v", err)
+	}
+	for rows.Next() {
+		var id string
+		var ordinal int
+		if err := rows.Scan(&id, &ordinal); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan chapter: %v", err)
+		}
+		chapterIDs[ordinal] = id
+	}
+	rows.Close()
+
+	var existing []*existingScene
+	rows, err = tx.Query(`
+		SELECT s.id, s.chapter_id, ch.ordinal, s.ordinal, s.title, s.pov_name, s.location_name, s.content_hash
+		FROM scenes s JOIN chapters ch ON ch.id = s.chapter_id
+		WHERE s.manuscript_id = ?
+	`, result.ManuscriptID)
+	if err != nil {
+		return fmt.Errorf("failed to load scenes: %v", err)
+	}
+	for rows.Next() {
+		s := &existingScene{}
+		if err := rows.Scan(&s.id, &s.chapterID, &s.chapterOrdinal, &s.ordinal, &s.title, &s.pov, &s.location, &s.hash); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan scene: %v", err)
+		}
+		existing = append(existing, s)
+	}
+	rows.Close()
+
+	byHash := make(map[string][]*existingScene)
+	byPosition := make(map[[2]int]*existingScene)
+	for _, s := range existing {
+		byHash[s.hash] = append(byHash[s.hash], s)
+		byPosition[[2]int{s.chapterOrdinal, s.ordinal}] = s
+	}
+
+	for ci, chapter := range parsed.Chapters {
+		ordinal := ci + 1
+		chapterID, ok := chapterIDs[ordinal]
+		if ok {
+			if _, err := tx.Exec("UPDATE chapters SET title = ? WHERE id = ?", chapter.Title, chapterID); err != nil {
+				return fmt.Errorf("failed to update chapter: %v", err)
+			}
+		} else {
+			chapterID = uuid.NewString()
+			if _, err := tx.Exec("INSERT INTO chapters (id, manuscript_id, ordinal, title) VALUES (?, ?, ?, ?)",
+				chapterID, result.ManuscriptID, ordinal, chapter.Title); err != nil {
+				return fmt.Errorf("failed to insert chapter: %v", err)
+			}
+			chapterIDs[ordinal] = chapterID
+		}
+
+		for si, scene := range chapter.Scenes {
+			hash := contentHash(scene.Text)
+			var match *existingScene
+			for _, candidate := range byHash[hash] {
+				if !candidate.used {
+					match = candidate
+					break
+				}
+			}
+			textChanged := false
+			if match == nil {
+				if candidate := byPosition[[2]int{ordinal, si + 1}]; candidate != nil && !candidate.used {
+					match = candidate
+					textChanged = true
+				}
+			}
+
+			if match == nil {
+				warnings, err := insertScene(tx, result.ManuscriptID, chapterID, si+1, scene, mt, result.Revision)
+				if err != nil {
+					return err
+				}
+				result.Warnings = append(result.Warnings, warnings...)
+				result.ScenesAdded++
+				continue
+			}
+			match.used = true
+
+			povNodeID, locationNodeID, warnings := resolveSceneMetadata(scene, mt)
+			if _, err := tx.Exec(`
+				UPDATE scenes SET chapter_id = ?, ordinal = ?, title = ?, pov_name = ?, pov_node_id = ?,
+				       location_name = ?, location_node_id = ?, word_count = ?, content = ?, content_hash = ?
+				WHERE id = ?
+			`, chapterID, si+1, scene.Title, scene.POV, nullString(povNodeID), scene.Location,
+				nullString(locationNodeID), scene.WordCount(), scene.Text, hash, match.id); err != nil {
+				return fmt.Errorf("failed to update scene: %v", err)
+			}
+
+			// Mentions only need recomputing when the text or the POV/location changed
+			if textChanged || match.pov != scene.POV || match.location != scene.Location {
+				if err := storeAppearances(tx, match.id, scene, povNodeID, locationNodeID, mt, result.Revision); err != nil {
+					return err
+				}
+				result.Warnings = append(result.Warnings, warnings...)
+				result.ScenesUpdated++
+			} else {
+				result.ScenesUnchanged++
+			}
+		}
+	}
+
+	for _, s := range existing {
+		if s.used {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM scenes WHERE id = ?", s.id); err != nil {
+			return fmt.Errorf("failed to delete scene: %v", err)
+		}
+		result.ScenesRemoved++
+	}
+
+	if _, err := tx.Exec("DELETE FROM chapters WHERE manuscript_id = ? AND ordinal > ?",
+		result.ManuscriptID, len(parsed.Chapters)); err != nil {
+		return fmt.Errorf("failed to delete chapters: %v", err)
+	}
+
+	return nil
+}
+
+// GetWatchStatus returns the watcher configuration and the files it tracks
+func (w *ManuscriptWatcher) GetWatchStatus(c *gin.Context) {
+	cfg, err := w.config()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load watch config"})
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	files := []gin.H{}
+	for path, state := range w.files {
+		files = append(files, gin.H{"path": path, "revision": state.revision, "modifiedAt": state.modTime})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i]["path"].(string) < files[j]["path"].(string) })
+
+	status := gin.H{
+		"config": cfg,
+		"files":  files,
+	}
+	if !w.lastScan.IsZero() {
+		status["lastScan"] = w.lastScan
+	}
+	if w.lastErr != "" {
+		status["lastError"] = w.lastErr
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func (w *ManuscriptWatcher) UpdateWatchConfig(c *gin.Context) {
+	var cfg models.ManuscriptWatchConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if cfg.Enabled {
+		info, err := os.Stat(cfg.Directory)
+		if err != nil || !info.IsDir() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Directory does not exist"})
+			return
+		}
+	}
+	if cfg.IntervalSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "intervalSeconds must not be negative"})
+		return
+	}
+
+	if err := saveSetting(w.db, settingManuscriptWatch, cfg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save watch config"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cfg)
+}
+
+// ScanNow runs a watcher pass immediately instead of waiting for the next tick
+func (w *ManuscriptWatcher) ScanNow(c *gin.Context) {
+	cfg, err := w.config()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load watch config"})
+		return
+	}
+	if cfg.Directory == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No manuscript directory configured"})
+		return
+	}
+
+	results, err := w.Scan(cfg.Directory)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"synced": results,
+		"count":  len(results),
+	})
+}
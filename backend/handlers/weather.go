@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand"
+	"mythsmith-backend/database"
+	"mythsmith-backend/models"
+	"mythsmith-backend/weather"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const settingWorldSeed = "world_seed"
+
+// Longest range of dates weather is generated for in one request
+const maxWeatherDays = 1000
+
+// loadWorldSeed returns the world's seed, choosing and saving one the first
+// time it is needed so generated weather stays the same from then on
+func loadWorldSeed(db *database.DB) (int64, error) {
+	var seed int64
+	found, err := loadSetting(db, settingWorldSeed, &seed)
+	if err != nil || found {
+		return seed, err
+	}
+	seed = rand.Int63n(1 << 53)
+	return seed, saveSetting(db, settingWorldSeed, seed)
+}
+
+type WeatherHandler struct {
+	db *database.DB
+}
+
+func NewWeatherHandler(db *database.DB) *WeatherHandler {
+	return &WeatherHandler{db: db}
+}
+
+func (h *WeatherHandler) GetWorldSeed(c *gin.Context) {
+	seed, err := loadWorldSeed(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load world seed"})
+		return
+	}
+	c.JSON(http.StatusOK, models.WorldSeed{Seed: &seed})
+}
+
+// UpdateWorldSeed changes the seed, and with it all generated weather
+func (h *WeatherHandler) UpdateWorldSeed(c *gin.Context) {
+	var req models.WorldSeed
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := saveSetting(h.db, settingWorldSeed, *req.Seed); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save world seed"})
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+// climateOf finds the climate property of a location, or of the nearest
+// location containing it
+func climateOf(q queryer, node models.Node) (string, *models.Node, error) {
+	if climate, _ := node.Properties["climate"].(string); strings.TrimSpace(climate) != "" {
+		return climate, nil, nil
+	}
+	containers, err := loadContainment(q)
+	if err != nil {
+		return "", nil, err
+	}
+	visited := map[string]bool{node.ID: true}
+	queue := containers[node.ID]
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		container, err := loadNode(q, id)
+		if err != nil {
+			return "", nil, err
+		}
+		if climate, _ := container.Properties["climate"].(string); strings.TrimSpace(climate) != "" {
+			return climate, &container, nil
+		}
+		queue = append(queue, containers[id]...)
+	}
+	return "", nil, nil
+}
+
+// GetWeather generates day-by-day weather for a location or city between two
+// calendar dates, inclusive. The weather comes from the location's climate
+// and terrain properties and the calendar's seasons, seeded by the world
+// seed, so the same dates always give the same weather.
+func (h *WeatherHandler) GetWeather(c *gin.Context) {
+	node, err := loadNode(h.db, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve location"})
+		return
+	}
+	if node.Type != models.NodeTypeLocation && node.Type != models.NodeTypeCity {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Weather can only be generated for locations and cities"})
+		return
+	}
+
+	unit := strings.ToUpper(c.DefaultQuery("unit", "C"))
+	if unit != "C" && unit != "F" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unit must be C or F"})
+		return
+	}
+	cal, err := loadCalendar(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return
+	}
+	if c.Query("from") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from is required"})
+		return
+	}
+	from, err := cal.Parse(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to := from
+	if c.Query("to") != "" {
+		if to, err = cal.Parse(c.Query("to")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	fromDay, toDay := cal.DayNumber(from), cal.LastDayNumber(to)
+	if toDay < fromDay {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+	if toDay-fromDay+1 > maxWeatherDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Weather can be generated for at most %d days at a time", maxWeatherDays)})
+		return
+	}
+
+	seed, err := loadWorldSeed(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load world seed"})
+		return
+	}
+	climateProperty, container, err := climateOf(h.db, node)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve containing locations"})
+		return
+	}
+
+	result := models.LocationWeather{LocationID: node.ID, Name: node.Name, Unit: unit, Notes: []string{}}
+	climate, ok := weather.FindClimate(climateProperty)
+	if !ok {
+		climate, _ = weather.ClimateNamed(weather.DefaultClimate)
+		if climateProperty == "" {
+			result.Notes = append(result.Notes, fmt.Sprintf("%s has no climate property; assuming %s", node.Name, climate.Name))
+		} else {
+			result.Notes = append(result.Notes, fmt.Sprintf("Unrecognised climate %q; assuming %s", climateProperty, climate.Name))
+		}
+	}
+	if container != nil {
+		result.ClimateFrom = container.ID
+		result.Notes = append(result.Notes, fmt.Sprintf("Climate taken from %s, which contains %s", container.Name, node.Name))
+	}
+	// Nodes placed on generated maps carry the biome they were placed in
+	terrainProperty, _ := node.Properties["terrain"].(string)
+	if strings.TrimSpace(terrainProperty) == "" {
+		terrainProperty, _ = node.Properties["biome"].(string)
+	}
+	terrain, ok := weather.FindTerrain(terrainProperty)
+	if !ok && terrainProperty != "" {
+		result.Notes = append(result.Notes, fmt.Sprintf("Unrecognised terrain %q; treating it as open land", terrainProperty))
+	}
+	result.Climate, result.Terrain = climate.Name, terrain.Name
+
+	place := weather.Place{Key: node.ID, Climate: climate, Terrain: terrain}
+	result.Days = weather.Forecast(seed, place, cal, fromDay, toDay)
+	if unit == "F" {
+		for i := range result.Days {
+			result.Days[i].High = math.Round((result.Days[i].High*9/5+32)*10) / 10
+			result.Days[i].Low = math.Round((result.Days[i].Low*9/5+32)*10) / 10
+		}
+	}
+	result.From = cal.Format(cal.FromDayNumber(fromDay))
+	result.To = cal.Format(cal.FromDayNumber(toDay))
+	result.Count = len(result.Days)
+
+	c.JSON(http.StatusOK, result)
+}
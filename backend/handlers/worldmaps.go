@@ -0,0 +1,896 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mythsmith-backend/database"
+	"mythsmith-backend/models"
+	"mythsmith-backend/tiles"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Largest map image accepted for upload
+const maxMapImage = 256 << 20
+
+// Map images are stored below the asset directory, so bundles carry them
+const mapImageDir = "maps"
+
+type WorldMapHandler struct {
+	db    *database.DB
+	tiler *TileGenerator
+}
+
+func NewWorldMapHandler(db *database.DB, tiler *TileGenerator) *WorldMapHandler {
+	return &WorldMapHandler{db: db, tiler: tiler}
+}
+
+const worldMapColumns = `
+    m.id, m.name, m.content_type, m.width, m.height, COALESCE(m.node_id, ''), COALESCE(m.parent_id, ''),
+    m.parent_x, m.parent_y, m.parent_width, m.parent_height, m.pixels_per_unit, COALESCE(m.scale_unit, ''),
+    COALESCE(m.tile_status, ''), m.tiles_done, m.tiles_total, m.tile_max_zoom, COALESCE(m.tile_error, ''),
+    (SELECT COUNT(*) FROM map_pins WHERE map_id = m.id), m.created_at, m.updated_at
+`
+
+func scanWorldMap(row rowScanner) (models.WorldMap, error) {
+	var m models.WorldMap
+	var x, y, width, height, pixelsPerUnit sql.NullFloat64
+	var unit string
+	err := row.Scan(&m.ID, &m.Name, &m.ContentType, &m.Width, &m.Height, &m.NodeID, &m.ParentID,
+		&x, &y, &width, &height, &pixelsPerUnit, &unit,
+		&m.Tiles.Status, &m.Tiles.Done, &m.Tiles.Total, &m.Tiles.MaxZoom, &m.Tiles.Error,
+		&m.PinCount, &m.CreatedAt, &m.UpdatedAt)
+	m.Tiles.TileSize = tiles.Size
+	if m.ParentID != "" && x.Valid && y.Valid && width.Valid && height.Valid {
+		m.Bounds = &models.MapBounds{X: x.Float64, Y: y.Float64, Width: width.Float64, Height: height.Float64}
+	}
+	if pixelsPerUnit.Valid && unit != "" {
+		m.Scale = &models.MapScale{PixelsPerUnit: pixelsPerUnit.Float64, Unit: unit}
+	}
+	return m, err
+}
+
+const mapPinColumns = `
+    p.id, p.map_id, p.node_id, n.name, n.type, p.x, p.y, COALESCE(p.child_map_id, ''), COALESCE(p.layer_id, ''),
+    p.icon, p.label, p.created_at, p.updated_at
+`
+
+func scanMapPin(row rowScanner) (models.MapPin, error) {
+	var p models.MapPin
+	err := row.Scan(&p.ID, &p.MapID, &p.NodeID, &p.NodeName, &p.NodeType, &p.X, &p.Y, &p.ChildMapID, &p.LayerID,
+		&p.Icon, &p.Label, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+func findWorldMap(q queryer, id string) (models.WorldMap, error) {
+	return scanWorldMap(q.QueryRow("SELECT "+worldMapColumns+" FROM world_maps m WHERE m.id = ?", id))
+}
+
+// loadWorldMap responds with 404 and returns false when the map does not exist
+func (h *WorldMapHandler) loadWorldMap(c *gin.Context, id string) (models.WorldMap, bool) {
+	m, err := findWorldMap(h.db, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "World map not found"})
+		return m, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve world map"})
+		return m, false
+	}
+	return m, true
+}
+
+// mapChain returns the maps from the root map down to the given map
+func mapChain(q queryer, id string) ([]models.WorldMap, error) {
+	var chain []models.WorldMap
+	seen := make(map[string]bool)
+	for id != "" && !seen[id] {
+		seen[id] = true
+		m, err := findWorldMap(q, id)
+		if err != nil {
+			return nil, err
+		}
+		chain = append([]models.WorldMap{m}, chain...)
+		id = m.ParentID
+	}
+	return chain, nil
+}
+
+// loadContainment maps each location or city node to the location and city
+// nodes that directly contain it, reading every spelling of the containment
+// relationships
+func loadContainment(q queryer) (map[string][]string, error) {
+	rows, err := q.Query(`
+		SELECT e.source_node_id, e.target_node_id, e.relationship
+		FROM edges e
+		JOIN nodes s ON s.id = e.source_node_id
+		JOIN nodes t ON t.id = e.target_node_id
+		WHERE s.type IN (?, ?) AND t.type IN (?, ?)
+	`, models.NodeTypeLocation, models.NodeTypeCity, models.NodeTypeLocation, models.NodeTypeCity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query containment edges: %v", err)
+	}
+	defer rows.Close()
+
+	containers := make(map[string][]string)
+	for rows.Next() {
+		var source, target, relationship string
+		if err := rows.Scan(&source, &target, &relationship); err != nil {
+			return nil, fmt.Errorf("failed to scan containment edge: %v", err)
+		}
+		relationship = models.ContainmentRelationship(relationship)
+		if relationship == "" {
+			continue
+		}
+		inner, outer := source, target
+		if relationship == models.RelationshipContains {
+			inner, outer = target, source
+		}
+		containers[inner] = append(containers[inner], outer)
+	}
+	return containers, rows.Err()
+}
+
+// liesWithin reports whether node is region or lies, directly or through
+// other places, within it
+func liesWithin(containers map[string][]string, node, region string) bool {
+	visited := map[string]bool{node: true}
+	queue := []string{node}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == region {
+			return true
+		}
+		for _, next := range containers[current] {
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return false
+}
+
+// validateHierarchy checks a map's node, parent and bounds. id is empty for
+// a new map. A child map's node must lie within the node of its parent map,
+// and the nodes of the map's own children must lie within its node.
+func (h *WorldMapHandler) validateHierarchy(c *gin.Context, id string, req *models.WorldMapRequest) bool {
+	req.NodeID = strings.TrimSpace(req.NodeID)
+	req.ParentID = strings.TrimSpace(req.ParentID)
+
+	var nodeName string
+	if req.NodeID != "" {
+		var nodeType models.NodeType
+		err := h.db.QueryRow("SELECT name, type FROM nodes WHERE id = ?", req.NodeID).Scan(&nodeName, &nodeType)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Node %s does not exist", req.NodeID)})
+			return false
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve node"})
+			return false
+		}
+		if nodeType != models.NodeTypeLocation && nodeType != models.NodeTypeCity {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A map can only depict a location or city, not a %s", nodeType)})
+			return false
+		}
+	}
+
+	containers, err := loadContainment(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if req.ParentID == "" {
+		req.Bounds = nil
+	} else {
+		if req.ParentID == id {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A map cannot be its own parent"})
+			return false
+		}
+		chain, err := mapChain(h.db, req.ParentID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Parent map %s does not exist", req.ParentID)})
+			return false
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve parent map"})
+			return false
+		}
+		for _, ancestor := range chain {
+			if ancestor.ID == id {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is inside this map and cannot be its parent", chain[len(chain)-1].Name)})
+				return false
+			}
+		}
+		parent := chain[len(chain)-1]
+
+		b := req.Bounds
+		if b == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bounds are required for a child map"})
+			return false
+		}
+		if b.Width <= 0 || b.Height <= 0 || b.X < 0 || b.Y < 0 ||
+			b.X+b.Width > float64(parent.Width) || b.Y+b.Height > float64(parent.Height) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("bounds must be a rectangle within the %dx%d parent map", parent.Width, parent.Height)})
+			return false
+		}
+
+		if req.NodeID != "" && parent.NodeID != "" && !liesWithin(containers, req.NodeID, parent.NodeID) {
+			var parentNode string
+			h.db.QueryRow("SELECT name FROM nodes WHERE id = ?", parent.NodeID).Scan(&parentNode)
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(
+				"%s does not lie within %s, the place shown by %s; connect them with a %q edge first",
+				nodeName, parentNode, parent.Name, models.RelationshipLocatedIn)})
+			return false
+		}
+	}
+
+	if id == "" || req.NodeID == "" {
+		return true
+	}
+	rows, err := h.db.Query("SELECT m.name, n.name, m.node_id FROM world_maps m JOIN nodes n ON n.id = m.node_id WHERE m.parent_id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve child maps"})
+		return false
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var childMap, childNode, childNodeID string
+		if err := rows.Scan(&childMap, &childNode, &childNodeID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan child map data"})
+			return false
+		}
+		if !liesWithin(containers, childNodeID, req.NodeID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(
+				"Child map %s shows %s, which does not lie within %s", childMap, childNode, nodeName)})
+			return false
+		}
+	}
+	return true
+}
+
+// linkChildPins points the parent's pins for the map's node at the map, and
+// unlinks pins on other maps that still open it
+func linkChildPins(tx execer, m models.WorldMap) error {
+	if _, err := tx.Exec("UPDATE map_pins SET child_map_id = NULL WHERE child_map_id = ? AND map_id IS NOT ?", m.ID, nullString(m.ParentID)); err != nil {
+		return err
+	}
+	if m.ParentID == "" || m.NodeID == "" {
+		return nil
+	}
+	_, err := tx.Exec("UPDATE map_pins SET child_map_id = ? WHERE map_id = ? AND node_id = ? AND child_map_id IS NULL", m.ID, m.ParentID, m.NodeID)
+	return err
+}
+
+// GetWorldMaps lists maps, or only the children of ?parentId=
+func (h *WorldMapHandler) GetWorldMaps(c *gin.Context) {
+	query := "SELECT " + worldMapColumns + " FROM world_maps m"
+	var args []interface{}
+	if parentID := c.Query("parentId"); parentID != "" {
+		query += " WHERE m.parent_id = ?"
+		args = append(args, parentID)
+	}
+	rows, err := h.db.Query(query+" ORDER BY m.created_at, m.id", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve world maps"})
+		return
+	}
+	defer rows.Close()
+
+	maps := []models.WorldMap{}
+	for rows.Next() {
+		m, err := scanWorldMap(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan world map data"})
+			return
+		}
+		maps = append(maps, m)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"worldMaps": maps,
+		"count":     len(maps),
+	})
+}
+
+// GetWorldMap returns a map. A map without a scale of its own reports the
+// scale it inherits from its closest calibrated ancestor.
+func (h *WorldMapHandler) GetWorldMap(c *gin.Context) {
+	m, ok := h.loadWorldMap(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	scale, err := mapScale(h.db, m.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve parent maps"})
+		return
+	}
+	m.Scale = scale
+	c.JSON(http.StatusOK, m)
+}
+
+// CreateWorldMap uploads a map image as the "image" form field and queues
+// its tile pyramid. PNG, JPEG and GIF images are accepted; "name" defaults to
+// the file name. A child map sends "parentId" and "bounds" as a JSON
+// rectangle on the parent, and "nodeId" names the location or city the map
+// depicts.
+func (h *WorldMapHandler) CreateWorldMap(c *gin.Context) {
+	req := models.WorldMapRequest{NodeID: c.PostForm("nodeId"), ParentID: c.PostForm("parentId")}
+	if bounds := c.PostForm("bounds"); bounds != "" {
+		req.Bounds = &models.MapBounds{}
+		if err := json.Unmarshal([]byte(bounds), req.Bounds); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid bounds: %v", err)})
+			return
+		}
+	}
+	if !h.validateHierarchy(c, "", &req) {
+		return
+	}
+
+	header, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("missing map image: %v", err)})
+		return
+	}
+	if header.Size > maxMapImage {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is too large", header.Filename)})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to open %s: %v", header.Filename, err)})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxMapImage))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to read %s: %v", header.Filename, err)})
+		return
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is not a PNG, JPEG or GIF image", header.Filename)})
+		return
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Map image has no pixels"})
+		return
+	}
+	if config.Width*config.Height > maxMapPixels {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Map image is %dx%d; the largest supported is %d pixels", config.Width, config.Height, maxMapPixels)})
+		return
+	}
+
+	name := strings.TrimSpace(c.PostForm("name"))
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+
+	now := time.Now()
+	m := models.WorldMap{
+		ID:          uuid.NewString(),
+		Name:        name,
+		ContentType: "image/" + format,
+		Width:       config.Width,
+		Height:      config.Height,
+		NodeID:      req.NodeID,
+		ParentID:    req.ParentID,
+		Bounds:      req.Bounds,
+		Tiles: models.MapTiles{
+			Status:   models.TileStatusPending,
+			Total:    tiles.Count(config.Width, config.Height),
+			MaxZoom:  tiles.MaxZoom(config.Width, config.Height),
+			TileSize: tiles.Size,
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	imagePath := path.Join(mapImageDir, m.ID+"."+format)
+	dest := filepath.Join(assetDir, filepath.FromSlash(imagePath))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store map image"})
+		return
+	}
+	if err := os.WriteFile(dest, data, 0o644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store map image"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		os.Remove(dest)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	err = insertWorldMap(tx, m, imagePath)
+	if err == nil {
+		err = linkChildPins(tx, m)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		os.Remove(dest)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create world map"})
+		return
+	}
+	h.tiler.Wake()
+
+	c.JSON(http.StatusCreated, m)
+}
+
+// insertWorldMap adds a map whose image is stored at imagePath below the
+// asset directory
+func insertWorldMap(e execer, m models.WorldMap, imagePath string) error {
+	args := []interface{}{m.ID, m.Name, imagePath, m.ContentType, m.Width, m.Height, nullString(m.NodeID), nullString(m.ParentID)}
+	args = append(append(args, boundsArgs(m.Bounds)...), m.Tiles.Status, m.Tiles.Total, m.Tiles.MaxZoom, m.CreatedAt, m.UpdatedAt)
+	_, err := e.Exec(`
+		INSERT INTO world_maps (id, name, image_path, content_type, width, height, node_id, parent_id,
+		                        parent_x, parent_y, parent_width, parent_height,
+		                        tile_status, tiles_total, tile_max_zoom, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, args...)
+	return err
+}
+
+// boundsArgs returns the parent_x, parent_y, parent_width and parent_height
+// column values
+func boundsArgs(b *models.MapBounds) []interface{} {
+	if b == nil {
+		return []interface{}{nil, nil, nil, nil}
+	}
+	return []interface{}{b.X, b.Y, b.Width, b.Height}
+}
+
+// UpdateWorldMap renames a map and sets the node it depicts and its place in
+// the map hierarchy. Pins on the new parent for the map's node are linked to
+// it.
+func (h *WorldMapHandler) UpdateWorldMap(c *gin.Context) {
+	id := c.Param("id")
+	var req models.WorldMapRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must not be blank"})
+		return
+	}
+
+	if _, ok := h.loadWorldMap(c, id); !ok {
+		return
+	}
+	if !h.validateHierarchy(c, id, &req) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	args := []interface{}{req.Name, nullString(req.NodeID), nullString(req.ParentID)}
+	args = append(append(args, boundsArgs(req.Bounds)...), time.Now(), id)
+	_, err = tx.Exec(`
+		UPDATE world_maps SET name = ?, node_id = ?, parent_id = ?,
+		       parent_x = ?, parent_y = ?, parent_width = ?, parent_height = ?, updated_at = ?
+		WHERE id = ?
+	`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update world map"})
+		return
+	}
+	if err := linkChildPins(tx, models.WorldMap{ID: id, NodeID: req.NodeID, ParentID: req.ParentID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link pins to world map"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	m, ok := h.loadWorldMap(c, id)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// DeleteWorldMap deletes a map with its pins, routes and image. Its child
+// maps become root maps.
+func (h *WorldMapHandler) DeleteWorldMap(c *gin.Context) {
+	id := c.Param("id")
+	var imagePath string
+	err := h.db.QueryRow("SELECT image_path FROM world_maps WHERE id = ?", id).Scan(&imagePath)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "World map not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve world map"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE world_maps SET parent_id = NULL, parent_x = NULL, parent_y = NULL,
+		       parent_width = NULL, parent_height = NULL, updated_at = ?
+		WHERE parent_id = ?
+	`, time.Now(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to detach child maps"})
+		return
+	}
+	if err := deleteRouteEdges(tx, "map_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM world_maps WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete world map"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	os.Remove(filepath.Join(assetDir, filepath.FromSlash(imagePath)))
+	os.RemoveAll(filepath.Join(tileDir, id))
+
+	c.JSON(http.StatusOK, gin.H{"message": "World map deleted successfully"})
+}
+
+// GetWorldMapImage serves the map image
+func (h *WorldMapHandler) GetWorldMapImage(c *gin.Context) {
+	var imagePath, contentType string
+	err := h.db.QueryRow("SELECT image_path, content_type FROM world_maps WHERE id = ?", c.Param("id")).Scan(&imagePath, &contentType)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "World map not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve world map"})
+		return
+	}
+
+	file := filepath.Join(assetDir, filepath.FromSlash(imagePath))
+	if _, err := os.Stat(file); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Map image is missing"})
+		return
+	}
+	c.Header("Content-Type", contentType)
+	c.File(file)
+}
+
+// validatePin checks that the node exists, the pin lies on the map image and
+// its layer and child map belong to this map. Without a child map, the pin opens
+// the child map that depicts its node, if there is one.
+func (h *WorldMapHandler) validatePin(c *gin.Context, m models.WorldMap, req *models.MapPinRequest) bool {
+	req.Icon = strings.TrimSpace(req.Icon)
+	req.Label = strings.TrimSpace(req.Label)
+	req.ChildMapID = strings.TrimSpace(req.ChildMapID)
+	req.LayerID = strings.TrimSpace(req.LayerID)
+	if req.X < 0 || req.Y < 0 || req.X > float64(m.Width) || req.Y > float64(m.Height) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Pin must lie within the %dx%d map image", m.Width, m.Height)})
+		return false
+	}
+
+	var exists bool
+	if err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM nodes WHERE id = ?)", req.NodeID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve node"})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Node %s does not exist", req.NodeID)})
+		return false
+	}
+
+	if req.LayerID != "" {
+		if err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM map_layers WHERE id = ? AND map_id = ?)", req.LayerID, m.ID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve layer"})
+			return false
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Layer %s is not on this map", req.LayerID)})
+			return false
+		}
+	}
+
+	if req.ChildMapID == "" {
+		err := h.db.QueryRow("SELECT id FROM world_maps WHERE parent_id = ? AND node_id = ? ORDER BY created_at, id LIMIT 1",
+			m.ID, req.NodeID).Scan(&req.ChildMapID)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve child maps"})
+			return false
+		}
+		return true
+	}
+	var parentID string
+	err := h.db.QueryRow("SELECT COALESCE(parent_id, '') FROM world_maps WHERE id = ?", req.ChildMapID).Scan(&parentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Map %s does not exist", req.ChildMapID)})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve child map"})
+		return false
+	}
+	if parentID != m.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A pin can only open a child map of the map it is on"})
+		return false
+	}
+	return true
+}
+
+func (h *WorldMapHandler) loadPin(mapID, pinID string) (models.MapPin, error) {
+	return scanMapPin(h.db.QueryRow("SELECT "+mapPinColumns+" FROM map_pins p JOIN nodes n ON n.id = p.node_id WHERE p.id = ? AND p.map_id = ?", pinID, mapID))
+}
+
+func (h *WorldMapHandler) GetPins(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.loadWorldMap(c, id); !ok {
+		return
+	}
+
+	rows, err := h.db.Query("SELECT "+mapPinColumns+" FROM map_pins p JOIN nodes n ON n.id = p.node_id WHERE p.map_id = ? ORDER BY p.created_at, p.id", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pins"})
+		return
+	}
+	defer rows.Close()
+
+	pins := []models.MapPin{}
+	for rows.Next() {
+		pin, err := scanMapPin(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan pin data"})
+			return
+		}
+		pins = append(pins, pin)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pins":  pins,
+		"count": len(pins),
+	})
+}
+
+func (h *WorldMapHandler) CreatePin(c *gin.Context) {
+	id := c.Param("id")
+	var req models.MapPinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m, ok := h.loadWorldMap(c, id)
+	if !ok || !h.validatePin(c, m, &req) {
+		return
+	}
+
+	pinID := uuid.NewString()
+	now := time.Now()
+	_, err := h.db.Exec(`
+		INSERT INTO map_pins (id, map_id, node_id, x, y, child_map_id, layer_id, icon, label, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, pinID, id, req.NodeID, req.X, req.Y, nullString(req.ChildMapID), nullString(req.LayerID), req.Icon, req.Label, now, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pin"})
+		return
+	}
+
+	pin, err := h.loadPin(id, pinID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pin"})
+		return
+	}
+	c.JSON(http.StatusCreated, pin)
+}
+
+// UpdatePin moves a pin, points it at another node or child map, or changes
+// its overrides
+func (h *WorldMapHandler) UpdatePin(c *gin.Context) {
+	id, pinID := c.Param("id"), c.Param("pinId")
+	var req models.MapPinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m, ok := h.loadWorldMap(c, id)
+	if !ok || !h.validatePin(c, m, &req) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE map_pins SET node_id = ?, x = ?, y = ?, child_map_id = ?, layer_id = ?, icon = ?, label = ?, updated_at = ?
+		WHERE id = ? AND map_id = ?
+	`, req.NodeID, req.X, req.Y, nullString(req.ChildMapID), nullString(req.LayerID), req.Icon, req.Label, time.Now(), pinID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pin"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pin not found"})
+		return
+	}
+	// The pin's routes follow it to its new node
+	if err := syncRouteEdges(tx, "r.from_pin_id = ? OR r.to_pin_id = ?", pinID, pinID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	pin, err := h.loadPin(id, pinID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pin"})
+		return
+	}
+	c.JSON(http.StatusOK, pin)
+}
+
+// DeletePin deletes a pin with the routes that end at it
+func (h *WorldMapHandler) DeletePin(c *gin.Context) {
+	id, pinID := c.Param("id"), c.Param("pinId")
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := deleteRouteEdges(tx, "map_id = ? AND (from_pin_id = ? OR to_pin_id = ?)", id, pinID, pinID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := tx.Exec("DELETE FROM map_pins WHERE id = ? AND map_id = ?", pinID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete pin"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pin not found"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pin deleted successfully"})
+}
+
+// GetBreadcrumbs returns the path from the root map down to this map, with
+// the pin on each map that opens the next
+func (h *WorldMapHandler) GetBreadcrumbs(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.loadWorldMap(c, id); !ok {
+		return
+	}
+	chain, err := mapChain(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve parent maps"})
+		return
+	}
+
+	breadcrumbs := make([]models.MapBreadcrumb, 0, len(chain))
+	for _, m := range chain {
+		crumb := models.MapBreadcrumb{
+			ID:     m.ID,
+			Name:   m.Name,
+			NodeID: m.NodeID,
+			Width:  m.Width,
+			Height: m.Height,
+			Bounds: m.Bounds,
+		}
+		if m.ParentID != "" {
+			err := h.db.QueryRow("SELECT id FROM map_pins WHERE map_id = ? AND child_map_id = ? ORDER BY created_at, id LIMIT 1",
+				m.ParentID, m.ID).Scan(&crumb.PinID)
+			if err != nil && err != sql.ErrNoRows {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pins"})
+				return
+			}
+		}
+		breadcrumbs = append(breadcrumbs, crumb)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"breadcrumbs": breadcrumbs,
+		"count":       len(breadcrumbs),
+	})
+}
+
+// ConvertPoint converts ?x= and ?y= on this map to the pixels of the map
+// ?to=, going up to the maps' closest shared ancestor and back down through
+// the rectangles each child covers on its parent
+func (h *WorldMapHandler) ConvertPoint(c *gin.Context) {
+	x, errX := strconv.ParseFloat(c.Query("x"), 64)
+	y, errY := strconv.ParseFloat(c.Query("y"), 64)
+	if errX != nil || errY != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "x and y must be numbers"})
+		return
+	}
+	if _, ok := h.loadWorldMap(c, c.Param("id")); !ok {
+		return
+	}
+	from, err := mapChain(h.db, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve parent maps"})
+		return
+	}
+	to, err := mapChain(h.db, c.Query("to"))
+	if err == sql.ErrNoRows || c.Query("to") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must name an existing map"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve parent maps"})
+		return
+	}
+
+	shared := 0
+	for shared < len(from) && shared < len(to) && from[shared].ID == to[shared].ID {
+		shared++
+	}
+	if shared == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s and %s are not in the same map hierarchy", from[len(from)-1].Name, to[len(to)-1].Name)})
+		return
+	}
+
+	// Up from the source map to the shared ancestor
+	for i := len(from) - 1; i >= shared; i-- {
+		m := from[i]
+		x = m.Bounds.X + x*m.Bounds.Width/float64(m.Width)
+		y = m.Bounds.Y + y*m.Bounds.Height/float64(m.Height)
+	}
+	// Down to the target map
+	for _, m := range to[shared:] {
+		x = (x - m.Bounds.X) * float64(m.Width) / m.Bounds.Width
+		y = (y - m.Bounds.Y) * float64(m.Height) / m.Bounds.Height
+	}
+
+	target := to[len(to)-1]
+	c.JSON(http.StatusOK, models.MapPoint{
+		MapID:  target.ID,
+		X:      x,
+		Y:      y,
+		Inside: x >= 0 && y >= 0 && x <= float64(target.Width) && y <= float64(target.Height),
+	})
+}
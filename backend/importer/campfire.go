@@ -0,0 +1,210 @@
+package importer
+
+import (
+	"encoding/json"
+	"mythsmith-backend/models"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Campfire reads Campfire project exports: either one JSON object keyed by
+// module ("characters", "locations", ...) or, in a zip archive, one
+// <module>.json file per module holding a list of records. Custom fields are
+// {"label", "value"} pairs; relationships are {"from", "to", "type"} records.
+type Campfire struct{}
+
+func (Campfire) Name() string  { return "campfire" }
+func (Campfire) Title() string { return "Campfire" }
+
+// Modules and the node types their records become
+var campfireTypes = map[string]string{
+	"characters":    "character",
+	"locations":     "location",
+	"cities":        "city",
+	"organizations": "faction",
+	"factions":      "faction",
+	"species":       "species",
+	"events":        "event",
+	"timeline":      "event",
+}
+
+// Modules that describe relations rather than entities
+var campfireRelationModules = map[string]bool{"relationships": true, "relations": true}
+
+var campfireFields = fieldMap{
+	properties: map[string]string{
+		"summary":  "summary",
+		"role":     "role",
+		"age":      "age",
+		"pronouns": "pronouns",
+		"date":     "date",
+		"tags":     "tags",
+	},
+	references: map[string]string{
+		"location":     models.RelationshipLocatedIn,
+		"locationId":   models.RelationshipLocatedIn,
+		"species":      "species",
+		"speciesId":    "species",
+		"organization": "member of",
+		"faction":      "member of",
+		"parent":       models.RelationshipPartOf,
+		"parentId":     models.RelationshipPartOf,
+	},
+	ignored: map[string]bool{
+		"id": true, "name": true, "title": true, "description": true, "body": true, "fields": true,
+		"image": true, "color": true, "order": true, "createdAt": true, "updatedAt": true,
+	},
+}
+
+// campfireModules returns the record lists of an export by module
+func campfireModules(files []File) map[string][]interface{} {
+	modules := make(map[string][]interface{})
+	for _, f := range files {
+		var doc interface{}
+		if err := json.Unmarshal(f.Data, &doc); err != nil {
+			continue
+		}
+		switch doc := doc.(type) {
+		case map[string]interface{}:
+			for module, records := range doc {
+				if list, ok := records.([]interface{}); ok {
+					modules[strings.ToLower(module)] = append(modules[strings.ToLower(module)], list...)
+				}
+			}
+		case []interface{}:
+			module := strings.ToLower(strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name)))
+			modules[module] = append(modules[module], doc...)
+		}
+	}
+	return modules
+}
+
+func (Campfire) Detect(files []File) bool {
+	modules := campfireModules(files)
+	for module := range campfireTypes {
+		if len(modules[module]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// campfireRef reads a reference that is either an ID or an object with one
+func campfireRef(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return stringField(map[string]interface{}{"id": v}, "id")
+	case map[string]interface{}:
+		return stringField(v, "id")
+	}
+	return ""
+}
+
+func (Campfire) Convert(files []File) (*Result, error) {
+	result := &Result{}
+	r := newReport("Campfire")
+	modules := campfireModules(files)
+
+	names := make([]string, 0, len(modules))
+	for module := range modules {
+		names = append(names, module)
+	}
+	sort.Strings(names)
+
+	renamed := make(map[string]bool) // Custom field labels warned about
+	for _, module := range names {
+		records := modules[module]
+		if campfireRelationModules[module] {
+			continue
+		}
+		nodeType, ok := campfireTypes[module]
+		if !ok {
+			r.skipped[module] += len(records)
+			continue
+		}
+		for _, item := range records {
+			record, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			id := stringField(record, "id")
+			name := stringField(record, "name")
+			if name == "" {
+				name = stringField(record, "title")
+			}
+			if id == "" || name == "" {
+				r.warn("a %s record without an ID or name was not imported", module)
+				continue
+			}
+			r.checkFields(module, record, campfireFields)
+
+			nodeID := "campfire-" + id
+			properties := map[string]interface{}{"source": "Campfire", "sourceId": id}
+			copyProperties(record, campfireFields, properties)
+			fields, _ := record["fields"].([]interface{})
+			for _, f := range fields {
+				field, ok := f.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				label := stringField(field, "label")
+				if label == "" || isEmpty(field["value"]) {
+					continue
+				}
+				if bookkeepingProperties[label] {
+					if !renamed[label] {
+						r.warn("custom field %q was imported as %q so it does not replace import bookkeeping", label, "field "+label)
+						renamed[label] = true
+					}
+					label = "field " + label
+				}
+				properties[label] = field["value"]
+			}
+
+			description := stringField(record, "description")
+			if description == "" {
+				description = stringField(record, "body")
+			}
+			result.Nodes = append(result.Nodes, Node{
+				ID:          nodeID,
+				Name:        name,
+				Type:        nodeType,
+				Description: plainText(description),
+				Properties:  properties,
+			})
+
+			for _, field := range sortedKeys(campfireFields.references) {
+				if ref := campfireRef(record[field]); ref != "" {
+					r.edge(result, nodeID, "campfire-"+ref, campfireFields.references[field])
+				}
+			}
+		}
+	}
+
+	for _, module := range []string{"relationships", "relations"} {
+		for _, item := range modules[module] {
+			relation, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			relationship := stringField(relation, "type")
+			if relationship == "" {
+				relationship = stringField(relation, "label")
+			}
+			if relationship == "" {
+				relationship = "related to"
+			}
+			from, to := campfireRef(relation["from"]), campfireRef(relation["to"])
+			if from == "" || to == "" {
+				r.warn("a relationship without both ends was not imported")
+				continue
+			}
+			r.edge(result, "campfire-"+from, "campfire-"+to, relationship)
+		}
+	}
+
+	return r.finish(result), nil
+}
@@ -0,0 +1,285 @@
+// Package importer converts the exports of other worldbuilding tools into
+// nodes and edges. Each tool is an Adapter; the handlers feed the result into
+// the regular import pipeline.
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// File is one file of an export, with its path inside the archive
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Node is an imported entity. Type is a MythSmith node type.
+type Node struct {
+	ID          string
+	Name        string
+	Type        string
+	Description string
+	Properties  map[string]interface{}
+}
+
+// Edge is a relation between two imported entities, by their node IDs
+type Edge struct {
+	ID           string
+	Source       string
+	Target       string
+	Relationship string
+}
+
+// Result is what an adapter made of an export
+type Result struct {
+	Nodes    []Node
+	Edges    []Edge
+	Warnings []string
+}
+
+// Adapter reads the export format of one tool
+type Adapter interface {
+	// Name identifies the adapter in requests, e.g. "kanka"
+	Name() string
+	// Title is the tool's display name
+	Title() string
+	// Detect reports whether the files look like this tool's export
+	Detect(files []File) bool
+	// Convert maps the export's entities to nodes and their relations to edges
+	Convert(files []File) (*Result, error)
+}
+
+var adapters []Adapter
+
+// Register makes an adapter available to Lookup and Detect
+func Register(a Adapter) {
+	adapters = append(adapters, a)
+}
+
+func init() {
+	Register(WorldAnvil{})
+	Register(Kanka{})
+	Register(Campfire{})
+}
+
+// Adapters returns the registered adapters
+func Adapters() []Adapter {
+	return adapters
+}
+
+// Lookup returns the adapter with the given name
+func Lookup(name string) (Adapter, bool) {
+	for _, a := range adapters {
+		if strings.EqualFold(a.Name(), name) {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+// Detect returns the first adapter that recognises the files
+func Detect(files []File) (Adapter, bool) {
+	for _, a := range adapters {
+		if a.Detect(files) {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+// Largest file read from an archive, to keep a malformed zip from exhausting memory
+const maxArchiveFile = 64 << 20
+
+// ReadFiles returns the JSON files of an upload, which is either a single
+// JSON file or a zip archive
+func ReadFiles(filename string, data []byte) ([]File, error) {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return []File{{Name: filename, Data: data}}, nil
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive: %v", err)
+	}
+	var files []File
+	for _, entry := range archive.File {
+		name := entry.Name
+		if entry.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") ||
+			strings.HasPrefix(path.Base(name), ".") || !strings.EqualFold(path.Ext(name), ".json") {
+			continue
+		}
+		if entry.UncompressedSize64 > maxArchiveFile {
+			return nil, fmt.Errorf("%s is too large to import", name)
+		}
+		r, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %v", name, err)
+		}
+		content, err := io.ReadAll(io.LimitReader(r, maxArchiveFile))
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		files = append(files, File{Name: name, Data: content})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	if len(files) == 0 {
+		return nil, fmt.Errorf("the archive contains no JSON files")
+	}
+	return files, nil
+}
+
+// fieldMap says what an adapter does with each field of a record. Fields in
+// none of its sets are reported as unmapped.
+type fieldMap struct {
+	properties map[string]string // Field -> property name
+	references map[string]string // Field -> relationship of an edge to the referenced record
+	ignored    map[string]bool   // Bookkeeping fields dropped on purpose
+}
+
+// Properties the importers and the import pipeline keep their bookkeeping in,
+// which a record's own fields must not overwrite
+var bookkeepingProperties = map[string]bool{
+	"source": true, "sourceId": true, "originalId": true, "importedAs": true, "tempId": true,
+}
+
+func (m fieldMap) handles(field string) bool {
+	_, property := m.properties[field]
+	_, reference := m.references[field]
+	return property || reference || m.ignored[field]
+}
+
+// report collects warnings without repeating one per record
+type report struct {
+	tool     string
+	unmapped map[string]int // "kind\x00field" -> records that had it
+	skipped  map[string]int // Kind -> records without a node type
+	edges    map[string]bool
+	warnings []string
+}
+
+func newReport(tool string) *report {
+	return &report{tool: tool, unmapped: make(map[string]int), skipped: make(map[string]int), edges: make(map[string]bool)}
+}
+
+func (r *report) warn(format string, args ...interface{}) {
+	r.warnings = append(r.warnings, r.tool+": "+fmt.Sprintf(format, args...))
+}
+
+// checkFields counts the non-empty fields of a record that the map does not handle
+func (r *report) checkFields(kind string, record map[string]interface{}, m fieldMap) {
+	for field, value := range record {
+		if !m.handles(field) && !isEmpty(value) {
+			r.unmapped[kind+"\x00"+field]++
+		}
+	}
+}
+
+// edge adds a relation once, however many records mention it
+func (r *report) edge(result *Result, source, target, relationship string) {
+	if source == "" || target == "" || source == target {
+		return
+	}
+	id := source + "--" + relationship + "--" + target
+	if r.edges[id] {
+		return
+	}
+	r.edges[id] = true
+	result.Edges = append(result.Edges, Edge{ID: id, Source: source, Target: target, Relationship: relationship})
+}
+
+// finish appends the collected warnings to the result in a stable order
+func (r *report) finish(result *Result) *Result {
+	kinds := make([]string, 0, len(r.skipped))
+	for kind := range r.skipped {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		r.warn("%d %s record(s) have no matching node type and were not imported", r.skipped[kind], kind)
+	}
+
+	keys := make([]string, 0, len(r.unmapped))
+	for key := range r.unmapped {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		kind, field, _ := strings.Cut(key, "\x00")
+		r.warn("field %q on %d %s record(s) is not mapped and was not imported", field, r.unmapped[key], kind)
+	}
+
+	result.Warnings = append(result.Warnings, r.warnings...)
+	return result
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	case bool:
+		return !v
+	}
+	return false
+}
+
+// copyProperties copies the mapped scalar fields of a record into properties
+func copyProperties(record map[string]interface{}, m fieldMap, properties map[string]interface{}) {
+	for field, property := range m.properties {
+		if v, ok := record[field]; ok && !isEmpty(v) {
+			properties[property] = v
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// stringField reads a field that may be a string or a number
+func stringField(record map[string]interface{}, field string) string {
+	switch v := record[field].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return ""
+}
+
+var (
+	htmlBreak = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</h[1-6]>|</li>|</div>`)
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+	blankRuns = regexp.MustCompile(`\n{3,}`)
+)
+
+// plainText turns an HTML fragment into text, keeping paragraph breaks
+func plainText(s string) string {
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(blankRuns.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
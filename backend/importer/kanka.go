@@ -0,0 +1,200 @@
+package importer
+
+import (
+	"encoding/json"
+	"mythsmith-backend/models"
+	"path"
+	"strings"
+)
+
+// Kanka reads Kanka campaign exports: a zip archive with one folder per
+// module ("characters", "locations", ...) holding one JSON file per entity.
+// Entity relations point at entity IDs; fields such as location_id point at
+// the ID of the record within its module.
+type Kanka struct{}
+
+func (Kanka) Name() string  { return "kanka" }
+func (Kanka) Title() string { return "Kanka" }
+
+// Modules and the node types their entities become
+var kankaTypes = map[string]string{
+	"characters":    "character",
+	"locations":     "location",
+	"organisations": "faction",
+	"families":      "faction",
+	"races":         "species",
+	"creatures":     "species",
+	"events":        "event",
+}
+
+// Location subtypes imported as cities
+var kankaCityTypes = map[string]bool{"city": true, "town": true, "village": true, "capital": true, "settlement": true}
+
+// Fields that reference another record, and the module that record is in
+var kankaReferenceModules = map[string]string{
+	"location_id":        "locations",
+	"parent_location_id": "locations",
+	"race_id":            "races",
+	"races":              "races",
+	"family_id":          "families",
+	"families":           "families",
+	"organisation_id":    "organisations",
+	"creature_id":        "creatures",
+	"event_id":           "events",
+}
+
+var kankaFields = fieldMap{
+	properties: map[string]string{
+		"type":       "subtype",
+		"title":      "title",
+		"age":        "age",
+		"sex":        "sex",
+		"pronouns":   "pronouns",
+		"is_dead":    "dead",
+		"date":       "date",
+		"tags":       "tags",
+		"is_private": "private",
+	},
+	references: map[string]string{
+		"location_id":        models.RelationshipLocatedIn,
+		"parent_location_id": models.RelationshipPartOf,
+		"race_id":            "species",
+		"races":              "species",
+		"family_id":          "member of",
+		"families":           "member of",
+		"organisation_id":    models.RelationshipPartOf,
+		"creature_id":        "species",
+		"event_id":           models.RelationshipPartOf,
+	},
+	ignored: map[string]bool{
+		"id": true, "name": true, "entry": true, "entity": true, "entity_id": true, "slug": true,
+		"image": true, "image_full": true, "image_thumb": true, "has_custom_image": true,
+		"created_at": true, "created_by": true, "updated_at": true, "updated_by": true,
+		"focus_x": true, "focus_y": true, "is_template": true,
+	},
+}
+
+// kankaRecord is one entity file
+type kankaRecord struct {
+	module string
+	data   map[string]interface{}
+}
+
+func kankaRecords(files []File) []kankaRecord {
+	var records []kankaRecord
+	for _, f := range files {
+		module := path.Base(path.Dir(f.Name))
+		var data map[string]interface{}
+		if err := json.Unmarshal(f.Data, &data); err != nil {
+			continue
+		}
+		if _, ok := data["name"].(string); !ok {
+			continue
+		}
+		if _, ok := data["entity"].(map[string]interface{}); !ok && data["entity_id"] == nil {
+			continue
+		}
+		records = append(records, kankaRecord{module: module, data: data})
+	}
+	return records
+}
+
+func (Kanka) Detect(files []File) bool {
+	return len(kankaRecords(files)) > 0
+}
+
+func (Kanka) Convert(files []File) (*Result, error) {
+	result := &Result{}
+	r := newReport("Kanka")
+	records := kankaRecords(files)
+
+	// Node IDs are built from entity IDs; module record IDs map to them
+	nodeIDs := make(map[string]string) // "module:id" -> node ID
+	entityID := func(rec kankaRecord) string {
+		if entity, ok := rec.data["entity"].(map[string]interface{}); ok {
+			if id := stringField(entity, "id"); id != "" {
+				return id
+			}
+		}
+		if id := stringField(rec.data, "entity_id"); id != "" {
+			return id
+		}
+		return rec.module + "-" + stringField(rec.data, "id")
+	}
+	for _, rec := range records {
+		nodeIDs[rec.module+":"+stringField(rec.data, "id")] = "kanka-" + entityID(rec)
+	}
+
+	for _, rec := range records {
+		nodeType, ok := kankaTypes[rec.module]
+		if !ok {
+			r.skipped[rec.module]++
+			continue
+		}
+		if nodeType == "location" && kankaCityTypes[strings.ToLower(stringField(rec.data, "type"))] {
+			nodeType = "city"
+		}
+		r.checkFields(rec.module, rec.data, kankaFields)
+
+		nodeID := "kanka-" + entityID(rec)
+		properties := map[string]interface{}{"source": "Kanka", "sourceId": entityID(rec)}
+		copyProperties(rec.data, kankaFields, properties)
+		// Tags come as IDs or as {"id", "name"} objects; keep the names
+		if tags, ok := properties["tags"].([]interface{}); ok {
+			names := make([]interface{}, len(tags))
+			for i, tag := range tags {
+				names[i] = tag
+				if m, ok := tag.(map[string]interface{}); ok && stringField(m, "name") != "" {
+					names[i] = stringField(m, "name")
+				}
+			}
+			properties["tags"] = names
+		}
+
+		entry, _ := rec.data["entry"].(string)
+		result.Nodes = append(result.Nodes, Node{
+			ID:          nodeID,
+			Name:        stringField(rec.data, "name"),
+			Type:        nodeType,
+			Description: plainText(entry),
+			Properties:  properties,
+		})
+
+		for _, field := range sortedKeys(kankaFields.references) {
+			var ids []interface{}
+			switch v := rec.data[field].(type) {
+			case []interface{}:
+				ids = v
+			case nil:
+			default:
+				ids = []interface{}{v}
+			}
+			for _, id := range ids {
+				ref := map[string]interface{}{"id": id}
+				if m, ok := id.(map[string]interface{}); ok {
+					ref = m
+				}
+				target := nodeIDs[kankaReferenceModules[field]+":"+stringField(ref, "id")]
+				r.edge(result, nodeID, target, kankaFields.references[field])
+			}
+		}
+
+		// Relations set up on the entity itself
+		if entity, ok := rec.data["entity"].(map[string]interface{}); ok {
+			relations, _ := entity["relations"].([]interface{})
+			for _, item := range relations {
+				relation, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				relationship := stringField(relation, "relation")
+				if relationship == "" {
+					relationship = "related to"
+				}
+				r.edge(result, nodeID, "kanka-"+stringField(relation, "target_id"), relationship)
+			}
+		}
+	}
+
+	return r.finish(result), nil
+}
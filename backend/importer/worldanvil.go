@@ -0,0 +1,206 @@
+package importer
+
+import (
+	"encoding/json"
+	"mythsmith-backend/models"
+	"regexp"
+	"strings"
+)
+
+// WorldAnvil reads World Anvil article exports: one JSON object per article,
+// or objects with an "articles" list, either alone or in a zip archive.
+// Articles reference each other with {"id", "title"} objects.
+type WorldAnvil struct{}
+
+func (WorldAnvil) Name() string  { return "worldanvil" }
+func (WorldAnvil) Title() string { return "World Anvil" }
+
+// Article templates (entityClass) and the node types they become
+var worldAnvilTypes = map[string]string{
+	"person":       "character",
+	"organization": "faction",
+	"military":     "faction",
+	"settlement":   "city",
+	"location":     "location",
+	"landmark":     "location",
+	"building":     "location",
+	"geography":    "location",
+	"species":      "species",
+	"report":       "event",
+	"history":      "event",
+}
+
+var worldAnvilFields = fieldMap{
+	properties: map[string]string{
+		"excerpt":       "summary",
+		"subheading":    "subheading",
+		"pronunciation": "pronunciation",
+		"nickname":      "nickname",
+		"honorific":     "honorific",
+		"firstname":     "firstName",
+		"lastname":      "lastName",
+		"gender":        "gender",
+		"pronouns":      "pronouns",
+		"age":           "age",
+		"height":        "height",
+		"weight":        "weight",
+		"motivation":    "motivation",
+		"population":    "population",
+		"demonym":       "demonym",
+		"motto":         "motto",
+		"date":          "date",
+	},
+	references: map[string]string{
+		"parentLocation":  models.RelationshipLocatedIn,
+		"location":        models.RelationshipLocatedIn,
+		"currentLocation": models.RelationshipLocatedIn,
+		"organization":    "member of",
+		"organizations":   "member of",
+		"parent":          models.RelationshipPartOf,
+		"species":         "species",
+		"family":          "related to",
+		"leader":          "led by",
+		"rulers":          "ruled by",
+		"capital":         "capital",
+	},
+	ignored: map[string]bool{
+		"id": true, "title": true, "slug": true, "state": true, "isWip": true, "isDraft": true,
+		"entityClass": true, "template": true, "templateType": true, "content": true, "tags": true,
+		"url": true, "icon": true, "cover": true, "coverSource": true, "portrait": true,
+		"author": true, "world": true, "category": true, "position": true, "wordcount": true,
+		"views": true, "likes": true, "success": true, "isEditable": true, "allowComments": true,
+		"creationDate": true, "updateDate": true, "publicationDate": true, "notificationDate": true,
+	},
+}
+
+// worldAnvilArticles returns the article objects of one file
+func worldAnvilArticles(f File) []map[string]interface{} {
+	var doc interface{}
+	if err := json.Unmarshal(f.Data, &doc); err != nil {
+		return nil
+	}
+	var articles []map[string]interface{}
+	var collect func(v interface{})
+	collect = func(v interface{}) {
+		switch v := v.(type) {
+		case []interface{}:
+			for _, item := range v {
+				collect(item)
+			}
+		case map[string]interface{}:
+			if list, ok := v["articles"]; ok {
+				collect(list)
+				return
+			}
+			if _, ok := v["title"].(string); ok && worldAnvilClass(v) != "" {
+				articles = append(articles, v)
+			}
+		}
+	}
+	collect(doc)
+	return articles
+}
+
+func worldAnvilClass(article map[string]interface{}) string {
+	for _, field := range []string{"entityClass", "template"} {
+		if class := stringField(article, field); class != "" {
+			return strings.ToLower(class)
+		}
+	}
+	return ""
+}
+
+func (WorldAnvil) Detect(files []File) bool {
+	for _, f := range files {
+		if len(worldAnvilArticles(f)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// @[Title](template:id) mentions become wiki-links
+	worldAnvilMention = regexp.MustCompile(`@\[([^\]]+)\]\([a-z]+:[^)]*\)`)
+	bbCodeTag         = regexp.MustCompile(`\[/?[a-zA-Z][a-zA-Z0-9]*(?:[=:][^\]]*)?\]`)
+)
+
+func worldAnvilText(s string) string {
+	s = worldAnvilMention.ReplaceAllString(s, "[[$1]]")
+	// Keep wiki-links while removing BBCode
+	s = strings.NewReplacer("[[", "\x00", "]]", "\x01").Replace(s)
+	s = bbCodeTag.ReplaceAllString(s, "")
+	s = strings.NewReplacer("\x00", "[[", "\x01", "]]").Replace(s)
+	return plainText(s)
+}
+
+// worldAnvilRefs returns the IDs of the articles a field references
+func worldAnvilRefs(v interface{}) []string {
+	var ids []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if id := stringField(v, "id"); id != "" {
+			ids = append(ids, id)
+		}
+	case []interface{}:
+		for _, item := range v {
+			ids = append(ids, worldAnvilRefs(item)...)
+		}
+	}
+	return ids
+}
+
+func (WorldAnvil) Convert(files []File) (*Result, error) {
+	result := &Result{}
+	r := newReport("World Anvil")
+
+	for _, f := range files {
+		for _, article := range worldAnvilArticles(f) {
+			class := worldAnvilClass(article)
+			nodeType, ok := worldAnvilTypes[class]
+			if !ok {
+				r.skipped[class]++
+				continue
+			}
+			id := stringField(article, "id")
+			if id == "" {
+				id = stringField(article, "slug")
+			}
+			if id == "" {
+				r.warn("article %q has no ID and was not imported", stringField(article, "title"))
+				continue
+			}
+			r.checkFields(class, article, worldAnvilFields)
+
+			nodeID := "worldanvil-" + id
+			properties := map[string]interface{}{"source": "World Anvil", "sourceId": id}
+			copyProperties(article, worldAnvilFields, properties)
+			if tags := stringField(article, "tags"); tags != "" {
+				var list []interface{}
+				for _, tag := range strings.Split(tags, ",") {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						list = append(list, tag)
+					}
+				}
+				properties["tags"] = list
+			}
+
+			content, _ := article["content"].(string)
+			result.Nodes = append(result.Nodes, Node{
+				ID:          nodeID,
+				Name:        stringField(article, "title"),
+				Type:        nodeType,
+				Description: worldAnvilText(content),
+				Properties:  properties,
+			})
+
+			for _, field := range sortedKeys(worldAnvilFields.references) {
+				for _, ref := range worldAnvilRefs(article[field]) {
+					r.edge(result, nodeID, "worldanvil-"+ref, worldAnvilFields.references[field])
+				}
+			}
+		}
+	}
+
+	return r.finish(result), nil
+}
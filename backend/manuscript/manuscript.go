@@ -0,0 +1,248 @@
+// Package manuscript parses Markdown and Fountain manuscripts into chapters
+// and scenes and finds mentions of world entities in scene text.
+package manuscript
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Format is a supported manuscript format
+type Format string
+
+const (
+	FormatMarkdown Format = "markdown"
+	FormatFountain Format = "fountain"
+)
+
+// Manuscript is a parsed manuscript
+type Manuscript struct {
+	Title    string
+	Chapters []Chapter
+}
+
+// Chapter is an ordered group of scenes
+type Chapter struct {
+	Title  string
+	Scenes []Scene
+}
+
+// Scene is the unit that appearances are recorded against. POV and Location
+// hold the names written in the manuscript; resolving them to nodes is up to
+// the caller.
+type Scene struct {
+	Title    string
+	POV      string
+	Location string
+	Text     string
+}
+
+// WordCount returns the number of whitespace-separated words in the scene
+func (s Scene) WordCount() int {
+	return len(strings.Fields(s.Text))
+}
+
+// FormatForFile picks the format from a file extension
+func FormatForFile(name string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown":
+		return FormatMarkdown, true
+	case ".fountain", ".spmd":
+		return FormatFountain, true
+	}
+	return "", false
+}
+
+// Parse parses content in the given format
+func Parse(format Format, content string) (*Manuscript, error) {
+	switch format {
+	case FormatMarkdown:
+		return ParseMarkdown(content), nil
+	case FormatFountain:
+		return ParseFountain(content), nil
+	}
+	return nil, fmt.Errorf("unsupported manuscript format %q", format)
+}
+
+var (
+	metadataLine  = regexp.MustCompile(`(?i)^\s*(?:<!--\s*)?(pov|location)\s*:\s*(.+?)\s*(?:-->)?\s*$`)
+	sceneBreak    = regexp.MustCompile(`^(?:\*\s*\*\s*\*[\s*]*|-{3,}|_{3,})$`)
+	titlePageKey  = regexp.MustCompile(`(?i)^(?:title|credit|authors?|source|draft date|date|contact|notes|copyright)\s*:`)
+	sceneHeading  = regexp.MustCompile(`(?i)^(?:int|ext|est|int\./ext|int/ext|i/e)[. ]\s*(.*)$`)
+	fountainNote  = regexp.MustCompile(`(?i)\[\[\s*(pov|location)\s*:\s*(.+?)\s*\]\]`)
+	boneyardBlock = regexp.MustCompile(`(?s)/\*.*?\*/`)
+)
+
+// builder accumulates chapters and scenes while a parser walks the lines
+type builder struct {
+	ms      Manuscript
+	text    []string
+	started bool
+}
+
+func (b *builder) chapter(title string) {
+	b.flush()
+	b.ms.Chapters = append(b.ms.Chapters, Chapter{Title: title})
+	b.started = false
+}
+
+func (b *builder) scene(title string) {
+	b.flush()
+	if len(b.ms.Chapters) == 0 {
+		b.ms.Chapters = append(b.ms.Chapters, Chapter{})
+	}
+	ch := &b.ms.Chapters[len(b.ms.Chapters)-1]
+	ch.Scenes = append(ch.Scenes, Scene{Title: title})
+	b.started = true
+}
+
+func (b *builder) current() *Scene {
+	if !b.started {
+		b.scene("")
+	}
+	ch := &b.ms.Chapters[len(b.ms.Chapters)-1]
+	return &ch.Scenes[len(ch.Scenes)-1]
+}
+
+func (b *builder) line(line string) {
+	if !b.started && strings.TrimSpace(line) == "" {
+		return
+	}
+	b.current()
+	b.text = append(b.text, line)
+}
+
+// flush stores the collected text on the open scene, dropping scenes that
+// turned out to be empty so stray breaks don't create phantom scenes
+func (b *builder) flush() {
+	if !b.started {
+		return
+	}
+	ch := &b.ms.Chapters[len(b.ms.Chapters)-1]
+	sc := &ch.Scenes[len(ch.Scenes)-1]
+	sc.Text = strings.TrimSpace(strings.Join(b.text, "\n"))
+	if sc.Text == "" && sc.Title == "" && sc.POV == "" && sc.Location == "" {
+		ch.Scenes = ch.Scenes[:len(ch.Scenes)-1]
+	}
+	b.text = nil
+	b.started = false
+}
+
+func (b *builder) finish() *Manuscript {
+	b.flush()
+	return &b.ms
+}
+
+// ParseMarkdown reads "# " headings as chapters and "## " headings or
+// thematic breaks as scenes. "POV: Name" and "Location: Name" lines (also
+// inside HTML comments) set scene metadata. A leading front matter block may
+// give the title.
+func ParseMarkdown(content string) *Manuscript {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	b := &builder{}
+
+	// Front matter
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "---" {
+				lines = lines[i+1:]
+				break
+			}
+			if key, value, ok := strings.Cut(lines[i], ":"); ok && strings.EqualFold(strings.TrimSpace(key), "title") {
+				b.ms.Title = strings.Trim(strings.TrimSpace(value), `"'`)
+			}
+		}
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "## "):
+			b.scene(strings.TrimSpace(trimmed[3:]))
+		case strings.HasPrefix(trimmed, "# "):
+			b.chapter(strings.TrimSpace(trimmed[2:]))
+		case sceneBreak.MatchString(trimmed):
+			b.scene("")
+		default:
+			if m := metadataLine.FindStringSubmatch(line); m != nil {
+				setMetadata(b.current(), m[1], m[2])
+				continue
+			}
+			b.line(line)
+		}
+	}
+
+	return b.finish()
+}
+
+// ParseFountain reads level-one sections ("# Act One") as chapters and scene
+// headings (INT./EXT. or forced ".HEADING") as scenes. The location is taken
+// from the heading, and [[POV: Name]] notes set the point of view.
+func ParseFountain(content string) *Manuscript {
+	content = boneyardBlock.ReplaceAllString(strings.ReplaceAll(content, "\r\n", "\n"), "")
+	lines := strings.Split(content, "\n")
+	b := &builder{}
+
+	// Title page: key/value pairs up to the first blank line
+	if len(lines) > 0 && titlePageKey.MatchString(lines[0]) {
+		for i, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				lines = lines[i:]
+				break
+			}
+			if key, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(key), "title") {
+				b.ms.Title = strings.TrimSpace(value)
+			}
+		}
+	}
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		previousBlank := i == 0 || strings.TrimSpace(lines[i-1]) == ""
+
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			if level == 1 {
+				b.chapter(strings.TrimSpace(trimmed[1:]))
+			}
+		case previousBlank && strings.HasPrefix(trimmed, ".") && !strings.HasPrefix(trimmed, ".."):
+			b.scene(trimmed[1:])
+			b.current().Location = headingLocation(trimmed[1:])
+		case previousBlank && sceneHeading.MatchString(trimmed):
+			b.scene(trimmed)
+			b.current().Location = headingLocation(sceneHeading.FindStringSubmatch(trimmed)[1])
+		default:
+			for _, m := range fountainNote.FindAllStringSubmatch(line, -1) {
+				setMetadata(b.current(), m[1], m[2])
+			}
+			if stripped := fountainNote.ReplaceAllString(line, ""); strings.TrimSpace(stripped) != "" || trimmed == "" {
+				b.line(stripped)
+			}
+		}
+	}
+
+	return b.finish()
+}
+
+// headingLocation drops the time of day and scene number from a scene heading:
+// "TAVERN - NIGHT #12#" becomes "TAVERN"
+func headingLocation(heading string) string {
+	if i := strings.Index(heading, "#"); i >= 0 {
+		heading = heading[:i]
+	}
+	if before, _, ok := strings.Cut(heading, " - "); ok {
+		heading = before
+	}
+	return strings.TrimSpace(heading)
+}
+
+func setMetadata(scene *Scene, key, value string) {
+	if strings.EqualFold(key, "pov") {
+		scene.POV = value
+	} else {
+		scene.Location = value
+	}
+}
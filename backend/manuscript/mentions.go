@@ -0,0 +1,115 @@
+package manuscript
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Term is a name or alias that identifies a node in text
+type Term struct {
+	NodeID string
+	Text   string
+}
+
+// Mention counts the occurrences of one node in a text
+type Mention struct {
+	NodeID      string
+	Count       int
+	FirstOffset int    // Byte offset of the first occurrence
+	Matched     string // Text of the first occurrence as written
+}
+
+// FindMentions finds whole-word, case-insensitive occurrences of the terms in
+// text. Longer terms win over shorter ones they overlap with, so "Minas
+// Tirith" is not also counted as a mention of "Minas". Mentions are returned
+// in order of first appearance.
+func FindMentions(text string, terms []Term) []Mention {
+	sorted := make([]Term, 0, len(terms))
+	for _, t := range terms {
+		if utf8.RuneCountInString(strings.TrimSpace(t.Text)) >= 2 {
+			sorted = append(sorted, t)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i].Text) > len(sorted[j].Text) })
+
+	// Matching runs on a lowercased copy. Lowercasing can change byte lengths
+	// for some scripts, so offsets are only exact when it does not.
+	lower := strings.ToLower(text)
+	sameLength := len(lower) == len(text)
+	claimed := make([]bool, len(lower))
+	byNode := make(map[string]*Mention)
+
+	for _, term := range sorted {
+		needle := strings.ToLower(strings.TrimSpace(term.Text))
+		for start := 0; start < len(lower); {
+			i := strings.Index(lower[start:], needle)
+			if i < 0 {
+				break
+			}
+			i += start
+			end := i + len(needle)
+			start = i + 1
+
+			if !isBoundary(lower, i, end) || anyClaimed(claimed, i, end) {
+				continue
+			}
+			for k := i; k < end; k++ {
+				claimed[k] = true
+			}
+
+			m, ok := byNode[term.NodeID]
+			if !ok {
+				m = &Mention{NodeID: term.NodeID, FirstOffset: i, Matched: term.Text}
+				if sameLength {
+					m.Matched = text[i:end]
+				}
+				byNode[term.NodeID] = m
+			} else if i < m.FirstOffset {
+				m.FirstOffset = i
+				if sameLength {
+					m.Matched = text[i:end]
+				}
+			}
+			m.Count++
+		}
+	}
+
+	mentions := make([]Mention, 0, len(byNode))
+	for _, m := range byNode {
+		mentions = append(mentions, *m)
+	}
+	sort.Slice(mentions, func(i, j int) bool { return mentions[i].FirstOffset < mentions[j].FirstOffset })
+	return mentions
+}
+
+// isBoundary reports whether s[start:end] is not part of a longer word
+func isBoundary(s string, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(s[:start])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	if end < len(s) {
+		r, _ := utf8.DecodeRuneInString(s[end:])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func anyClaimed(claimed []bool, start, end int) bool {
+	for i := start; i < end; i++ {
+		if claimed[i] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,534 @@
+// Package mapgen draws a made-up continent from a seed. Elevation is layered
+// value noise shaped into an island; biomes are chosen per Voronoi cell from
+// elevation, moisture and temperature; rivers run downhill from cell to cell
+// until they reach the sea. The same options always give the same map.
+package mapgen
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"mythsmith-backend/namegen"
+	"sort"
+)
+
+// Kinds of site placed on the map
+const (
+	SiteCity     = "city"
+	SiteLocation = "location"
+)
+
+// Options controls the map drawn
+type Options struct {
+	Seed      int64
+	Width     int
+	Height    int
+	Cities    int // Settlements to place
+	Locations int // Natural features to place
+}
+
+// Site is a settlement or natural feature placed on the map, in pixels
+type Site struct {
+	Kind  string
+	Name  string
+	Biome string
+	X     float64
+	Y     float64
+}
+
+// Map is a generated map image with its sites
+type Map struct {
+	Image *image.NRGBA
+	Sites []Site
+}
+
+type biome struct {
+	name     string
+	color    color.NRGBA
+	features []string // Nouns for features named after the biome
+	settle   float64  // How readily settlements grow here, from 0 to 1
+	feature  float64  // How readily a natural feature is placed here, from 0 to 1
+}
+
+var (
+	snow      = &biome{"snow", color.NRGBA{236, 240, 243, 255}, []string{"Icefield", "Glacier", "Snows"}, 0, 0.8}
+	tundra    = &biome{"tundra", color.NRGBA{178, 181, 158, 255}, []string{"Barrens", "Wastes", "Tundra"}, 0.2, 0.6}
+	mountains = &biome{"mountains", color.NRGBA{138, 124, 106, 255}, []string{"Peaks", "Mountains", "Spires", "Crags"}, 0.1, 1}
+	hills     = &biome{"hills", color.NRGBA{158, 156, 104, 255}, []string{"Hills", "Downs", "Heights"}, 0.6, 0.6}
+	desert    = &biome{"desert", color.NRGBA{220, 198, 139, 255}, []string{"Sands", "Dunes", "Waste"}, 0.2, 0.8}
+	grassland = &biome{"grassland", color.NRGBA{164, 193, 112, 255}, []string{"Plains", "Fields", "Steppe"}, 1, 0.3}
+	forest    = &biome{"forest", color.NRGBA{95, 143, 78, 255}, []string{"Wood", "Forest", "Weald"}, 0.7, 0.7}
+	jungle    = &biome{"jungle", color.NRGBA{63, 122, 58, 255}, []string{"Jungle", "Tangle", "Wilds"}, 0.4, 0.7}
+	marsh     = &biome{"marsh", color.NRGBA{111, 138, 100, 255}, []string{"Marsh", "Fen", "Mire"}, 0.2, 0.8}
+)
+
+var (
+	shallowWater = color.NRGBA{127, 180, 214, 255}
+	deepWater    = color.NRGBA{45, 90, 138, 255}
+	sand         = color.NRGBA{224, 211, 160, 255}
+	riverColor   = color.NRGBA{79, 134, 184, 255}
+	coastColor   = color.NRGBA{59, 74, 82, 255}
+)
+
+// classify picks a biome from elevation above the sea (0 at the coast, 1 at
+// the highest peak), moisture and temperature, each from 0 to 1
+func classify(elevation, moisture, temperature float64) *biome {
+	switch {
+	case elevation > 0.75:
+		if temperature < 0.35 {
+			return snow
+		}
+		return mountains
+	case elevation > 0.5:
+		if temperature < 0.15 {
+			return snow
+		}
+		return mountains
+	case elevation > 0.3:
+		return hills
+	case temperature < 0.2:
+		return snow
+	case temperature < 0.32:
+		return tundra
+	case moisture < 0.3:
+		if temperature > 0.55 {
+			return desert
+		}
+		return grassland
+	case moisture < 0.5:
+		return grassland
+	case moisture < 0.75 || elevation > 0.1:
+		if temperature > 0.7 {
+			return jungle
+		}
+		return forest
+	default:
+		return marsh
+	}
+}
+
+// noise is seeded value noise
+type noise uint64
+
+func mix(h uint64) uint64 {
+	h ^= h >> 31
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+func (n noise) lattice(ix, iy int) float64 {
+	h := mix(uint64(n) ^ uint64(int64(ix))*0x9e3779b97f4a7c15 ^ uint64(int64(iy))*0xc2b2ae3d27d4eb4f)
+	return float64(h>>11) / (1 << 53)
+}
+
+func smooth(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+func (n noise) at(x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	ix, iy := int(x0), int(y0)
+	fx, fy := smooth(x-x0), smooth(y-y0)
+	top := lerp(n.lattice(ix, iy), n.lattice(ix+1, iy), fx)
+	bottom := lerp(n.lattice(ix, iy+1), n.lattice(ix+1, iy+1), fx)
+	return lerp(top, bottom, fy)
+}
+
+// fbm sums octaves of noise, each at twice the frequency and half the
+// amplitude of the last, scaled back to 0..1
+func (n noise) fbm(x, y float64, octaves int) float64 {
+	sum, amplitude, total := 0.0, 1.0, 0.0
+	for i := 0; i < octaves; i++ {
+		sum += amplitude * noise(mix(uint64(n)+uint64(i))).at(x, y)
+		total += amplitude
+		amplitude /= 2
+		x, y = x*2, y*2
+	}
+	return sum / total
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+type generator struct {
+	opts                   Options
+	size                   float64 // Longer side of the image
+	elevation, warp, moist noise
+	heat                   noise
+	cellSize               float64
+	gridW, gridH           int
+	sites                  []Site // Voronoi sites, one per grid cell
+	cellHeight             []float64
+	cellBiome              []*biome
+	cellRiver              []bool
+	rivers                 [][]int   // Cells each river flows through
+	heights                []float64 // Per pixel
+	maxHeight              float64
+}
+
+// height returns the elevation at a pixel; the sea is below 0
+func (g *generator) height(x, y float64) float64 {
+	u, v := x/g.size, y/g.size
+	wx := g.warp.fbm(u*3, v*3, 2) - 0.5
+	wy := g.warp.fbm(u*3+5.2, v*3+1.3, 2) - 0.5
+	n := (g.elevation.fbm((u+wx*0.3)*4, (v+wy*0.3)*4, 6) - 0.5) * 2
+
+	// Fall away towards the edges so the land forms a continent
+	dx := (x/float64(g.opts.Width) - 0.5) * 2
+	dy := (y/float64(g.opts.Height) - 0.5) * 2
+	return n + 0.3 - 0.8*(dx*dx+dy*dy)
+}
+
+// cellAt returns the Voronoi cell nearest a pixel, looking at the grid cells
+// around it
+func (g *generator) cellAt(x, y float64) int {
+	gx, gy := int(x/g.cellSize), int(y/g.cellSize)
+	best, bestDist := 0, math.Inf(1)
+	for j := gy - 1; j <= gy+1; j++ {
+		for i := gx - 1; i <= gx+1; i++ {
+			if i < 0 || j < 0 || i >= g.gridW || j >= g.gridH {
+				continue
+			}
+			cell := j*g.gridW + i
+			dx, dy := g.sites[cell].X-x, g.sites[cell].Y-y
+			if d := dx*dx + dy*dy; d < bestDist {
+				best, bestDist = cell, d
+			}
+		}
+	}
+	return best
+}
+
+// neighbours returns the cells of the grid around a cell
+func (g *generator) neighbours(cell int) []int {
+	gx, gy := cell%g.gridW, cell/g.gridW
+	var out []int
+	for j := gy - 1; j <= gy+1; j++ {
+		for i := gx - 1; i <= gx+1; i++ {
+			if (i != gx || j != gy) && i >= 0 && j >= 0 && i < g.gridW && j < g.gridH {
+				out = append(out, j*g.gridW+i)
+			}
+		}
+	}
+	return out
+}
+
+// Generate draws a map. Width and height must be positive.
+func Generate(opts Options) *Map {
+	rng := rand.New(rand.NewSource(opts.Seed))
+	seed := uint64(opts.Seed)
+	g := &generator{
+		opts:      opts,
+		size:      math.Max(float64(opts.Width), float64(opts.Height)),
+		elevation: noise(mix(seed + 1)),
+		warp:      noise(mix(seed + 2)),
+		moist:     noise(mix(seed + 3)),
+		heat:      noise(mix(seed + 4)),
+	}
+	g.cellSize = math.Max(8, g.size/64)
+	g.gridW = int(math.Ceil(float64(opts.Width) / g.cellSize))
+	g.gridH = int(math.Ceil(float64(opts.Height) / g.cellSize))
+
+	g.heights = make([]float64, opts.Width*opts.Height)
+	for y := 0; y < opts.Height; y++ {
+		for x := 0; x < opts.Width; x++ {
+			h := g.height(float64(x)+0.5, float64(y)+0.5)
+			g.heights[y*opts.Width+x] = h
+			g.maxHeight = math.Max(g.maxHeight, h)
+		}
+	}
+	if g.maxHeight <= 0 {
+		g.maxHeight = 1
+	}
+
+	g.placeCells(rng)
+	g.traceRivers(rng)
+	img := g.draw()
+	g.drawRivers(img, rng)
+	g.drawCoast(img)
+
+	names := namegen.New(rand.New(rand.NewSource(int64(mix(seed + 5)))))
+	return &Map{Image: img, Sites: g.placeSites(rng, names)}
+}
+
+// placeCells scatters one Voronoi site in each grid cell and chooses the
+// cell's biome
+func (g *generator) placeCells(rng *rand.Rand) {
+	count := g.gridW * g.gridH
+	g.sites = make([]Site, count)
+	g.cellHeight = make([]float64, count)
+	g.cellBiome = make([]*biome, count)
+	g.cellRiver = make([]bool, count)
+	for j := 0; j < g.gridH; j++ {
+		for i := 0; i < g.gridW; i++ {
+			cell := j*g.gridW + i
+			x := math.Min((float64(i)+0.1+0.8*rng.Float64())*g.cellSize, float64(g.opts.Width)-1)
+			y := math.Min((float64(j)+0.1+0.8*rng.Float64())*g.cellSize, float64(g.opts.Height)-1)
+			g.sites[cell] = Site{X: x, Y: y}
+
+			h := g.height(x, y)
+			g.cellHeight[cell] = h
+			elevation := clamp01(h / g.maxHeight)
+			moisture := clamp01((g.moist.fbm(x/g.size*3, y/g.size*3, 4)-0.5)*2.2 + 0.5)
+			// Colder to the north and up high
+			temperature := clamp01(0.2 + 0.8*y/float64(g.opts.Height) - 0.25*elevation + (g.heat.fbm(x/g.size*2, y/g.size*2, 3)-0.5)*0.4)
+			g.cellBiome[cell] = classify(elevation, moisture, temperature)
+		}
+	}
+}
+
+// traceRivers runs rivers downhill from high ground until they reach the sea
+// or join another river. A river in a hollow spills over its lowest rim, as
+// a lake would; one that never reaches the sea is dropped.
+func (g *generator) traceRivers(rng *rand.Rand) {
+	var sources []int
+	for cell, h := range g.cellHeight {
+		if h/g.maxHeight > 0.35 && g.cellBiome[cell] != desert {
+			sources = append(sources, cell)
+		}
+	}
+	rng.Shuffle(len(sources), func(i, j int) { sources[i], sources[j] = sources[j], sources[i] })
+
+	want := 2 + g.opts.Width*g.opts.Height/200000
+	for _, source := range sources {
+		if len(g.rivers) == want {
+			break
+		}
+		if g.cellRiver[source] {
+			continue
+		}
+		path := []int{source}
+		onPath := map[int]bool{source: true}
+		ended := false
+		for cur := source; !ended && len(path) < 500; {
+			next := -1
+			for _, n := range g.neighbours(cur) {
+				if !onPath[n] && (next < 0 || g.cellHeight[n] < g.cellHeight[next]) {
+					next = n
+				}
+			}
+			if next < 0 {
+				break
+			}
+			path = append(path, next)
+			onPath[next] = true
+			ended = g.cellHeight[next] <= 0 || g.cellRiver[next]
+			cur = next
+		}
+		if !ended || len(path) < 4 {
+			continue
+		}
+		for _, cell := range path {
+			if g.cellHeight[cell] > 0 {
+				g.cellRiver[cell] = true
+			}
+		}
+		g.rivers = append(g.rivers, path)
+	}
+}
+
+func blend(a, b color.NRGBA, t float64) color.NRGBA {
+	return color.NRGBA{
+		R: uint8(lerp(float64(a.R), float64(b.R), t)),
+		G: uint8(lerp(float64(a.G), float64(b.G), t)),
+		B: uint8(lerp(float64(a.B), float64(b.B), t)),
+		A: 255,
+	}
+}
+
+func shade(c color.NRGBA, light float64) color.NRGBA {
+	return color.NRGBA{
+		R: uint8(math.Min(255, float64(c.R)*light)),
+		G: uint8(math.Min(255, float64(c.G)*light)),
+		B: uint8(math.Min(255, float64(c.B)*light)),
+		A: 255,
+	}
+}
+
+// draw colours the sea by depth and the land by its cell's biome, lit from
+// the north-west
+func (g *generator) draw() *image.NRGBA {
+	w, h := g.opts.Width, g.opts.Height
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			height := g.heights[y*w+x]
+			var c color.NRGBA
+			if height <= 0 {
+				c = blend(shallowWater, deepWater, math.Sqrt(clamp01(-height/0.3)))
+			} else {
+				b := g.cellBiome[g.cellAt(float64(x)+0.5, float64(y)+0.5)]
+				c = b.color
+				if height < 0.02 && b != snow && b != marsh {
+					c = blend(sand, c, height/0.02)
+				}
+				x0, y0 := max(x-1, 0), max(y-1, 0)
+				x1, y1 := min(x+1, w-1), min(y+1, h-1)
+				slope := (g.heights[y0*w+x0] - g.heights[y1*w+x1]) * g.size / 16
+				c = shade(c, 1+math.Max(-0.15, math.Min(0.15, slope)))
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// drawRivers draws each river as a wandering line through its cells,
+// widening towards its mouth. Rivers are only drawn on land.
+func (g *generator) drawRivers(img *image.NRGBA, rng *rand.Rand) {
+	scale := g.size / 1600
+	for _, path := range g.rivers {
+		points := make([]Site, len(path))
+		for i, cell := range path {
+			points[i] = g.sites[cell]
+		}
+		// Bend each stretch twice by nudging its midpoint sideways
+		for pass := 0; pass < 2; pass++ {
+			bent := []Site{points[0]}
+			for i := 1; i < len(points); i++ {
+				a, b := points[i-1], points[i]
+				offset := (rng.Float64() - 0.5) * 0.5
+				bent = append(bent, Site{X: (a.X+b.X)/2 - (b.Y-a.Y)*offset, Y: (a.Y+b.Y)/2 + (b.X-a.X)*offset}, b)
+			}
+			points = bent
+		}
+
+		for i := 1; i < len(points); i++ {
+			a, b := points[i-1], points[i]
+			radius := (1 + 1.8*float64(i)/float64(len(points))) * math.Max(1, scale)
+			steps := int(math.Ceil(math.Hypot(b.X-a.X, b.Y-a.Y) * 2))
+			for k := 0; k <= steps; k++ {
+				t := float64(k) / float64(max(steps, 1))
+				g.stamp(img, lerp(a.X, b.X, t), lerp(a.Y, b.Y, t), radius)
+			}
+		}
+	}
+}
+
+// stamp paints a disc of river on land
+func (g *generator) stamp(img *image.NRGBA, cx, cy, radius float64) {
+	w, h := g.opts.Width, g.opts.Height
+	for y := int(cy - radius); y <= int(cy+radius); y++ {
+		for x := int(cx - radius); x <= int(cx+radius); x++ {
+			if x < 0 || y < 0 || x >= w || y >= h || g.heights[y*w+x] <= 0 {
+				continue
+			}
+			if dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy; dx*dx+dy*dy <= radius*radius {
+				img.SetNRGBA(x, y, riverColor)
+			}
+		}
+	}
+}
+
+// drawCoast outlines land that borders the sea
+func (g *generator) drawCoast(img *image.NRGBA) {
+	w, h := g.opts.Width, g.opts.Height
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if g.heights[y*w+x] <= 0 {
+				continue
+			}
+			if (x > 0 && g.heights[y*w+x-1] <= 0) || (x < w-1 && g.heights[y*w+x+1] <= 0) ||
+				(y > 0 && g.heights[(y-1)*w+x] <= 0) || (y < h-1 && g.heights[(y+1)*w+x] <= 0) {
+				img.SetNRGBA(x, y, coastColor)
+			}
+		}
+	}
+}
+
+// coastal reports whether a land cell borders the sea
+func (g *generator) coastal(cell int) bool {
+	for _, n := range g.neighbours(cell) {
+		if g.cellHeight[n] <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// placeSites picks the best-suited land cells for settlements, favouring
+// coasts and rivers, and then for natural features, keeping every site apart
+// from the others
+func (g *generator) placeSites(rng *rand.Rand, names *namegen.Generator) []Site {
+	margin := g.cellSize
+	var land []int
+	for cell, h := range g.cellHeight {
+		s := g.sites[cell]
+		if h > 0 && s.X > margin && s.Y > margin && s.X < float64(g.opts.Width)-margin && s.Y < float64(g.opts.Height)-margin {
+			land = append(land, cell)
+		}
+	}
+	if len(land) == 0 {
+		return []Site{}
+	}
+	// Space sites so the wanted number could spread over the land
+	landArea := float64(len(land)) * g.cellSize * g.cellSize
+	spacing := math.Sqrt(landArea/float64(max(g.opts.Cities+g.opts.Locations, 1))) * 0.6
+
+	placed := []Site{}
+	pick := func(count int, score func(cell int) float64, name func(b *biome) string, kind string) {
+		scores := make([]float64, len(g.cellHeight))
+		candidates := []int{}
+		for _, cell := range land {
+			if s := score(cell); s > 0 {
+				scores[cell] = s + rng.Float64()*0.3
+				candidates = append(candidates, cell)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return scores[candidates[i]] > scores[candidates[j]] })
+
+		taken := 0
+		// Relax the spacing when too few sites fit
+		for gap := spacing; taken < count && gap >= g.cellSize/2; gap /= 2 {
+			for _, cell := range candidates {
+				if taken == count {
+					break
+				}
+				s := g.sites[cell]
+				clear := true
+				for _, other := range placed {
+					if math.Hypot(other.X-s.X, other.Y-s.Y) < gap {
+						clear = false
+						break
+					}
+				}
+				if !clear {
+					continue
+				}
+				b := g.cellBiome[cell]
+				placed = append(placed, Site{Kind: kind, Name: name(b), Biome: b.name, X: math.Round(s.X), Y: math.Round(s.Y)})
+				taken++
+			}
+		}
+	}
+
+	pick(g.opts.Cities, func(cell int) float64 {
+		b := g.cellBiome[cell]
+		if b.settle == 0 {
+			return 0
+		}
+		score := b.settle
+		if g.coastal(cell) {
+			score += 0.6
+		}
+		if g.cellRiver[cell] {
+			score += 0.8
+		}
+		return score
+	}, func(*biome) string { return names.Settlement() }, SiteCity)
+
+	pick(g.opts.Locations, func(cell int) float64 {
+		return g.cellBiome[cell].feature
+	}, func(b *biome) string { return names.Feature(b.features) }, SiteLocation)
+
+	return placed
+}
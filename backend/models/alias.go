@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// NodeAlias is an alternative name for a node, such as an epithet or a
+// city's older name
+type NodeAlias struct {
+	ID        string    `json:"id"`
+	NodeID    string    `json:"nodeId"`
+	Alias     string    `json:"alias"`
+	Language  string    `json:"language,omitempty"`
+	Era       string    `json:"era,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// NodeAliasRequest is the body for creating or updating an alias
+type NodeAliasRequest struct {
+	Alias    string `json:"alias" binding:"required"`
+	Language string `json:"language"`
+	Era      string `json:"era"`
+}
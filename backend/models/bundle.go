@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// BundleManifest describes the contents of a .mythsmith bundle. It is stored
+// as manifest.json at the root of the archive.
+type BundleManifest struct {
+	Format    string       `json:"format"` // Always "mythsmith"
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"createdAt"`
+	NodeCount int          `json:"nodeCount"`
+	EdgeCount int          `json:"edgeCount"`
+	MapCount  int          `json:"mapCount"`
+	Files     []BundleFile `json:"files"` // Every other file in the archive
+}
+
+// BundleFile is one file listed in a bundle manifest
+type BundleFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Campaign is a group of players exploring the world, with its own fog of
+// war on each map
+type Campaign struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// CampaignRequest is the body for creating or updating a campaign
+type CampaignRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// FogReveal is a polygon of a map a campaign's players can see
+type FogReveal struct {
+	ID         string        `json:"id"`
+	CampaignID string        `json:"campaignId"`
+	MapID      string        `json:"mapId"`
+	Points     []MapPosition `json:"points"`
+	CreatedAt  time.Time     `json:"createdAt"`
+}
+
+// FogRevealRequest reveals a polygon of a map
+type FogRevealRequest struct {
+	Points []MapPosition `json:"points" binding:"required"`
+}
+
+// PlayerMapView is what a campaign's players may see of a map: the revealed
+// regions, the shapes of visible layers lying wholly within them, and the
+// pins inside them. Hidden layers and everything under the fog are left out.
+type PlayerMapView struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Width    int             `json:"width"`
+	Height   int             `json:"height"`
+	MaxZoom  int             `json:"maxZoom"`
+	TileSize int             `json:"tileSize"`
+	Revealed [][]MapPosition `json:"revealed"`
+	Layers   []PlayerLayer   `json:"layers"`
+	Pins     []PlayerPin     `json:"pins"`
+}
+
+// PlayerLayer is a visible layer with its revealed shapes
+type PlayerLayer struct {
+	ID     string        `json:"id"`
+	Name   string        `json:"name"`
+	Color  string        `json:"color,omitempty"`
+	Shapes []PlayerShape `json:"shapes"`
+}
+
+// PlayerShape is a revealed shape
+type PlayerShape struct {
+	ID     string        `json:"id"`
+	Name   string        `json:"name,omitempty"`
+	Points []MapPosition `json:"points"`
+	Color  string        `json:"color,omitempty"`
+}
+
+// PlayerPin is a revealed pin. Label is the pin's label or its node's name.
+type PlayerPin struct {
+	ID       string  `json:"id"`
+	LayerID  string  `json:"layerId,omitempty"`
+	NodeType string  `json:"nodeType"`
+	Label    string  `json:"label"`
+	Icon     string  `json:"icon,omitempty"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+}
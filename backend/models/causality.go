@@ -0,0 +1,18 @@
+package models
+
+// Causal relationships between event nodes. An edge with RelationshipCauses
+// reads "source causes target"; RelationshipCausedBy reads "source is caused
+// by target".
+const (
+	RelationshipCauses   = "causes"
+	RelationshipCausedBy = "caused_by"
+)
+
+// CausalEvent is an event reached while walking the causality graph
+type CausalEvent struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Date  string `json:"date,omitempty"`
+	Depth int    `json:"depth"`
+	Via   string `json:"via,omitempty"` // Neighbouring event on the chain towards the start
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Change is an entry in the change feed
+type Change struct {
+	ID        int64                  `json:"id"`
+	Entity    string                 `json:"entity"`
+	EntityID  string                 `json:"entityId"`
+	Action    string                 `json:"action"`
+	Summary   string                 `json:"summary"`
+	Details   map[string]interface{} `json:"details"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // Add this to your models package (models.go or similar):
 type ImportData struct {
 	Version    string                   `json:"version"`
@@ -14,3 +16,47 @@ type ImportMetadata struct {
 	EdgeCount  int    `json:"edgeCount"`
 	AppVersion string `json:"appVersion,omitempty"`
 }
+
+// EdgeRef identifies an edge in API responses
+type EdgeRef struct {
+	ID           string `json:"id"`
+	Source       string `json:"source"`
+	Target       string `json:"target"`
+	Relationship string `json:"relationship"`
+}
+
+// ImportChange is a node or edge an import would modify in place
+type ImportChange struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name,omitempty"`
+	Fields []string `json:"fields"` // Names of the fields that would change
+}
+
+// ImportDiff describes what an import would do to the world
+type ImportDiff struct {
+	NodesAdded   []NodeRef         `json:"nodesAdded"`
+	NodesChanged []ImportChange    `json:"nodesChanged"`
+	NodesDeleted []NodeRef         `json:"nodesDeleted"`
+	EdgesAdded   []EdgeRef         `json:"edgesAdded"`
+	EdgesChanged []ImportChange    `json:"edgesChanged"`
+	EdgesDeleted []EdgeRef         `json:"edgesDeleted"`
+	NodeIDRemaps map[string]string `json:"nodeIdRemaps"` // Imported ID -> stored ID
+	EdgeIDRemaps map[string]string `json:"edgeIdRemaps"`
+	SkippedEdges []string          `json:"skippedEdges"`
+	Warnings     []string          `json:"warnings"`
+	Conflicts    []string          `json:"conflicts"`
+}
+
+// ImportBatch records one committed import so it can be traced and reverted
+type ImportBatch struct {
+	ID           string    `json:"id"`
+	Source       string    `json:"source"` // Filename the data came from, if the client sent one
+	Strategy     string    `json:"strategy"`
+	NodesCreated int       `json:"nodesCreated"`
+	EdgesCreated int       `json:"edgesCreated"`
+	NodesUpdated int       `json:"nodesUpdated"`
+	EdgesUpdated int       `json:"edgesUpdated"`
+	NodesDeleted int       `json:"nodesDeleted"`
+	EdgesDeleted int       `json:"edgesDeleted"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// MapLayer is a named group of polygons and pins on a world map, such as
+// political borders or trade routes. Hidden layers are only ever shown to
+// the GM.
+type MapLayer struct {
+	ID         string    `json:"id"`
+	MapID      string    `json:"mapId"`
+	Name       string    `json:"name"`
+	Color      string    `json:"color,omitempty"` // "#rrggbb"; shapes default to it
+	Hidden     bool      `json:"hidden"`
+	SortOrder  int       `json:"sortOrder"` // Layers are drawn in ascending order
+	ShapeCount int       `json:"shapeCount"`
+	PinCount   int       `json:"pinCount"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// MapLayerRequest is the body for creating or updating a layer
+type MapLayerRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Color     string `json:"color"`
+	Hidden    bool   `json:"hidden"`
+	SortOrder int    `json:"sortOrder"`
+}
+
+// MapShape is a polygon on a layer, in map image pixels
+type MapShape struct {
+	ID        string        `json:"id"`
+	LayerID   string        `json:"layerId"`
+	Name      string        `json:"name,omitempty"`
+	Points    []MapPosition `json:"points"`
+	Color     string        `json:"color,omitempty"` // Overrides the layer's color
+	CreatedAt time.Time     `json:"createdAt"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+// MapShapeRequest is the body for creating or updating a shape
+type MapShapeRequest struct {
+	Name   string        `json:"name"`
+	Points []MapPosition `json:"points" binding:"required"`
+	Color  string        `json:"color"`
+}
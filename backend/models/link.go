@@ -0,0 +1,17 @@
+package models
+
+// WikiLink is one [[...]] link written in a node description
+type WikiLink struct {
+	Target   string `json:"target"`
+	Label    string `json:"label,omitempty"`
+	Position int    `json:"position"`
+}
+
+// Backlink is a node whose description links to another node
+type Backlink struct {
+	NodeID string     `json:"nodeId"`
+	Name   string     `json:"name"`
+	Type   NodeType   `json:"type"`
+	Count  int        `json:"count"`
+	Links  []WikiLink `json:"links"`
+}
@@ -0,0 +1,83 @@
+package models
+
+import "time"
+
+// ManuscriptSummary describes an imported manuscript
+type ManuscriptSummary struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Format       string    `json:"format"`
+	SourcePath   string    `json:"sourcePath,omitempty"`
+	ChapterCount int       `json:"chapterCount"`
+	SceneCount   int       `json:"sceneCount"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// ChapterView is a chapter with its scenes in reading order
+type ChapterView struct {
+	ID      string      `json:"id"`
+	Ordinal int         `json:"ordinal"`
+	Title   string      `json:"title"`
+	Scenes  []SceneView `json:"scenes"`
+}
+
+// SceneView is a scene without its text
+type SceneView struct {
+	ID             string           `json:"id"`
+	Ordinal        int              `json:"ordinal"`
+	Title          string           `json:"title"`
+	POVName        string           `json:"povName,omitempty"`
+	POVNodeID      string           `json:"povNodeId,omitempty"`
+	LocationName   string           `json:"locationName,omitempty"`
+	LocationNodeID string           `json:"locationNodeId,omitempty"`
+	WordCount      int              `json:"wordCount"`
+	Appearances    []SceneAppearing `json:"appearances"`
+}
+
+// SceneAppearing is a node that appears in a scene
+type SceneAppearing struct {
+	NodeID       string `json:"nodeId"`
+	Name         string `json:"name"`
+	MentionCount int    `json:"mentionCount"`
+}
+
+// Appearance is one scene a node appears in, with enough context to find it
+type Appearance struct {
+	ManuscriptID    string `json:"manuscriptId"`
+	ManuscriptTitle string `json:"manuscriptTitle"`
+	ChapterID       string `json:"chapterId"`
+	ChapterOrdinal  int    `json:"chapterOrdinal"`
+	ChapterTitle    string `json:"chapterTitle"`
+	SceneID         string `json:"sceneId"`
+	SceneOrdinal    int    `json:"sceneOrdinal"`
+	SceneTitle      string `json:"sceneTitle"`
+	MentionCount    int    `json:"mentionCount"`
+	FirstOffset     int    `json:"firstOffset"`
+	MatchedText     string `json:"matchedText,omitempty"`
+	IsPOV           bool   `json:"isPov"`
+	IsLocation      bool   `json:"isLocation"`
+	// File revision (content hash) the appearance was computed from
+	SourceRevision string     `json:"sourceRevision,omitempty"`
+	UpdatedAt      *time.Time `json:"updatedAt,omitempty"`
+}
+
+// ManuscriptWatchConfig configures the manuscript folder watcher
+type ManuscriptWatchConfig struct {
+	Directory       string `json:"directory"`
+	IntervalSeconds int    `json:"intervalSeconds"`
+	Enabled         bool   `json:"enabled"`
+}
+
+// ManuscriptSync reports what a watcher pass changed for one file
+type ManuscriptSync struct {
+	Path            string   `json:"path"`
+	ManuscriptID    string   `json:"manuscriptId"`
+	Action          string   `json:"action"` // created, updated or unchanged
+	Revision        string   `json:"revision"`
+	ScenesAdded     int      `json:"scenesAdded"`
+	ScenesUpdated   int      `json:"scenesUpdated"`
+	ScenesRemoved   int      `json:"scenesRemoved"`
+	ScenesUnchanged int      `json:"scenesUnchanged"`
+	Warnings        []string `json:"warnings,omitempty"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// MergePolicy decides which value wins when both nodes of a merge set the
+// same property
+type MergePolicy string
+
+const (
+	MergeKeepTarget MergePolicy = "keepTarget" // Keep the surviving node's value
+	MergeKeepSource MergePolicy = "keepSource" // Take the merged node's value
+	MergeCombine    MergePolicy = "combine"    // Union lists, join differing text
+)
+
+// NodeRef identifies a node in API responses
+type NodeRef struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name"`
+	Type NodeType `json:"type"`
+}
+
+// DuplicateCandidate is a pair of nodes that may describe the same entity
+type DuplicateCandidate struct {
+	A               NodeRef  `json:"a"`
+	B               NodeRef  `json:"b"`
+	Score           float64  `json:"score"`
+	NameScore       float64  `json:"nameScore"`
+	SameType        bool     `json:"sameType"`
+	SharedNeighbors []string `json:"sharedNeighbors"`
+	MatchedNames    []string `json:"matchedNames"` // The closest pair of names or aliases
+}
+
+// MergeRequest folds SourceID into TargetID; the target survives
+type MergeRequest struct {
+	TargetID string      `json:"targetId" binding:"required"`
+	SourceID string      `json:"sourceId" binding:"required"`
+	Policy   MergePolicy `json:"policy"`
+}
+
+// MergeConflict is a property both nodes set to different values
+type MergeConflict struct {
+	Field       string      `json:"field"`
+	TargetValue interface{} `json:"targetValue"`
+	SourceValue interface{} `json:"sourceValue"`
+	Result      interface{} `json:"result"`
+}
+
+// NodeMerge is the provenance record of a merge
+type NodeMerge struct {
+	ID             string          `json:"id"`
+	TargetID       string          `json:"targetId"`
+	SourceID       string          `json:"sourceId"`
+	SourceName     string          `json:"sourceName"`
+	Source         Node            `json:"source"` // Snapshot of the merged node
+	Policy         MergePolicy     `json:"policy"`
+	Conflicts      []MergeConflict `json:"conflicts"`
+	EdgesRepointed int             `json:"edgesRepointed"`
+	EdgesDropped   int             `json:"edgesDropped"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
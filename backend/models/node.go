@@ -2,6 +2,8 @@ package models
 
 import (
 	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,6 +16,7 @@ const (
 	NodeTypeCity      NodeType = "city"
 	NodeTypeEvent     NodeType = "event"
 	NodeTypeLocation  NodeType = "location"
+	NodeTypeSpecies   NodeType = "species"
 )
 
 // ConnectionDirection represents the allowed connection directions for a node
@@ -28,6 +31,19 @@ const (
 // ExtendedProperties holds type-specific properties
 type ExtendedProperties map[string]interface{}
 
+// Number reads a numeric property, accepting numbers stored as strings.
+// Missing or non-numeric values read as zero.
+func (p ExtendedProperties) Number(key string) float64 {
+	switch v := p[key].(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f
+	}
+	return 0
+}
+
 // Node represents a node in the graph, as stored in the database
 type Node struct {
 	ID                  string              `json:"id"`
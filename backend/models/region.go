@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// MapRegion is a polygon on a world map outlining a faction's territory or
+// the extent of a location or city, in map image pixels
+type MapRegion struct {
+	ID        string        `json:"id"`
+	MapID     string        `json:"mapId"`
+	NodeID    string        `json:"nodeId"`
+	NodeName  string        `json:"nodeName"`
+	NodeType  string        `json:"nodeType"`
+	Name      string        `json:"name,omitempty"`
+	Points    []MapPosition `json:"points"`
+	Color     string        `json:"color,omitempty"` // "#rrggbb"
+	Area      *RegionArea   `json:"area,omitempty"`  // Set when the map has a scale
+	CreatedAt time.Time     `json:"createdAt"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+// RegionArea is the area a region encloses in square distance units
+type RegionArea struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"` // "mi" or "km", squared
+}
+
+// MapRegionRequest is the body for creating or updating a region
+type MapRegionRequest struct {
+	NodeID string        `json:"nodeId" binding:"required"`
+	Name   string        `json:"name"`
+	Points []MapPosition `json:"points" binding:"required"`
+	Color  string        `json:"color"`
+}
+
+// Ways a pin's containment edges can disagree with the regions drawn around
+// it
+const (
+	// The pin lies inside a region whose node it has no containment path to
+	RegionConflictMissingEdge = "missing_edge"
+	// The pin's node lies within the region's node by its edges, but the pin
+	// lies outside every polygon of that region
+	RegionConflictOutsideRegion = "outside_region"
+)
+
+// RegionConflict is a pin whose containment edges disagree with the regions
+// drawn on its map and the maps above it
+type RegionConflict struct {
+	Type    string    `json:"type"`
+	Pin     MapPin    `json:"pin"`
+	Region  MapRegion `json:"region"`
+	Message string    `json:"message"`
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"mythsmith-backend/calendar"
+	"time"
+)
+
+// RelationshipRoute links the nodes at either end of a map route, so routes
+// show up in the world graph. The edge shares the route's ID.
+const RelationshipRoute = "route"
+
+// Terrain types a route can cross
+const (
+	TerrainRoad       = "road"
+	TerrainTrail      = "trail"
+	TerrainWilderness = "wilderness"
+	TerrainMountain   = "mountain"
+	TerrainSwamp      = "swamp"
+	TerrainRiver      = "river"
+	TerrainSea        = "sea"
+)
+
+// Terrains lists every terrain type
+var Terrains = []string{
+	TerrainRoad, TerrainTrail, TerrainWilderness, TerrainMountain, TerrainSwamp, TerrainRiver, TerrainSea,
+}
+
+// Highest danger rating a route can have
+const MaxDanger = 10
+
+// MapRoute is a polyline between two pins on a map
+type MapRoute struct {
+	ID         string        `json:"id"`
+	MapID      string        `json:"mapId"`
+	FromPinID  string        `json:"fromPinId"`
+	ToPinID    string        `json:"toPinId"`
+	FromNodeID string        `json:"fromNodeId"`
+	ToNodeID   string        `json:"toNodeId"`
+	Name       string        `json:"name,omitempty"`
+	Points     []MapPosition `json:"points"` // Vertices between the two pins
+	Terrain    string        `json:"terrain"`
+	// Multiplies the travel mode's speed, e.g. 0.5 for a washed-out road
+	SpeedModifier float64 `json:"speedModifier"`
+	Toll          float64 `json:"toll"`
+	Danger        int     `json:"danger"` // 0 (safe) to MaxDanger
+	// Length of the polyline in image pixels, and in the map's distance unit
+	// when the map has a scale
+	Pixels    float64   `json:"pixels"`
+	Distance  float64   `json:"distance,omitempty"`
+	Unit      string    `json:"unit,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// MapRouteRequest is the body for creating or updating a route. A zero
+// SpeedModifier means 1.
+type MapRouteRequest struct {
+	FromPinID     string        `json:"fromPinId" binding:"required"`
+	ToPinID       string        `json:"toPinId" binding:"required"`
+	Name          string        `json:"name"`
+	Points        []MapPosition `json:"points"`
+	Terrain       string        `json:"terrain" binding:"required"`
+	SpeedModifier float64       `json:"speedModifier"`
+	Toll          float64       `json:"toll"`
+	Danger        int           `json:"danger"`
+}
+
+// PathLocation is a place a path passes through
+type PathLocation struct {
+	NodeID string `json:"nodeId"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+}
+
+// PathStep is one route travelled along a path
+type PathStep struct {
+	RouteID    string  `json:"routeId"`
+	MapID      string  `json:"mapId"`
+	Name       string  `json:"name,omitempty"`
+	FromNodeID string  `json:"fromNodeId"`
+	ToNodeID   string  `json:"toNodeId"`
+	Terrain    string  `json:"terrain"`
+	Distance   float64 `json:"distance"`
+	Days       float64 `json:"days"`
+	Toll       float64 `json:"toll"`
+	Danger     int     `json:"danger"`
+}
+
+// RoutePath is the quickest path between two places over the route network
+type RoutePath struct {
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	Mode      string            `json:"mode"`
+	Distance  float64           `json:"distance"`
+	Unit      string            `json:"unit"` // The travel mode's unit
+	Days      float64           `json:"days"`
+	Duration  calendar.Duration `json:"duration"`
+	Toll      float64           `json:"toll"`
+	MaxDanger int               `json:"maxDanger"` // Most dangerous route on the path
+	Steps     []PathStep        `json:"steps"`
+	Locations []PathLocation    `json:"locations"` // Every place passed, from start to end
+}
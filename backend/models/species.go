@@ -0,0 +1,66 @@
+package models
+
+// Lifecycle relationships between characters, species and events
+const (
+	RelationshipSpecies = "species" // Character -> species node
+	RelationshipBirth   = "birth"   // Character <-> event of their birth
+	RelationshipDeath   = "death"   // Character <-> event of their death
+	RelationshipParent  = "parent"  // Source is a parent of target
+)
+
+// Species holds the lifecycle properties of a species node. Zero means unknown.
+type Species struct {
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Lifespan       float64 `json:"lifespan"`
+	MaturityAge    float64 `json:"maturityAge"`
+	FertilityStart float64 `json:"fertilityStart"`
+	FertilityEnd   float64 `json:"fertilityEnd"`
+}
+
+// SpeciesFromNode reads the lifecycle properties of a species node
+func SpeciesFromNode(n *Node) Species {
+	return Species{
+		ID:             n.ID,
+		Name:           n.Name,
+		Lifespan:       n.Properties.Number("lifespan"),
+		MaturityAge:    n.Properties.Number("maturityAge"),
+		FertilityStart: n.Properties.Number("fertilityStart"),
+		FertilityEnd:   n.Properties.Number("fertilityEnd"),
+	}
+}
+
+// FertileRange returns the ages between which members can have children,
+// falling back to maturity and lifespan when no explicit window is set
+func (s Species) FertileRange() (float64, float64) {
+	start, end := s.FertilityStart, s.FertilityEnd
+	if start == 0 {
+		start = s.MaturityAge
+	}
+	if end == 0 {
+		end = s.Lifespan
+	}
+	return start, end
+}
+
+// CharacterAge is the computed age of a character at a point in time
+type CharacterAge struct {
+	CharacterID string   `json:"characterId"`
+	Name        string   `json:"name"`
+	Species     *Species `json:"species,omitempty"`
+	BirthDate   string   `json:"birthDate,omitempty"`
+	DeathDate   string   `json:"deathDate,omitempty"`
+	At          string   `json:"at,omitempty"`
+	Age         int      `json:"age"`
+	Alive       bool     `json:"alive"`
+	Source      string   `json:"source"` // "calendar" or "property"
+	Issues      []string `json:"issues"`
+}
+
+// LifecycleIssue is an implausible age or lineage found by the species checks
+type LifecycleIssue struct {
+	Kind          string `json:"kind"`
+	NodeID        string `json:"nodeId"`
+	RelatedNodeID string `json:"relatedNodeId,omitempty"`
+	Message       string `json:"message"`
+}
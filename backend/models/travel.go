@@ -0,0 +1,87 @@
+package models
+
+import "mythsmith-backend/calendar"
+
+// Distance units for map scales and travel speeds
+const (
+	UnitMiles      = "mi"
+	UnitKilometers = "km"
+)
+
+const KilometersPerMile = 1.609344
+
+// MapScale is a map's scale in image pixels per distance unit
+type MapScale struct {
+	PixelsPerUnit float64 `json:"pixelsPerUnit"`
+	Unit          string  `json:"unit"`
+	// Ancestor map the scale is derived from, through the rectangles each
+	// child map covers on its parent
+	InheritedFrom string `json:"inheritedFrom,omitempty"`
+}
+
+// MapPosition is a point in image pixels
+type MapPosition struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// MapScaleRequest calibrates a map by measuring a known distance between two
+// points on its image
+type MapScaleRequest struct {
+	From     MapPosition `json:"from"`
+	To       MapPosition `json:"to"`
+	Distance float64     `json:"distance" binding:"required"`
+	Unit     string      `json:"unit" binding:"required"`
+}
+
+// TravelMode is a way of travelling and how far it covers in a day
+type TravelMode struct {
+	Name        string  `json:"name"`
+	Speed       float64 `json:"speed"` // Distance units per hour
+	Unit        string  `json:"unit"`
+	HoursPerDay float64 `json:"hoursPerDay"` // Hours spent travelling each day
+	// Route terrains the mode can use; empty means any
+	Terrains []string `json:"terrains,omitempty"`
+}
+
+// CanUse reports whether the mode can travel a route of the given terrain
+func (m TravelMode) CanUse(terrain string) bool {
+	if len(m.Terrains) == 0 {
+		return true
+	}
+	for _, t := range m.Terrains {
+		if t == terrain {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultTravelModes are used until the world configures its own
+func DefaultTravelModes() []TravelMode {
+	overland := []string{TerrainRoad, TerrainTrail, TerrainWilderness, TerrainMountain, TerrainSwamp}
+	return []TravelMode{
+		{Name: "foot", Speed: 3, Unit: UnitMiles, HoursPerDay: 8, Terrains: overland},
+		{Name: "horse", Speed: 4, Unit: UnitMiles, HoursPerDay: 8, Terrains: overland},
+		{Name: "ship", Speed: 5, Unit: UnitMiles, HoursPerDay: 24, Terrains: []string{TerrainRiver, TerrainSea}},
+	}
+}
+
+// TravelEstimate is how long a distance takes in one travel mode
+type TravelEstimate struct {
+	Mode     string            `json:"mode"`
+	Days     float64           `json:"days"`
+	Duration calendar.Duration `json:"duration"` // Days in the world's calendar units
+}
+
+// MapDistance is the straight-line distance between two pins on a map
+type MapDistance struct {
+	MapID    string           `json:"mapId"`
+	From     MapPin           `json:"from"`
+	To       MapPin           `json:"to"`
+	Pixels   float64          `json:"pixels"`
+	Distance float64          `json:"distance"`
+	Unit     string           `json:"unit"`
+	Scale    MapScale         `json:"scale"`
+	Travel   []TravelEstimate `json:"travel"`
+}
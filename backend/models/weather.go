@@ -0,0 +1,27 @@
+package models
+
+import "mythsmith-backend/weather"
+
+// WorldSeed seeds everything the world generates reproducibly, such as
+// weather
+type WorldSeed struct {
+	Seed *int64 `json:"seed" binding:"required"`
+}
+
+// LocationWeather is the weather generated for a location over a range of
+// dates
+type LocationWeather struct {
+	LocationID string `json:"locationId"`
+	Name       string `json:"name"`
+	Climate    string `json:"climate"`
+	// Containing location the climate was taken from, when the location has
+	// none of its own
+	ClimateFrom string        `json:"climateFrom,omitempty"`
+	Terrain     string        `json:"terrain"`
+	Unit        string        `json:"unit"` // "C" or "F"
+	From        string        `json:"from"`
+	To          string        `json:"to"`
+	Days        []weather.Day `json:"days"`
+	Count       int           `json:"count"`
+	Notes       []string      `json:"notes"`
+}
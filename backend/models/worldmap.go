@@ -0,0 +1,163 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Containment relationships between location and city nodes. An edge with
+// RelationshipLocatedIn or RelationshipPartOf reads "source lies within
+// target"; RelationshipContains reads "source contains target".
+const (
+	RelationshipLocatedIn = "located_in"
+	RelationshipPartOf    = "part_of"
+	RelationshipContains  = "contains"
+)
+
+// Other spellings of the containment relationships found in existing
+// worlds: earlier imports wrote them with spaces, and the editor's "location"
+// edge links a place to the place it lies in
+var containmentSpellings = map[string]string{
+	"located in": RelationshipLocatedIn,
+	"location":   RelationshipLocatedIn,
+	"part of":    RelationshipPartOf,
+}
+
+// ContainmentRelationship returns the containment relationship an edge's
+// relationship spells, or "" if it isn't one
+func ContainmentRelationship(relationship string) string {
+	relationship = strings.ToLower(strings.TrimSpace(relationship))
+	switch relationship {
+	case RelationshipLocatedIn, RelationshipPartOf, RelationshipContains:
+		return relationship
+	}
+	return containmentSpellings[relationship]
+}
+
+// WorldMap is an uploaded map image with its size in pixels. Maps form a
+// hierarchy: a child map, such as a city map, covers a rectangle of its
+// parent.
+type WorldMap struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	ContentType string     `json:"contentType"`
+	Width       int        `json:"width"`
+	Height      int        `json:"height"`
+	NodeID      string     `json:"nodeId,omitempty"` // Location or city the map depicts
+	ParentID    string     `json:"parentId,omitempty"`
+	Bounds      *MapBounds `json:"bounds,omitempty"` // Set with ParentID
+	Scale       *MapScale  `json:"scale,omitempty"`
+	Tiles       MapTiles   `json:"tiles"`
+	PinCount    int        `json:"pinCount"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// Tile generation states
+const (
+	TileStatusPending = "pending"
+	TileStatusRunning = "running"
+	TileStatusDone    = "done"
+	TileStatusFailed  = "failed"
+)
+
+// MapTiles reports the map's tile pyramid, served in XYZ layout from
+// /worldmaps/:id/tiles/{z}/{x}/{y}.png
+type MapTiles struct {
+	Status   string `json:"status"` // Empty until the map is queued
+	Done     int    `json:"done"`
+	Total    int    `json:"total"`
+	MaxZoom  int    `json:"maxZoom"`
+	TileSize int    `json:"tileSize"`
+	Error    string `json:"error,omitempty"`
+}
+
+// MapBounds is the rectangle a child map covers on its parent, in the
+// parent's pixels
+type MapBounds struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// WorldMapRequest is the body for updating a map. Clearing ParentID detaches
+// the map from its parent.
+type WorldMapRequest struct {
+	Name     string     `json:"name" binding:"required"`
+	NodeID   string     `json:"nodeId"`
+	ParentID string     `json:"parentId"`
+	Bounds   *MapBounds `json:"bounds"`
+}
+
+// MapBreadcrumb is one map on the path from the root map
+type MapBreadcrumb struct {
+	ID     string     `json:"id"`
+	Name   string     `json:"name"`
+	NodeID string     `json:"nodeId,omitempty"`
+	Width  int        `json:"width"`
+	Height int        `json:"height"`
+	Bounds *MapBounds `json:"bounds,omitempty"`
+	PinID  string     `json:"pinId,omitempty"` // Pin on the previous map that opens this one
+}
+
+// MapPoint is a point converted onto another map
+type MapPoint struct {
+	MapID  string  `json:"mapId"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Inside bool    `json:"inside"` // Whether the point lies on the map image
+}
+
+// MapPin places a node on a world map at image pixel coordinates, measured
+// from the top-left corner
+type MapPin struct {
+	ID       string  `json:"id"`
+	MapID    string  `json:"mapId"`
+	NodeID   string  `json:"nodeId"`
+	NodeName string  `json:"nodeName"`
+	NodeType string  `json:"nodeType"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	// Child map the pin opens, such as the map of the city it marks
+	ChildMapID string `json:"childMapId,omitempty"`
+	LayerID    string `json:"layerId,omitempty"` // Empty for the base map
+	// Overrides; empty means the client shows the node type's icon and the node name
+	Icon      string    `json:"icon,omitempty"`
+	Label     string    `json:"label,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// MapPinRequest is the body for creating or updating a pin
+type MapPinRequest struct {
+	NodeID string  `json:"nodeId" binding:"required"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Icon   string  `json:"icon"`
+	Label  string  `json:"label"`
+	// Child map to open; when omitted, a child map depicting the node is used
+	ChildMapID string `json:"childMapId"`
+	LayerID    string `json:"layerId"`
+}
+
+// GenerateMapRequest is the body for generating a world map. A missing seed
+// is chosen at random; the same seed and size always draw the same map.
+type GenerateMapRequest struct {
+	Name   string `json:"name"`
+	Seed   *int64 `json:"seed"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Create city and location nodes on suitable terrain, pinned to the map
+	PlaceNodes bool `json:"placeNodes"`
+	Cities     int  `json:"cities"`
+	Locations  int  `json:"locations"`
+}
+
+// GeneratedMap is a generated world map with the pins of the nodes placed on
+// it
+type GeneratedMap struct {
+	Seed int64    `json:"seed"`
+	Map  WorldMap `json:"map"`
+	Pins []MapPin `json:"pins"`
+}
@@ -0,0 +1,124 @@
+// Package namegen makes up pronounceable place names from syllables. Names
+// depend only on the random source, so a seeded source gives the same names
+// in the same order every time.
+package namegen
+
+import (
+	"math/rand"
+	"strings"
+)
+
+var (
+	onsets = []string{
+		"b", "br", "c", "d", "dr", "f", "g", "gr", "h", "k", "kh", "l", "m", "n",
+		"p", "r", "s", "sh", "st", "t", "th", "tr", "v", "w", "z",
+	}
+	nuclei = []string{"a", "a", "a", "e", "e", "i", "i", "o", "o", "u", "ae", "ai", "ea", "ou"}
+	codas  = []string{"", "", "", "", "l", "n", "r", "s", "th", "nd", "rn", "st", "m"}
+
+	// Endings that make a word read as a settlement
+	placeSuffixes = []string{
+		"ford", "holm", "mere", "wick", "gard", "haven", "burg", "dale", "port",
+		"stead", "ton", "moor", "fell", "crest",
+	}
+)
+
+// Generator makes up names, never returning the same one twice
+type Generator struct {
+	rng  *rand.Rand
+	used map[string]bool
+}
+
+func New(rng *rand.Rand) *Generator {
+	return &Generator{rng: rng, used: make(map[string]bool)}
+}
+
+func (g *Generator) pick(list []string) string {
+	return list[g.rng.Intn(len(list))]
+}
+
+func (g *Generator) word(syllables int) string {
+	var b strings.Builder
+	for i := 0; i < syllables; i++ {
+		// Skip the onset now and then so names don't all alternate strictly
+		if i == 0 || g.rng.Intn(4) > 0 {
+			b.WriteString(g.pick(onsets))
+		}
+		b.WriteString(g.pick(nuclei))
+		if i == syllables-1 || g.rng.Intn(3) == 0 {
+			b.WriteString(g.pick(codas))
+		}
+	}
+	return capitalize(b.String())
+}
+
+// unique calls gen until it returns a name not used before. After a
+// hundred collisions it numbers the name instead.
+func (g *Generator) unique(gen func() string) string {
+	name := gen()
+	for i := 0; g.used[name] && i < 100; i++ {
+		name = gen()
+	}
+	if base := name; g.used[name] {
+		for n := 2; g.used[name]; n++ {
+			name = base + " " + roman(n)
+		}
+	}
+	g.used[name] = true
+	return name
+}
+
+// Word returns a made-up word of two or three syllables, such as "Thaeros"
+func (g *Generator) Word() string {
+	return g.unique(func() string { return g.word(2 + g.rng.Intn(2)) })
+}
+
+// Settlement returns a name for a city or town, such as "Brenmere"
+func (g *Generator) Settlement() string {
+	return g.unique(func() string {
+		if g.rng.Intn(3) == 0 {
+			return g.word(2 + g.rng.Intn(2))
+		}
+		w := g.word(1 + g.rng.Intn(2))
+		// Drop a trailing vowel cluster before the suffix, so "Dora" + "ford"
+		// becomes "Dorford"
+		if trimmed := strings.TrimRight(w, "aeiou"); len(trimmed) >= 3 {
+			w = trimmed
+		}
+		return w + g.pick(placeSuffixes)
+	})
+}
+
+// Feature returns a name for a natural feature with one of the given nouns,
+// such as "Thaeros Peaks" or "The Peaks of Thaeros"
+func (g *Generator) Feature(nouns []string) string {
+	return g.unique(func() string {
+		noun := g.pick(nouns)
+		if g.rng.Intn(4) == 0 {
+			return "The " + noun + " of " + g.word(2)
+		}
+		return g.word(2+g.rng.Intn(2)) + " " + noun
+	})
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func roman(n int) string {
+	numerals := []struct {
+		value  int
+		symbol string
+	}{{10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"}}
+	var b strings.Builder
+	for _, numeral := range numerals {
+		for n >= numeral.value {
+			b.WriteString(numeral.symbol)
+			n -= numeral.value
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,279 @@
+// Package resolver matches free-text names against node names and aliases.
+package resolver
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// EntryKind tells a node's primary name apart from its aliases
+type EntryKind string
+
+const (
+	EntryName  EntryKind = "name"
+	EntryAlias EntryKind = "alias"
+)
+
+// MatchKind describes how a query matched, from strongest to weakest
+type MatchKind string
+
+const (
+	MatchID       MatchKind = "id"
+	MatchExact    MatchKind = "exact"
+	MatchAlias    MatchKind = "alias"
+	MatchCaseFold MatchKind = "casefold"
+	MatchFuzzy    MatchKind = "fuzzy"
+)
+
+// Entry is one name a node can be referred to by
+type Entry struct {
+	NodeID   string
+	NodeName string // The node's primary name, for display
+	NodeType string
+	Text     string
+	Kind     EntryKind
+	Language string // Optional tags on aliases
+	Era      string
+}
+
+// Match is a candidate node for a query
+type Match struct {
+	NodeID   string    `json:"nodeId"`
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Matched  string    `json:"matched"` // The name or alias that matched
+	Kind     MatchKind `json:"kind"`
+	Language string    `json:"language,omitempty"`
+	Era      string    `json:"era,omitempty"`
+	Distance int       `json:"distance"`
+	Score    float64   `json:"score"`
+}
+
+// Options narrows a resolution. Aliases tagged with a different language or
+// era than requested are ignored; untagged aliases always count.
+type Options struct {
+	Language string
+	Era      string
+	Type     string
+	Limit    int
+}
+
+// Index holds every name and alias of a set of nodes
+type Index struct {
+	entries []Entry
+	nodes   map[string]Entry // Node ID -> its primary name entry
+	exact   map[string][]int
+	folded  map[string][]int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		nodes:  make(map[string]Entry),
+		exact:  make(map[string][]int),
+		folded: make(map[string][]int),
+	}
+}
+
+// Add registers a name or alias. Blank texts are ignored.
+func (ix *Index) Add(e Entry) {
+	e.Text = strings.TrimSpace(e.Text)
+	if e.Text == "" {
+		return
+	}
+	if e.Kind == EntryName {
+		ix.nodes[e.NodeID] = e
+	}
+	i := len(ix.entries)
+	ix.entries = append(ix.entries, e)
+	ix.exact[e.Text] = append(ix.exact[e.Text], i)
+	ix.folded[Fold(e.Text)] = append(ix.folded[Fold(e.Text)], i)
+}
+
+// Entries returns every registered name and alias
+func (ix *Index) Entries() []Entry {
+	return ix.entries
+}
+
+// Has reports whether id is the ID of an indexed node
+func (ix *Index) Has(id string) bool {
+	_, ok := ix.nodes[id]
+	return ok
+}
+
+// Lookup returns the node a name unambiguously refers to: an exact name or
+// alias first, then a case-folded one. Edit-distance matches are never used
+// here, so a typo does not silently link to the wrong node.
+func (ix *Index) Lookup(name string) string {
+	name = strings.TrimSpace(name)
+	if id := ix.pick(ix.exact[name]); id != "" {
+		return id
+	}
+	return ix.pick(ix.folded[Fold(name)])
+}
+
+// pick prefers a primary name over aliases, then the first one added
+func (ix *Index) pick(candidates []int) string {
+	for _, i := range candidates {
+		if ix.entries[i].Kind == EntryName {
+			return ix.entries[i].NodeID
+		}
+	}
+	if len(candidates) > 0 {
+		return ix.entries[candidates[0]].NodeID
+	}
+	return ""
+}
+
+// Resolve returns the nodes a query may refer to, best first, with at most
+// one match per node
+func (ix *Index) Resolve(query string, opts Options) []Match {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil
+	}
+	folded := Fold(query)
+	maxDistance := utf8.RuneCountInString(folded) / 4
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	best := make(map[string]Match)
+	consider := func(m Match) {
+		if current, ok := best[m.NodeID]; !ok || m.Score > current.Score {
+			best[m.NodeID] = m
+		}
+	}
+
+	if e, ok := ix.nodes[query]; ok && (opts.Type == "" || e.NodeType == opts.Type) {
+		consider(ix.match(e, MatchID, 0, 1))
+	}
+
+	for _, e := range ix.entries {
+		if opts.Type != "" && e.NodeType != opts.Type {
+			continue
+		}
+		if e.Kind == EntryAlias && !tagMatches(e.Language, opts.Language) {
+			continue
+		}
+		if e.Kind == EntryAlias && !tagMatches(e.Era, opts.Era) {
+			continue
+		}
+
+		switch {
+		case e.Text == query && e.Kind == EntryName:
+			consider(ix.match(e, MatchExact, 0, 1))
+		case e.Text == query:
+			consider(ix.match(e, MatchAlias, 0, 0.95))
+		case Fold(e.Text) == folded:
+			score := 0.9
+			if e.Kind == EntryAlias {
+				score = 0.85
+			}
+			consider(ix.match(e, MatchCaseFold, 0, score))
+		default:
+			d := Distance(Fold(e.Text), folded)
+			if d > maxDistance {
+				continue
+			}
+			length := utf8.RuneCountInString(folded)
+			if n := utf8.RuneCountInString(e.Text); n > length {
+				length = n
+			}
+			score := 0.8 * (1 - float64(d)/float64(length))
+			if e.Kind == EntryAlias {
+				score -= 0.05
+			}
+			consider(ix.match(e, MatchFuzzy, d, score))
+		}
+	}
+
+	matches := make([]Match, 0, len(best))
+	for _, m := range best {
+		matches = append(matches, m)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if matches[i].Name != matches[j].Name {
+			return matches[i].Name < matches[j].Name
+		}
+		return matches[i].NodeID < matches[j].NodeID
+	})
+	if opts.Limit > 0 && len(matches) > opts.Limit {
+		matches = matches[:opts.Limit]
+	}
+	return matches
+}
+
+func (ix *Index) match(e Entry, kind MatchKind, distance int, score float64) Match {
+	m := Match{
+		NodeID:   e.NodeID,
+		Name:     e.NodeName,
+		Type:     e.NodeType,
+		Matched:  e.Text,
+		Kind:     kind,
+		Distance: distance,
+		Score:    math.Round(score*100) / 100,
+	}
+	if e.Kind == EntryAlias {
+		m.Language = e.Language
+		m.Era = e.Era
+	}
+	return m
+}
+
+func tagMatches(tag, wanted string) bool {
+	return tag == "" || wanted == "" || strings.EqualFold(tag, wanted)
+}
+
+// Fold normalises a name for comparison: lowercased, with runs of whitespace
+// collapsed to a single space
+func Fold(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// Similarity scores two names from 0 (nothing in common) to 1 (equal once
+// folded), based on their edit distance relative to the longer name
+func Similarity(a, b string) float64 {
+	a, b = Fold(a), Fold(b)
+	length := utf8.RuneCountInString(a)
+	if n := utf8.RuneCountInString(b); n > length {
+		length = n
+	}
+	if length == 0 {
+		return 0
+	}
+	return 1 - float64(Distance(a, b))/float64(length)
+}
+
+// Distance is the edit distance between two strings, counted in runes.
+// Besides insertions, deletions and substitutions it counts swapping two
+// adjacent letters as one edit, the most common typo in names.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d := min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d = min(d, rows[i-2][j-2]+1)
+			}
+			rows[i][j] = d
+		}
+	}
+	return rows[len(ra)][len(rb)]
+}
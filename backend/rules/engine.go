@@ -0,0 +1,331 @@
+package rules
+
+import (
+	"fmt"
+	"mythsmith-backend/models"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Evaluate runs a rule against the world and returns its findings. Findings
+// are ordered by node ID so repeated runs produce identical output.
+func Evaluate(rule Rule, world World) []Finding {
+	return newIndex(world).evaluate(rule)
+}
+
+// EvaluateAll runs several rules against the same world, indexing it once
+func EvaluateAll(rules []Rule, world World) map[string][]Finding {
+	idx := newIndex(world)
+	findings := make(map[string][]Finding, len(rules))
+	for _, rule := range rules {
+		findings[rule.ID] = idx.evaluate(rule)
+	}
+	return findings
+}
+
+func (idx *index) evaluate(rule Rule) []Finding {
+	spec := rule.Spec
+
+	var findings []Finding
+	for _, node := range idx.sortedNodes() {
+		if spec.NodeType != "" && string(node.Type) != spec.NodeType {
+			continue
+		}
+		if !idx.matches(node, spec.Where) {
+			continue
+		}
+
+		var problem string
+		switch spec.Kind {
+		case KindAssert:
+			problem = idx.checkAssert(node, *spec.Assert)
+		case KindRequireEdge:
+			problem = idx.checkRequireEdge(node, *spec.Edge, spec.Min)
+		}
+		if problem == "" {
+			continue
+		}
+
+		findings = append(findings, Finding{
+			RuleID:   rule.ID,
+			NodeID:   node.ID,
+			Severity: rule.Severity,
+			Message:  formatMessage(rule, node, problem),
+		})
+	}
+	return findings
+}
+
+func formatMessage(rule Rule, node *models.Node, problem string) string {
+	if rule.Message != "" {
+		return strings.NewReplacer("{name}", node.Name, "{id}", node.ID, "{problem}", problem).Replace(rule.Message)
+	}
+	return fmt.Sprintf("%s: %s %s", rule.Name, node.Name, problem)
+}
+
+// index gives constant-time access to nodes and their edges
+type index struct {
+	nodes map[string]*models.Node
+	out   map[string][]models.Edge
+	in    map[string][]models.Edge
+}
+
+func newIndex(world World) *index {
+	idx := &index{
+		nodes: make(map[string]*models.Node, len(world.Nodes)),
+		out:   make(map[string][]models.Edge),
+		in:    make(map[string][]models.Edge),
+	}
+	for i := range world.Nodes {
+		idx.nodes[world.Nodes[i].ID] = &world.Nodes[i]
+	}
+	for _, edge := range world.Edges {
+		idx.out[edge.SourceNodeID] = append(idx.out[edge.SourceNodeID], edge)
+		idx.in[edge.TargetNodeID] = append(idx.in[edge.TargetNodeID], edge)
+	}
+	return idx
+}
+
+func (idx *index) sortedNodes() []*models.Node {
+	nodes := make([]*models.Node, 0, len(idx.nodes))
+	for _, node := range idx.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// neighbours returns the nodes reached from node over edges matching hop
+func (idx *index) neighbours(node *models.Node, hop Hop) []*models.Node {
+	var result []*models.Node
+	if hop.Direction != DirectionIn {
+		for _, edge := range idx.out[node.ID] {
+			if edge.Relationship == hop.Relationship {
+				if n, ok := idx.nodes[edge.TargetNodeID]; ok {
+					result = append(result, n)
+				}
+			}
+		}
+	}
+	if hop.Direction == DirectionIn || hop.Direction == DirectionAny {
+		for _, edge := range idx.in[node.ID] {
+			if edge.Relationship == hop.Relationship {
+				if n, ok := idx.nodes[edge.SourceNodeID]; ok {
+					result = append(result, n)
+				}
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// resolve returns every value an operand takes for the node. Missing
+// properties produce no values rather than an error.
+func (idx *index) resolve(node *models.Node, op Operand) []interface{} {
+	sources := []*models.Node{node}
+	if op.Related != nil {
+		sources = idx.neighbours(node, *op.Related)
+	}
+
+	var values []interface{}
+	for _, source := range sources {
+		value := op.Value
+		if op.Property != "" {
+			var ok bool
+			if value, ok = property(source, op.Property); !ok {
+				continue
+			}
+		}
+		values = append(values, value)
+	}
+
+	if op.Minus == nil {
+		return values
+	}
+
+	// Subtraction is evaluated against the checked node, not the neighbours
+	subtrahends := idx.resolve(node, *op.Minus)
+	var differences []interface{}
+	for _, a := range values {
+		for _, b := range subtrahends {
+			x, okA := toNumber(a)
+			y, okB := toNumber(b)
+			if okA && okB {
+				differences = append(differences, x-y)
+			}
+		}
+	}
+	return differences
+}
+
+func (idx *index) holds(node *models.Node, cond Condition) bool {
+	left := idx.resolve(node, cond.Left)
+	switch cond.Op {
+	case "exists":
+		return len(left) > 0
+	case "missing":
+		return len(left) == 0
+	}
+
+	right := idx.resolve(node, *cond.Right)
+	if len(left) == 0 || len(right) == 0 {
+		return false
+	}
+	for _, a := range left {
+		for _, b := range right {
+			if !compare(cond.Op, a, b) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (idx *index) matches(node *models.Node, where []Condition) bool {
+	for _, cond := range where {
+		if !idx.holds(node, cond) {
+			return false
+		}
+	}
+	return true
+}
+
+func (idx *index) checkAssert(node *models.Node, cond Condition) string {
+	left := idx.resolve(node, cond.Left)
+	switch cond.Op {
+	case "exists":
+		if len(left) == 0 {
+			return fmt.Sprintf("is missing %s", describe(cond.Left))
+		}
+		return ""
+	case "missing":
+		if len(left) > 0 {
+			return fmt.Sprintf("should not have %s", describe(cond.Left))
+		}
+		return ""
+	}
+
+	// Conditions that cannot be evaluated are not violations
+	right := idx.resolve(node, *cond.Right)
+	for _, a := range left {
+		for _, b := range right {
+			if !compare(cond.Op, a, b) {
+				return fmt.Sprintf("fails %s %s %s (%v vs %v)",
+					describe(cond.Left), cond.Op, describe(*cond.Right), a, b)
+			}
+		}
+	}
+	return ""
+}
+
+func (idx *index) checkRequireEdge(node *models.Node, hop Hop, min int) string {
+	if min == 0 {
+		min = 1
+	}
+	count := len(idx.neighbours(node, hop))
+	if count >= min {
+		return ""
+	}
+	return fmt.Sprintf("has %d %q edge(s), needs at least %d", count, hop.Relationship, min)
+}
+
+func describe(op Operand) string {
+	var s string
+	if op.Property != "" {
+		s = op.Property
+		if op.Related != nil {
+			s = op.Related.Relationship + "." + s
+		}
+	} else {
+		s = fmt.Sprintf("%v", op.Value)
+	}
+	if op.Minus != nil {
+		s += " - " + describe(*op.Minus)
+	}
+	return s
+}
+
+// property reads a basic field or an extended property from a node
+func property(node *models.Node, name string) (interface{}, bool) {
+	switch name {
+	case "id":
+		return node.ID, true
+	case "name":
+		return node.Name, true
+	case "type":
+		return string(node.Type), true
+	case "description":
+		return node.Description, true
+	}
+	value, ok := node.Properties[name]
+	if !ok || value == nil || value == "" {
+		return nil, false
+	}
+	return value, true
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func compare(op string, a, b interface{}) bool {
+	if op == "contains" {
+		if list, ok := a.([]interface{}); ok {
+			for _, item := range list {
+				if compare("==", item, b) {
+					return true
+				}
+			}
+			return false
+		}
+		return strings.Contains(strings.ToLower(fmt.Sprint(a)), strings.ToLower(fmt.Sprint(b)))
+	}
+
+	x, okA := toNumber(a)
+	y, okB := toNumber(b)
+	if okA && okB {
+		switch op {
+		case "==":
+			return x == y
+		case "!=":
+			return x != y
+		case "<":
+			return x < y
+		case "<=":
+			return x <= y
+		case ">":
+			return x > y
+		case ">=":
+			return x >= y
+		}
+		return false
+	}
+
+	s, t := strings.ToLower(fmt.Sprint(a)), strings.ToLower(fmt.Sprint(b))
+	switch op {
+	case "==":
+		return s == t
+	case "!=":
+		return s != t
+	case "<":
+		return s < t
+	case "<=":
+		return s <= t
+	case ">":
+		return s > t
+	case ">=":
+		return s >= t
+	}
+	return false
+}
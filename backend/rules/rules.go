@@ -0,0 +1,166 @@
+// Package rules implements the deterministic core of the lore consistency
+// checks: declarative rules evaluated over a snapshot of nodes and edges.
+package rules
+
+import (
+	"fmt"
+	"mythsmith-backend/models"
+)
+
+// Kind selects how a rule is evaluated
+type Kind string
+
+const (
+	// KindAssert checks a condition on every matching node
+	KindAssert Kind = "assert"
+	// KindRequireEdge checks that every matching node has enough edges of a relationship
+	KindRequireEdge Kind = "requireEdge"
+)
+
+// Severity of the findings a rule produces
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// Direction of an edge relative to the node being checked
+type Direction string
+
+const (
+	DirectionOut Direction = "out"
+	DirectionIn  Direction = "in"
+	DirectionAny Direction = "any"
+)
+
+// Hop follows edges of a relationship to neighbouring nodes
+type Hop struct {
+	Relationship string    `json:"relationship"`
+	Direction    Direction `json:"direction,omitempty"`
+}
+
+// Operand is one side of a condition. Exactly one of Property or Value is set.
+// Property is read from the checked node, or from its neighbours when Related
+// is set. Minus subtracts another operand, e.g. reignEnd minus reignStart.
+type Operand struct {
+	Property string      `json:"property,omitempty"`
+	Value    interface{} `json:"value,omitempty"`
+	Related  *Hop        `json:"related,omitempty"`
+	Minus    *Operand    `json:"minus,omitempty"`
+}
+
+// Condition compares two operands. Right is unused by the exists/missing operators.
+type Condition struct {
+	Left  Operand  `json:"left"`
+	Op    string   `json:"op"`
+	Right *Operand `json:"right,omitempty"`
+}
+
+// Spec is the declarative part of a rule
+type Spec struct {
+	Kind     Kind        `json:"kind"`
+	NodeType string      `json:"nodeType,omitempty"` // Empty matches every node
+	Where    []Condition `json:"where,omitempty"`    // All must hold for a node to be checked
+	Assert   *Condition  `json:"assert,omitempty"`   // KindAssert
+	Edge     *Hop        `json:"edge,omitempty"`     // KindRequireEdge
+	Min      int         `json:"min,omitempty"`      // KindRequireEdge, defaults to 1
+}
+
+// Rule is a stored rule
+type Rule struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	Description     string   `json:"description"`
+	Severity        Severity `json:"severity"`
+	Message         string   `json:"message,omitempty"`
+	Spec            Spec     `json:"spec"`
+	Enabled         bool     `json:"enabled"`
+	EvaluateOnWrite bool     `json:"evaluateOnWrite"`
+}
+
+// Finding is a single rule violation
+type Finding struct {
+	RuleID   string   `json:"ruleId"`
+	NodeID   string   `json:"nodeId"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// World is the snapshot rules are evaluated against
+type World struct {
+	Nodes []models.Node
+	Edges []models.Edge
+}
+
+var operators = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"contains": true, "exists": true, "missing": true,
+}
+
+// Validate reports whether the spec can be evaluated
+func (s Spec) Validate() error {
+	for i, cond := range s.Where {
+		if err := cond.validate(); err != nil {
+			return fmt.Errorf("where[%d]: %v", i, err)
+		}
+	}
+
+	switch s.Kind {
+	case KindAssert:
+		if s.Assert == nil {
+			return fmt.Errorf("assert rules need an assert condition")
+		}
+		return s.Assert.validate()
+	case KindRequireEdge:
+		if s.Edge == nil || s.Edge.Relationship == "" {
+			return fmt.Errorf("requireEdge rules need an edge relationship")
+		}
+		if s.Min < 0 {
+			return fmt.Errorf("min must not be negative")
+		}
+		return s.Edge.validate()
+	default:
+		return fmt.Errorf("unknown rule kind %q", s.Kind)
+	}
+}
+
+func (c Condition) validate() error {
+	if !operators[c.Op] {
+		return fmt.Errorf("unknown operator %q", c.Op)
+	}
+	if err := c.Left.validate(); err != nil {
+		return err
+	}
+	if c.Op == "exists" || c.Op == "missing" {
+		return nil
+	}
+	if c.Right == nil {
+		return fmt.Errorf("operator %q needs a right operand", c.Op)
+	}
+	return c.Right.validate()
+}
+
+func (o Operand) validate() error {
+	if (o.Property == "") == (o.Value == nil) {
+		return fmt.Errorf("operand needs exactly one of property or value")
+	}
+	if o.Related != nil {
+		if err := o.Related.validate(); err != nil {
+			return err
+		}
+	}
+	if o.Minus != nil {
+		return o.Minus.validate()
+	}
+	return nil
+}
+
+func (h Hop) validate() error {
+	switch h.Direction {
+	case "", DirectionOut, DirectionIn, DirectionAny:
+		return nil
+	}
+	return fmt.Errorf("unknown direction %q", h.Direction)
+}
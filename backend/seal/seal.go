@@ -0,0 +1,167 @@
+// Package seal encrypts exports with a key derived from a passphrase. A
+// sealed file is the magic bytes, the length of a JSON header, the header and
+// the ciphertext. The header records the KDF parameters needed to derive the
+// key again and is authenticated along with the ciphertext.
+package seal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Magic starts every sealed file
+const Magic = "MYTHSEAL"
+
+const (
+	version = 1
+	kdf     = "argon2id"
+	cipher  = "xchacha20-poly1305"
+	keySize = chacha20poly1305.KeySize
+)
+
+// Params are the Argon2id cost parameters
+type Params struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"` // KiB
+	Threads uint8  `json:"threads"`
+}
+
+// DefaultParams follow the RFC 9106 recommendation for memory-constrained use
+var DefaultParams = Params{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// Limits on the parameters a header may ask for, so that opening a crafted
+// file cannot exhaust the machine
+const (
+	maxTime   = 16
+	maxMemory = 1024 * 1024 // 1 GiB
+)
+
+// Header describes how a file was sealed
+type Header struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Params
+	Salt   []byte `json:"salt"`
+	Cipher string `json:"cipher"`
+	Nonce  []byte `json:"nonce"`
+}
+
+var (
+	// ErrWrongPassphrase is returned when the ciphertext does not
+	// authenticate: the passphrase is wrong or the file was altered
+	ErrWrongPassphrase = errors.New("wrong passphrase or damaged file")
+	// ErrNoPassphrase is returned when a sealed file is opened without one
+	ErrNoPassphrase = errors.New("the file is encrypted and needs a passphrase")
+)
+
+// IsSealed reports whether data is a sealed file
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+func deriveKey(passphrase string, salt []byte, p Params) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, p.Time, p.Memory, p.Threads, keySize)
+}
+
+// Seal encrypts plaintext with a key derived from passphrase
+func Seal(plaintext []byte, passphrase string) ([]byte, error) {
+	return SealWith(plaintext, passphrase, DefaultParams)
+}
+
+// SealWith encrypts plaintext using the given KDF parameters
+func SealWith(plaintext []byte, passphrase string, p Params) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase is empty")
+	}
+	h := Header{Version: version, KDF: kdf, Params: p, Cipher: cipher,
+		Salt: make([]byte, 16), Nonce: make([]byte, chacha20poly1305.NonceSizeX)}
+	if _, err := rand.Read(h.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+	if _, err := rand.Read(h.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	aead, err := chacha20poly1305.NewX(deriveKey(passphrase, h.Salt, p))
+	if err != nil {
+		return nil, err
+	}
+
+	headerJSON, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal header: %v", err)
+	}
+	prefix := make([]byte, 0, len(Magic)+4+len(headerJSON))
+	prefix = append(prefix, Magic...)
+	prefix = binary.BigEndian.AppendUint32(prefix, uint32(len(headerJSON)))
+	prefix = append(prefix, headerJSON...)
+
+	// The whole prefix is additional data, so the parameters cannot be altered
+	return aead.Seal(prefix, h.Nonce, plaintext, prefix), nil
+}
+
+// ReadHeader parses the header of a sealed file. It also returns the prefix
+// the header was read from and the ciphertext that follows.
+func ReadHeader(data []byte) (h Header, prefix, ciphertext []byte, err error) {
+	if !IsSealed(data) {
+		return h, nil, nil, errors.New("not a sealed file")
+	}
+	rest := data[len(Magic):]
+	if len(rest) < 4 {
+		return h, nil, nil, errors.New("sealed file is truncated")
+	}
+	n := binary.BigEndian.Uint32(rest)
+	if uint64(n) > uint64(len(rest)-4) {
+		return h, nil, nil, errors.New("sealed file is truncated")
+	}
+	if err := json.Unmarshal(rest[4:4+n], &h); err != nil {
+		return h, nil, nil, fmt.Errorf("invalid sealed file header: %v", err)
+	}
+	end := len(Magic) + 4 + int(n)
+	return h, data[:end], data[end:], nil
+}
+
+func (h Header) check() error {
+	switch {
+	case h.Version != version:
+		return fmt.Errorf("sealed file version %d is not supported", h.Version)
+	case h.KDF != kdf:
+		return fmt.Errorf("unsupported key derivation %q", h.KDF)
+	case h.Cipher != cipher:
+		return fmt.Errorf("unsupported cipher %q", h.Cipher)
+	case h.Time < 1 || h.Time > maxTime || h.Memory < 8*uint32(h.Threads) || h.Memory > maxMemory || h.Threads < 1:
+		return fmt.Errorf("key derivation parameters are out of range")
+	case len(h.Salt) < 8 || len(h.Nonce) != chacha20poly1305.NonceSizeX:
+		return fmt.Errorf("invalid salt or nonce")
+	}
+	return nil
+}
+
+// Open decrypts a sealed file. A wrong passphrase returns ErrWrongPassphrase.
+func Open(data []byte, passphrase string) ([]byte, error) {
+	h, prefix, ciphertext, err := ReadHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.check(); err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, ErrNoPassphrase
+	}
+	aead, err := chacha20poly1305.NewX(deriveKey(passphrase, h.Salt, h.Params))
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, h.Nonce, ciphertext, prefix)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
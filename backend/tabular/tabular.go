@@ -0,0 +1,189 @@
+// Package tabular reads CSV and TSV files exported from spreadsheets and
+// coerces their cells to typed values.
+package tabular
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Table is a file's header row and the rows below it
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// DelimiterFor picks the field separator from the file extension, or for
+// other files from whichever of tab, semicolon or comma is most common in the
+// first line
+func DelimiterFor(filename string, content []byte) rune {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".tsv", ".tab":
+		return '\t'
+	}
+	line := content
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	best, count := ',', bytes.Count(line, []byte{','})
+	for _, d := range []rune{'\t', ';'} {
+		if n := bytes.Count(line, []byte(string(d))); n > count {
+			best, count = d, n
+		}
+	}
+	return best
+}
+
+// Read parses delimited text. The first row is the header; a UTF-8 byte order
+// mark before it, as spreadsheet programs write, is dropped. Blank rows are
+// skipped and short rows are allowed.
+func Read(content []byte, delimiter rune) (*Table, error) {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	r := csv.NewReader(bytes.NewReader(content))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("file is empty")
+	}
+
+	t := &Table{Header: make([]string, len(records[0]))}
+	for i, h := range records[0] {
+		t.Header[i] = strings.TrimSpace(h)
+	}
+	for _, record := range records[1:] {
+		blank := true
+		for _, cell := range record {
+			if strings.TrimSpace(cell) != "" {
+				blank = false
+				break
+			}
+		}
+		if !blank {
+			t.Rows = append(t.Rows, record)
+		}
+	}
+	return t, nil
+}
+
+// Column returns the index of a header, matched case-insensitively, or -1
+func (t *Table) Column(name string) int {
+	name = strings.TrimSpace(name)
+	for i, h := range t.Header {
+		if strings.EqualFold(h, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Cell returns a row's trimmed value in a column, or "" when the column is
+// missing or the row is short
+func (t *Table) Cell(row []string, column int) string {
+	if column < 0 || column >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[column])
+}
+
+// Kind is what a column's cells are coerced to
+type Kind string
+
+const (
+	KindText   Kind = "text"
+	KindNumber Kind = "number"
+	KindList   Kind = "list"
+	KindDate   Kind = "date"
+	KindBool   Kind = "bool"
+)
+
+// ValidKind reports whether k is a known kind; "" counts as text
+func ValidKind(k Kind) bool {
+	switch k {
+	case "", KindText, KindNumber, KindList, KindDate, KindBool:
+		return true
+	}
+	return false
+}
+
+// Coercion says how to convert the cells of one column
+type Coercion struct {
+	Kind      Kind
+	Separator string // Between list items; defaults to ";"
+	Format    string // Go time layout for dates; common layouts are tried when empty
+}
+
+// Layouts tried for dates without an explicit format
+var dateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+// Coerce converts a non-empty cell. Numbers become float64, lists []interface{}
+// of trimmed strings, dates "2006-01-02" strings (RFC 3339 when they carry a
+// time of day) and booleans bool.
+func Coerce(value string, c Coercion) (interface{}, error) {
+	switch c.Kind {
+	case KindNumber:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return n, nil
+
+	case KindList:
+		separator := c.Separator
+		if separator == "" {
+			separator = ";"
+		}
+		items := []interface{}{}
+		for _, item := range strings.Split(value, separator) {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+
+	case KindDate:
+		layouts := dateLayouts
+		if c.Format != "" {
+			layouts = []string{c.Format}
+		}
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+					return t.Format("2006-01-02"), nil
+				}
+				return t.Format(time.RFC3339), nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not a date", value)
+
+	case KindBool:
+		switch strings.ToLower(value) {
+		case "true", "yes", "y", "1", "x":
+			return true, nil
+		case "false", "no", "n", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%q is not a yes/no value", value)
+	}
+	return value, nil
+}
@@ -0,0 +1,147 @@
+// Package tiles cuts a large image into a zoomable XYZ tile pyramid. Zoom 0
+// is the whole image shrunk to fit one tile and the highest zoom is the image
+// at full size; each level halves the one above it. Tiles along the right
+// and bottom edges are padded with transparency to the full tile size.
+package tiles
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Size is the width and height of a tile in pixels
+const Size = 256
+
+// MaxZoom returns the zoom level at which an image of the given size is shown
+// at full size
+func MaxZoom(width, height int) int {
+	longest := math.Max(float64(width), float64(height))
+	if longest <= Size {
+		return 0
+	}
+	return int(math.Ceil(math.Log2(longest / Size)))
+}
+
+// levelSize returns the image size at a zoom level
+func levelSize(width, height, zoom, maxZoom int) (int, int) {
+	shift := maxZoom - zoom
+	w := (width + (1 << shift) - 1) >> shift
+	h := (height + (1 << shift) - 1) >> shift
+	return w, h
+}
+
+// Count returns the number of tiles in the pyramid of an image
+func Count(width, height int) int {
+	maxZoom := MaxZoom(width, height)
+	total := 0
+	for z := 0; z <= maxZoom; z++ {
+		w, h := levelSize(width, height, z, maxZoom)
+		total += ((w + Size - 1) / Size) * ((h + Size - 1) / Size)
+	}
+	return total
+}
+
+// Path returns the file a tile is written to below dir
+func Path(dir string, z, x, y int) string {
+	return filepath.Join(dir, strconv.Itoa(z), strconv.Itoa(x), strconv.Itoa(y)+".png")
+}
+
+// Generate writes the tile pyramid of img below dir, from the highest zoom
+// level down. progress is called after every tile with the number written so
+// far; generation stops with its error if it returns one. It returns the
+// highest zoom level.
+func Generate(img image.Image, dir string, progress func(done, total int) error) (int, error) {
+	bounds := img.Bounds()
+	maxZoom := MaxZoom(bounds.Dx(), bounds.Dy())
+	total := Count(bounds.Dx(), bounds.Dy())
+
+	level := toNRGBA(img)
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	done := 0
+	for z := maxZoom; z >= 0; z-- {
+		if z < maxZoom {
+			level = halve(level)
+		}
+		w, h := level.Rect.Dx(), level.Rect.Dy()
+		for x := 0; x*Size < w; x++ {
+			if err := os.MkdirAll(filepath.Dir(Path(dir, z, x, 0)), 0o755); err != nil {
+				return maxZoom, err
+			}
+			for y := 0; y*Size < h; y++ {
+				tile := image.NewNRGBA(image.Rect(0, 0, Size, Size))
+				draw.Draw(tile, tile.Rect, level, image.Pt(x*Size, y*Size), draw.Src)
+				if err := writeTile(&encoder, Path(dir, z, x, y), tile); err != nil {
+					return maxZoom, err
+				}
+				done++
+				if err := progress(done, total); err != nil {
+					return maxZoom, err
+				}
+			}
+		}
+	}
+	return maxZoom, nil
+}
+
+func writeTile(encoder *png.Encoder, path string, tile image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := encoder.Encode(file, tile); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to encode tile %s: %v", path, err)
+	}
+	return file.Close()
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+		return n
+	}
+	b := img.Bounds()
+	n := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(n, n.Rect, img, b.Min, draw.Src)
+	return n
+}
+
+// halve shrinks an image to half its size, rounding up, by averaging each
+// 2x2 block of pixels weighted by alpha
+func halve(src *image.NRGBA) *image.NRGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, (sw+1)/2, (sh+1)/2))
+	for y := 0; y < dst.Rect.Dy(); y++ {
+		for x := 0; x < dst.Rect.Dx(); x++ {
+			var r, g, b, a, n uint32
+			for dy := 0; dy < 2; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					sx, sy := 2*x+dx, 2*y+dy
+					if sx >= sw || sy >= sh {
+						continue
+					}
+					i := src.PixOffset(sx, sy)
+					pa := uint32(src.Pix[i+3])
+					r += uint32(src.Pix[i]) * pa
+					g += uint32(src.Pix[i+1]) * pa
+					b += uint32(src.Pix[i+2]) * pa
+					a += pa
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			if a > 0 {
+				dst.Pix[i] = uint8(r / a)
+				dst.Pix[i+1] = uint8(g / a)
+				dst.Pix[i+2] = uint8(b / a)
+			}
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
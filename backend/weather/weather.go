@@ -0,0 +1,304 @@
+// Package weather makes up day-by-day weather for a place from its climate,
+// its terrain and the season. Each day depends only on the seed, the place
+// and the day, so any range of dates gives the same weather for the days it
+// shares with another, and nearby days drift together rather than jumping.
+package weather
+
+import (
+	"hash/fnv"
+	"math"
+	"mythsmith-backend/calendar"
+	"strings"
+)
+
+// Climate is the weather a place has over the year. Temperatures are in
+// degrees Celsius.
+type Climate struct {
+	Name       string
+	keywords   []string
+	Mean       float64 // Average temperature over the year
+	Swing      float64 // How far summer days rise above the mean, and winter days fall below it
+	DailyRange float64 // Typical gap between the night's low and the day's high
+	Wetness    float64 // Chance of rain or snow on an average day
+	// How much the season moves the chance of rain, from -1 for wet winters
+	// and dry summers to 1 for a summer monsoon
+	WetSeason   float64
+	Variability float64 // How far a spell of weather strays from the season's norm
+	Wind        float64 // Typical windiness, from 0 to 1
+}
+
+// Climates, matched against a location's climate property by keyword. More
+// specific climates come first so "subarctic" isn't read as "arctic".
+var Climates = []Climate{
+	{"subarctic", []string{"subarctic", "subpolar", "boreal", "taiga"}, -3, 18, 9, 0.35, 0.3, 6, 0.45},
+	{"polar", []string{"polar", "arctic", "antarctic", "tundra", "frozen", "glacial", "icy"}, -15, 12, 6, 0.25, 0.2, 6, 0.6},
+	{"semi-arid", []string{"semi-arid", "semiarid", "steppe", "savanna", "savannah"}, 16, 10, 15, 0.15, 0.5, 4, 0.5},
+	{"arid", []string{"arid", "desert", "dry"}, 24, 9, 18, 0.05, 0, 3, 0.45},
+	{"monsoon", []string{"monsoon"}, 26, 4, 8, 0.45, 0.9, 2, 0.35},
+	{"tropical", []string{"tropical", "tropic", "equatorial", "jungle", "rainforest"}, 27, 2, 8, 0.55, 0.3, 2, 0.25},
+	{"mediterranean", []string{"mediterranean", "subtropical", "warm temperate"}, 17, 8, 10, 0.22, -0.8, 3, 0.35},
+	{"oceanic", []string{"oceanic", "maritime", "marine"}, 10, 6, 7, 0.5, -0.2, 3, 0.55},
+	{"continental", []string{"continental", "cold"}, 6, 16, 11, 0.3, 0.3, 5, 0.4},
+	{"temperate", []string{"temperate", "mild", "moderate"}, 11, 10, 9, 0.35, 0, 4, 0.4},
+}
+
+// DefaultClimate is used for places whose climate isn't known
+const DefaultClimate = "temperate"
+
+// FindClimate matches a climate property, such as "Cold continental", to a
+// climate
+func FindClimate(property string) (Climate, bool) {
+	text := strings.ToLower(property)
+	for _, climate := range Climates {
+		for _, keyword := range climate.keywords {
+			if strings.Contains(text, keyword) {
+				return climate, true
+			}
+		}
+	}
+	return Climate{}, false
+}
+
+// ClimateNamed returns the climate with the given name
+func ClimateNamed(name string) (Climate, bool) {
+	for _, climate := range Climates {
+		if climate.Name == name {
+			return climate, true
+		}
+	}
+	return Climate{}, false
+}
+
+// Terrain adjusts a climate for the lie of the land
+type Terrain struct {
+	Name        string
+	keywords    []string
+	Offset      float64 // Added to every temperature
+	SwingScale  float64 // Scales the seasonal swing; the sea evens it out
+	RangeScale  float64 // Scales the gap between low and high
+	WetnessDiff float64
+	WindDiff    float64
+	Fog         float64 // Chance of fog on a dry, still morning
+}
+
+// Terrains, matched against a location's terrain property by keyword
+var Terrains = []Terrain{
+	{"mountains", []string{"mountain", "alpine", "peak", "highland", "crag", "spire"}, -7, 1, 1.1, 0.1, 0.25, 0.15},
+	{"hills", []string{"hill", "down", "upland", "moor"}, -2, 1, 1, 0.05, 0.1, 0.15},
+	{"coast", []string{"coast", "island", "shore", "beach", "harbo", "port", "seaside", "bay", "cliff"}, 1, 0.6, 0.6, 0.08, 0.2, 0.2},
+	{"marsh", []string{"marsh", "swamp", "bog", "fen", "mire", "wetland", "delta"}, 0, 1, 0.8, 0.1, -0.05, 0.35},
+	{"forest", []string{"forest", "wood", "jungle", "weald", "grove"}, -0.5, 0.9, 0.8, 0.05, -0.2, 0.15},
+	{"desert", []string{"desert", "dune", "sand", "waste", "badland"}, 2, 1.1, 1.4, -0.1, 0.1, 0},
+	{"valley", []string{"valley", "river", "lake", "vale"}, 0, 1, 0.9, 0.03, -0.1, 0.3},
+	{"plains", []string{"plain", "grass", "field", "steppe", "prairie", "meadow", "flat"}, 0, 1.05, 1.1, 0, 0.15, 0.05},
+	{"city", []string{"city", "town", "urban", "settlement"}, 1, 1, 0.8, 0, -0.1, 0.1},
+}
+
+// Open land, used when the terrain isn't known
+var openLand = Terrain{"open", nil, 0, 1, 1, 0, 0, 0.1}
+
+// FindTerrain matches a terrain property, such as "rocky coast", to a
+// terrain. Unmatched terrain is open land, which changes nothing.
+func FindTerrain(property string) (Terrain, bool) {
+	text := strings.ToLower(property)
+	for _, terrain := range Terrains {
+		for _, keyword := range terrain.keywords {
+			if strings.Contains(text, keyword) {
+				return terrain, true
+			}
+		}
+	}
+	return openLand, false
+}
+
+// Day is the weather on one day. Temperatures are in degrees Celsius.
+type Day struct {
+	Date          calendar.Date `json:"date"`
+	DateText      string        `json:"dateText"`
+	Season        string        `json:"season"`
+	High          float64       `json:"high"`
+	Low           float64       `json:"low"`
+	Sky           string        `json:"sky"`           // clear, partly cloudy, overcast or fog
+	Precipitation string        `json:"precipitation"` // none, drizzle, rain, heavy rain, thunderstorms, sleet, snow or heavy snow
+	Wind          string        `json:"wind"`          // calm, light breeze, breezy, strong winds or gale
+	Summary       string        `json:"summary"`
+}
+
+// Place is somewhere to make weather for. Key tells places apart, so two
+// places with the same climate don't share the same weather.
+type Place struct {
+	Key     string
+	Climate Climate
+	Terrain Terrain
+}
+
+// source makes reproducible random numbers for one place
+type source struct {
+	seed uint64
+}
+
+func newSource(seed int64, key string) source {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return source{seed: mix(uint64(seed) ^ h.Sum64())}
+}
+
+func mix(h uint64) uint64 {
+	h ^= h >> 31
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// at returns a number from 0 to 1 for a channel and step
+func (s source) at(channel uint64, n int) float64 {
+	h := mix(s.seed ^ mix(channel*0x9e3779b97f4a7c15^uint64(int64(n))))
+	return float64(h>>11) / (1 << 53)
+}
+
+// smooth returns a number from 0 to 1 that drifts over days, changing
+// direction about once a period
+func (s source) smooth(channel uint64, day int, period float64) float64 {
+	x := float64(day) / period
+	x0 := math.Floor(x)
+	t := (1 - math.Cos(math.Pi*(x-x0))) / 2
+	a, b := s.at(channel, int(x0)), s.at(channel, int(x0)+1)
+	return a + (b-a)*t
+}
+
+// Channels of random numbers
+const (
+	channelSpell = iota + 1
+	channelTemperature
+	channelWetSpell
+	channelRain
+	channelCloud
+	channelWind
+	channelFog
+)
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// Forecast returns the weather for every day from one day number to another,
+// inclusive
+func Forecast(seed int64, place Place, cal calendar.Calendar, from, to int) []Day {
+	src := newSource(seed, place.Key)
+	days := make([]Day, 0, to-from+1)
+	for n := from; n <= to; n++ {
+		days = append(days, place.day(src, cal, n))
+	}
+	return days
+}
+
+func (p Place) day(src source, cal calendar.Calendar, n int) Day {
+	c, t := p.Climate, p.Terrain
+	date := cal.FromDayNumber(n)
+	season, warmth := cal.SeasonAt(date)
+
+	// Spells of warm or cold weather last several days
+	norm := c.Mean + t.Offset + warmth*c.Swing*t.SwingScale
+	mean := norm + (src.smooth(channelSpell, n, 5)-0.5)*2*c.Variability + (src.at(channelTemperature, n)-0.5)*2
+
+	wetness := clamp01((c.Wetness + t.WetnessDiff) * (1 + c.WetSeason*warmth*0.8))
+	// Wet and dry spells, with some days breaking the pattern
+	roll := 0.6*src.smooth(channelWetSpell, n, 3) + 0.4*src.at(channelRain, n)
+	// Blending two uniform numbers bunches the rolls towards the middle;
+	// spread them back out so the chance of rain matches the wetness
+	roll = clamp01((roll-0.5)*1.35 + 0.5)
+	raining := roll < wetness
+	intensity := 0.0
+	if raining {
+		intensity = (wetness - roll) / wetness
+	}
+
+	cloud := clamp01(0.7*src.smooth(channelCloud, n, 2) + wetness*0.6 - 0.15)
+	wind := clamp01(c.Wind + t.WindDiff + (src.smooth(channelWind, n, 2)-0.5)*0.8 + intensity*0.25)
+
+	day := Day{Date: date, DateText: cal.Format(date), Season: season.Name, Precipitation: "none"}
+	spread := c.DailyRange * t.RangeScale
+	switch {
+	case raining:
+		day.Sky = "overcast"
+		spread *= 0.5
+		day.Precipitation = precipitation(mean, intensity)
+	case cloud >= 0.6:
+		day.Sky = "overcast"
+		spread *= 0.7
+	case wind < 0.3 && src.at(channelFog, n) < t.Fog*(0.5+wetness):
+		day.Sky = "fog"
+		spread *= 0.7
+	case cloud >= 0.35:
+		day.Sky = "partly cloudy"
+	default:
+		day.Sky = "clear"
+	}
+	day.High = round1(mean + spread/2)
+	day.Low = round1(mean - spread/2)
+
+	switch {
+	case wind < 0.2:
+		day.Wind = "calm"
+	case wind < 0.45:
+		day.Wind = "light breeze"
+	case wind < 0.7:
+		day.Wind = "breezy"
+	case wind < 0.88:
+		day.Wind = "strong winds"
+	default:
+		day.Wind = "gale"
+	}
+	day.Summary = summary(mean, day)
+	return day
+}
+
+func precipitation(temperature, intensity float64) string {
+	switch {
+	case temperature <= 0:
+		if intensity > 0.6 {
+			return "heavy snow"
+		}
+		return "snow"
+	case temperature <= 2:
+		return "sleet"
+	case intensity > 0.6 && temperature >= 18:
+		return "thunderstorms"
+	case intensity > 0.6:
+		return "heavy rain"
+	case intensity < 0.25:
+		return "drizzle"
+	default:
+		return "rain"
+	}
+}
+
+// summary describes a day the way a GM might read it out, e.g. "Cool and
+// overcast with rain, breezy"
+func summary(temperature float64, d Day) string {
+	feel := "Scorching"
+	for _, band := range []struct {
+		below float64
+		word  string
+	}{{-10, "Bitterly cold"}, {0, "Freezing"}, {8, "Cold"}, {14, "Cool"}, {21, "Mild"}, {27, "Warm"}, {33, "Hot"}} {
+		if temperature < band.below {
+			feel = band.word
+			break
+		}
+	}
+
+	sky := d.Sky
+	switch {
+	case d.Precipitation != "none":
+		sky = "overcast with " + d.Precipitation
+	case d.Sky == "fog":
+		sky = "foggy"
+	}
+	return feel + " and " + sky + ", " + d.Wind
+}
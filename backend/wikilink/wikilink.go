@@ -0,0 +1,81 @@
+// Package wikilink parses [[Name]] and [[target|label]] links in free text.
+package wikilink
+
+import "strings"
+
+// Link is one [[...]] occurrence in a text
+type Link struct {
+	Target string // Node ID, name or alias before the pipe
+	Label  string // Display text after the pipe, empty when there is none
+	Start  int    // Byte offset of the opening brackets
+	End    int    // Byte offset just past the closing brackets
+}
+
+// Text returns the link as it should be written
+func (l Link) Text() string {
+	if l.Label == "" {
+		return "[[" + l.Target + "]]"
+	}
+	return "[[" + l.Target + "|" + l.Label + "]]"
+}
+
+// Parse returns the links in text in order. A link may not span lines or
+// contain another "[[", and links with an empty target are ignored.
+func Parse(text string) []Link {
+	var links []Link
+	pos := 0
+	for {
+		open := strings.Index(text[pos:], "[[")
+		if open < 0 {
+			return links
+		}
+		open += pos
+
+		inner := text[open+2:]
+		end := strings.Index(inner, "]]")
+		if end < 0 {
+			return links
+		}
+		body := inner[:end]
+		if strings.ContainsAny(body, "\n\r") || strings.Contains(body, "[[") {
+			pos = open + 2 // Try again from the next "[["
+			continue
+		}
+
+		link := Link{Start: open, End: open + 2 + end + 2}
+		if i := strings.Index(body, "|"); i >= 0 {
+			link.Target = strings.TrimSpace(body[:i])
+			link.Label = strings.TrimSpace(body[i+1:])
+		} else {
+			link.Target = strings.TrimSpace(body)
+		}
+		if link.Target != "" {
+			links = append(links, link)
+		}
+		pos = link.End
+	}
+}
+
+// Rewrite replaces every link for which replace returns true with the link it
+// returns, leaving the surrounding text untouched. It reports how many links
+// were replaced.
+func Rewrite(text string, replace func(Link) (Link, bool)) (string, int) {
+	var b strings.Builder
+	count := 0
+	last := 0
+	for _, link := range Parse(text) {
+		updated, ok := replace(link)
+		if !ok {
+			continue
+		}
+		b.WriteString(text[last:link.Start])
+		b.WriteString(updated.Text())
+		last = link.End
+		count++
+	}
+	if count == 0 {
+		return text, 0
+	}
+	b.WriteString(text[last:])
+	return b.String(), count
+}